@@ -5,15 +5,152 @@ CREATE TABLE IF NOT EXISTS luxora_user (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     username VARCHAR(255) UNIQUE,
     email VARCHAR(255) UNIQUE,
-    refresh_token TEXT,
     last_login TIMESTAMP,
-    provider VARCHAR(50) CHECK (provider IN ('github', 'google', 'plain')),
-    provider_user_id TEXT UNIQUE,
     profile_picture_link TEXT,
     signup_type VARCHAR(50) CHECK (signup_type IN ('github', 'google', 'plain')),
-    password_hash TEXT
+    password_hash TEXT,
+    email_verified BOOLEAN NOT NULL DEFAULT false,
+    suspended_at TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS luxora_session (
+    session_id UUID PRIMARY KEY,
+    user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    token_hash TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS luxora_session_user_idx ON luxora_session (user_id);
+
+CREATE TABLE IF NOT EXISTS luxora_session_rotated_token (
+    token_hash TEXT PRIMARY KEY,
+    session_id UUID REFERENCES luxora_session(session_id) ON DELETE CASCADE NOT NULL,
+    rotated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS luxora_revocation (
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('token', 'session', 'user')),
+    subject TEXT NOT NULL,
+    revoked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX IF NOT EXISTS luxora_revocation_revoked_idx ON luxora_revocation (revoked_at);
+
+CREATE TABLE IF NOT EXISTS luxora_user_identity (
+    user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    provider VARCHAR(50) NOT NULL CHECK (provider IN ('github', 'google')),
+    provider_user_id TEXT NOT NULL,
+    linked_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (provider, provider_user_id),
+    UNIQUE (user_id, provider)
+);
+
+-- accounts created before identities had their own table keep their provider on the user row
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'luxora_user' AND column_name = 'provider_user_id') THEN
+        INSERT INTO luxora_user_identity (user_id, provider, provider_user_id)
+        SELECT id, provider, provider_user_id FROM luxora_user
+        WHERE provider IN ('github', 'google') AND provider_user_id IS NOT NULL
+        ON CONFLICT DO NOTHING;
+    END IF;
+END $$;
+
+ALTER TABLE luxora_user DROP COLUMN IF EXISTS provider, DROP COLUMN IF EXISTS provider_user_id;
+
+CREATE TABLE IF NOT EXISTS luxora_user_token (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    token_type SMALLINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS luxora_user_token_user_idx ON luxora_user_token (user_id, token_type) WHERE used_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS luxora_user_role (
+    user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('verifier', 'moderator', 'admin')),
+    granted_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS luxora_role_audit (
+    audit_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('grant', 'revoke')),
+    actor_id UUID REFERENCES luxora_user(id) ON DELETE SET NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS luxora_role_audit_user_idx ON luxora_role_audit (user_id, changed_at);
+
+CREATE TABLE IF NOT EXISTS luxora_category (
+    category_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    parent_id UUID REFERENCES luxora_category(category_id) ON DELETE CASCADE,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    display_name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS luxora_category_attribute (
+    category_id UUID REFERENCES luxora_category(category_id) ON DELETE CASCADE NOT NULL,
+    key VARCHAR(100) NOT NULL,
+    display_name VARCHAR(255) NOT NULL,
+    value_type VARCHAR(20) NOT NULL CHECK (value_type IN ('string', 'number', 'boolean')),
+    required BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (category_id, key)
+);
+
+INSERT INTO luxora_category (slug, display_name) VALUES
+    ('fashion', 'Fashion'),
+    ('accessories', 'Accessories'),
+    ('art', 'Art'),
+    ('collectibles', 'Collectibles')
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO luxora_category (parent_id, slug, display_name)
+SELECT p.category_id, c.slug, c.display_name
+FROM (VALUES
+    ('fashion', 'clothing', 'Clothing'),
+    ('fashion', 'shoes', 'Shoes'),
+    ('fashion', 'bags', 'Bags'),
+    ('accessories', 'watches', 'Watches'),
+    ('accessories', 'jewellery', 'Jewellery'),
+    ('accessories', 'eyewear', 'Eyewear')
+) AS c(parent, slug, display_name)
+JOIN luxora_category p ON p.slug = c.parent
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO luxora_category_attribute (category_id, key, display_name, value_type, required)
+SELECT c.category_id, a.key, a.display_name, a.value_type, a.required
+FROM (VALUES
+    ('fashion', 'brand', 'Brand', 'string', true),
+    ('fashion', 'material', 'Material', 'string', false),
+    ('clothing', 'size', 'Size', 'string', false),
+    ('shoes', 'size', 'Size', 'number', false),
+    ('bags', 'color', 'Color', 'string', false),
+    ('accessories', 'brand', 'Brand', 'string', true),
+    ('accessories', 'material', 'Material', 'string', false),
+    ('watches', 'model', 'Model', 'string', false),
+    ('watches', 'year', 'Year', 'number', false),
+    ('watches', 'movement', 'Movement', 'string', false),
+    ('jewellery', 'carat', 'Carat', 'number', false),
+    ('art', 'artist', 'Artist', 'string', true),
+    ('art', 'year', 'Year', 'number', false),
+    ('art', 'medium', 'Medium', 'string', false),
+    ('collectibles', 'year', 'Year', 'number', false)
+) AS a(category, key, display_name, value_type, required)
+JOIN luxora_category c ON c.slug = a.category
+ON CONFLICT (category_id, key) DO NOTHING;
+
 CREATE TABLE IF NOT EXISTS luxora_product (
     user_id UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
     item_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -22,9 +159,55 @@ CREATE TABLE IF NOT EXISTS luxora_product (
     category VARCHAR(255) NOT NULL,
     sold_to_user_id UUID,
     description TEXT,
-    created_at TIMESTAMP DEFAULT NOW()
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('draft', 'active', 'closed')),
+    publish_at TIMESTAMP,
+    relisted_as UUID REFERENCES luxora_product(item_id) ON DELETE SET NULL,
+    condition VARCHAR(20) CHECK (condition IN ('new', 'like_new', 'excellent', 'good', 'fair')),
+    verification_status VARCHAR(20) NOT NULL DEFAULT 'unverified' CHECK (verification_status IN ('unverified', 'pending', 'verified', 'rejected')),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS luxora_product_publish_at_idx ON luxora_product (publish_at) WHERE status = 'draft';
+CREATE INDEX IF NOT EXISTS luxora_product_category_idx ON luxora_product (lower(category));
+
+CREATE OR REPLACE FUNCTION luxora_product_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER luxora_product_updated_at
+BEFORE UPDATE ON luxora_product
+FOR EACH ROW EXECUTE FUNCTION luxora_product_updated_at();
+
+CREATE TABLE IF NOT EXISTS luxora_product_attribute (
+    product_id UUID REFERENCES luxora_product(item_id) ON DELETE CASCADE NOT NULL,
+    key VARCHAR(100) NOT NULL,
+    value_type VARCHAR(20) NOT NULL CHECK (value_type IN ('string', 'number', 'boolean')),
+    value_text TEXT NOT NULL,
+    value_number NUMERIC,
+    PRIMARY KEY (product_id, key)
 );
 
+CREATE INDEX IF NOT EXISTS luxora_product_attribute_text_idx ON luxora_product_attribute (key, lower(value_text));
+CREATE INDEX IF NOT EXISTS luxora_product_attribute_number_idx ON luxora_product_attribute (key, value_number);
+
+CREATE TABLE IF NOT EXISTS luxora_product_verification (
+    verification_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID REFERENCES luxora_product(item_id) ON DELETE CASCADE NOT NULL,
+    requested_by UUID REFERENCES luxora_user(id) ON DELETE CASCADE NOT NULL,
+    reviewer_id UUID REFERENCES luxora_user(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'verified', 'rejected', 'superseded')),
+    notes TEXT,
+    requested_at TIMESTAMP DEFAULT NOW(),
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS luxora_product_verification_product_idx ON luxora_product_verification (product_id, requested_at DESC);
+CREATE INDEX IF NOT EXISTS luxora_product_verification_pending_idx ON luxora_product_verification (requested_at) WHERE status = 'pending';
+
 CREATE TABLE IF NOT EXISTS luxora_product_price_history (
     product_id UUID REFERENCES luxora_product(item_id) ON DELETE CASCADE NOT NULL,
     price NUMERIC(14, 2) NOT NULL,
@@ -32,6 +215,24 @@ CREATE TABLE IF NOT EXISTS luxora_product_price_history (
     created TIMESTAMP DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS luxora_image_blob (
+    checksum TEXT PRIMARY KEY,
+    compressed_image BYTEA,
+    content_type VARCHAR(100),
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS luxora_image_rendition (
+    checksum TEXT REFERENCES luxora_image_blob(checksum) ON DELETE CASCADE NOT NULL,
+    size VARCHAR(10) NOT NULL CHECK (size IN ('thumb', 'medium')),
+    content_type VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    data BYTEA,
+    PRIMARY KEY (checksum, size)
+);
+
 CREATE TABLE IF NOT EXISTS luxora_product_image (
     image_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     product_id UUID  REFERENCES luxora_product(item_id) ON DELETE CASCADE,
@@ -41,6 +242,58 @@ CREATE TABLE IF NOT EXISTS luxora_product_image (
     sort_order INTEGER NOT NULL
 );
 
+CREATE INDEX IF NOT EXISTS luxora_product_image_checksum_idx ON luxora_product_image (checksum);
+CREATE INDEX IF NOT EXISTS luxora_product_image_product_idx ON luxora_product_image (product_id, sort_order);
+
+CREATE OR REPLACE FUNCTION luxora_image_blob_ref_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.checksum IS NOT NULL THEN
+        UPDATE luxora_image_blob SET ref_count = ref_count + 1 WHERE checksum = NEW.checksum;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.checksum IS NOT NULL THEN
+        UPDATE luxora_image_blob SET ref_count = ref_count - 1 WHERE checksum = OLD.checksum;
+        DELETE FROM luxora_image_blob WHERE checksum = OLD.checksum AND ref_count <= 0;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER luxora_product_image_ref_count
+AFTER INSERT OR DELETE OR UPDATE OF checksum ON luxora_product_image
+FOR EACH ROW EXECUTE FUNCTION luxora_image_blob_ref_count();
+
+CREATE TABLE IF NOT EXISTS luxora_blob_deletion (
+    checksum TEXT PRIMARY KEY,
+    queued_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS luxora_blob_upload (
+    upload_id UUID NOT NULL,
+    checksum TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, checksum)
+);
+
+CREATE INDEX IF NOT EXISTS luxora_blob_upload_checksum_idx ON luxora_blob_upload (checksum);
+
+CREATE OR REPLACE FUNCTION luxora_image_blob_queue_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND OLD.compressed_image IS NULL THEN
+        INSERT INTO luxora_blob_deletion (checksum) VALUES (OLD.checksum) ON CONFLICT (checksum) DO NOTHING;
+    ELSIF TG_OP = 'INSERT' THEN
+        DELETE FROM luxora_blob_deletion WHERE checksum = NEW.checksum;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER luxora_image_blob_queue_deletion
+AFTER INSERT OR DELETE ON luxora_image_blob
+FOR EACH ROW EXECUTE FUNCTION luxora_image_blob_queue_deletion();
+
 
 CREATE TABLE IF NOT EXISTS product_bid (
     bid_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -3,6 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database/cache"
+	"github.com/gopher93185789/luxora/server/pkg/blob"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/mailer"
+	"github.com/gopher93185789/luxora/server/pkg/token"
 )
 
 const (
@@ -10,6 +20,23 @@ const (
 	PROD
 )
 
+const (
+	DEFAULT_SMTP_PORT = 587
+	DEFAULT_APP_URL   = "https://luxoras.nl"
+)
+
+// DEFAULT_TOKEN_KEY_ROTATION is how often a new signing key is generated when TOKEN_KEYS_DIR is set.
+const DEFAULT_TOKEN_KEY_ROTATION = 30 * 24 * time.Hour
+
+// DEFAULT_TOKEN_LEEWAY covers the clock drift between servers of one deployment.
+const DEFAULT_TOKEN_LEEWAY = 30 * time.Second
+
+const (
+	BLOB_STORE_POSTGRES   = "postgres"
+	BLOB_STORE_FILESYSTEM = "filesystem"
+	BLOB_STORE_S3         = "s3"
+)
+
 type Config struct {
 	Env                uint8
 	Port               string
@@ -24,9 +51,34 @@ type Config struct {
 	GoogleRedirect     string
 	TokenEncryptionKey string
 	TokenSigningKey    string
+	OauthStateKey      string
 	ScalarPassword     string
 	ScalarFilePath     string
 	AllowedOrigin      string
+	BlobStore          string
+	BlobDir            string
+	S3Endpoint         string
+	S3Region           string
+	S3Bucket           string
+	S3AccessKey        string
+	S3SecretKey        string
+	S3PathStyle        bool
+	CacheSize          int
+	CacheTTL           time.Duration
+	SmtpHost           string
+	SmtpPort           int
+	SmtpUsername       string
+	SmtpPassword       string
+	SmtpFrom           string
+	AppURL             string
+	TokenKeysDir       string
+	TokenKeyAlgorithm  string
+	TokenKeyRotation   time.Duration
+	TokenIssuer        string
+	TokenLeeway        time.Duration
+
+	// TokenSigningKeyUntil is when tokens signed with TOKEN_SIGNING_KEY stop verifying once keys sign
+	TokenSigningKeyUntil time.Time
 }
 
 func GetServerConfig() (*Config, error) {
@@ -44,7 +96,7 @@ func GetServerConfig() (*Config, error) {
 		"GOOGLE_CLIENT_SECRET": &config.GoogleSecret,
 		"GOOGLE_REDIRECT_URL":  &config.GoogleRedirect,
 		"TOKEN_ENCRYPTION_KEY": &config.TokenEncryptionKey,
-		"TOKEN_SIGNING_KEY":    &config.TokenSigningKey,
+		"OAUTH_STATE_KEY":      &config.OauthStateKey,
 		"SCALAR_PASSWORD":      &config.ScalarPassword,
 		"SCALAR_FILEPATH":      &config.ScalarFilePath,
 		"ALLOWED_ORIGIN":       &config.AllowedOrigin,
@@ -69,11 +121,255 @@ func GetServerConfig() (*Config, error) {
 		return nil, fmt.Errorf("missing environment variables: %v", missingVars)
 	}
 
+	if err := getBlobStoreConfig(config); err != nil {
+		return nil, err
+	}
+
+	if err := getCacheConfig(config); err != nil {
+		return nil, err
+	}
+
+	if err := getMailConfig(config); err != nil {
+		return nil, err
+	}
+
+	if err := getTokenKeyConfig(config); err != nil {
+		return nil, err
+	}
+
+	// the state cookies must not depend on a key that signs tokens, which is rotated and retired
+	if config.OauthStateKey == config.TokenSigningKey {
+		return nil, fmt.Errorf("OAUTH_STATE_KEY must differ from TOKEN_SIGNING_KEY")
+	}
+
 	if config.Port == ":443" {
 		config.Env = PROD
 	} else {
 		config.Env = DEV
 	}
 
+	if err := getTokenClaimConfig(config); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// getBlobStoreConfig reads where image bytes are stored. Images stay in Postgres unless BLOB_STORE
+// is set, the variables of the chosen backend are required.
+func getBlobStoreConfig(config *Config) error {
+	config.BlobStore = os.Getenv("BLOB_STORE")
+	if config.BlobStore == "" {
+		config.BlobStore = BLOB_STORE_POSTGRES
+	}
+
+	var envVars map[string]*string
+	switch config.BlobStore {
+	case BLOB_STORE_POSTGRES:
+		return nil
+	case BLOB_STORE_FILESYSTEM:
+		envVars = map[string]*string{
+			"BLOB_DIR": &config.BlobDir,
+		}
+	case BLOB_STORE_S3:
+		envVars = map[string]*string{
+			"S3_ENDPOINT":   &config.S3Endpoint,
+			"S3_REGION":     &config.S3Region,
+			"S3_BUCKET":     &config.S3Bucket,
+			"S3_ACCESS_KEY": &config.S3AccessKey,
+			"S3_SECRET_KEY": &config.S3SecretKey,
+		}
+
+		if pathStyle := os.Getenv("S3_PATH_STYLE"); pathStyle != "" {
+			v, err := strconv.ParseBool(pathStyle)
+			if err != nil {
+				return fmt.Errorf("invalid S3_PATH_STYLE '%s'", pathStyle)
+			}
+			config.S3PathStyle = v
+		}
+	default:
+		return fmt.Errorf("invalid BLOB_STORE '%s', must be %s, %s or %s", config.BlobStore, BLOB_STORE_POSTGRES, BLOB_STORE_FILESYSTEM, BLOB_STORE_S3)
+	}
+
+	missingVars := []string{}
+	for key, ref := range envVars {
+		val := os.Getenv(key)
+		if val == "" {
+			missingVars = append(missingVars, key)
+		} else {
+			*ref = val
+		}
+	}
+
+	if len(missingVars) > 0 {
+		return fmt.Errorf("missing environment variables for %s blob store: %v", config.BlobStore, missingVars)
+	}
+
+	return nil
+}
+
+// getCacheConfig reads the size and TTL of the listing cache, a CACHE_SIZE of 0 disables it.
+func getCacheConfig(config *Config) error {
+	config.CacheSize = cache.DEFAULT_SIZE
+	config.CacheTTL = cache.DEFAULT_TTL
+
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		v, err := strconv.Atoi(size)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid CACHE_SIZE '%s'", size)
+		}
+		config.CacheSize = v
+	}
+
+	if ttl := os.Getenv("CACHE_TTL"); ttl != "" {
+		v, err := time.ParseDuration(ttl)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("invalid CACHE_TTL '%s'", ttl)
+		}
+		config.CacheTTL = v
+	}
+
+	return nil
+}
+
+// getMailConfig reads the SMTP server emails are sent through. Without SMTP_HOST emails are only
+// logged, which is enough for development.
+func getMailConfig(config *Config) error {
+	config.AppURL = strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if config.AppURL == "" {
+		config.AppURL = DEFAULT_APP_URL
+	}
+
+	config.SmtpHost = os.Getenv("SMTP_HOST")
+	if config.SmtpHost == "" {
+		return nil
+	}
+
+	config.SmtpPort = DEFAULT_SMTP_PORT
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		v, err := strconv.Atoi(port)
+		if err != nil || v <= 0 || v > 65535 {
+			return fmt.Errorf("invalid SMTP_PORT '%s'", port)
+		}
+		config.SmtpPort = v
+	}
+
+	config.SmtpUsername = os.Getenv("SMTP_USERNAME")
+	config.SmtpPassword = os.Getenv("SMTP_PASSWORD")
+	config.SmtpFrom = os.Getenv("SMTP_FROM")
+	if config.SmtpFrom == "" {
+		return fmt.Errorf("missing environment variables for smtp: [SMTP_FROM]")
+	}
+
+	return nil
+}
+
+// getTokenKeyConfig reads the directory of the keys tokens are signed with. Without TOKEN_KEYS_DIR
+// tokens are signed with TOKEN_SIGNING_KEY, which every verifier has to share. With it the secret
+// is only accepted until TOKEN_SIGNING_KEY_UNTIL, so tokens issued before the switch can be
+// migrated, and ignored without it. A TOKEN_KEY_ROTATION of 0 leaves adding and removing key files
+// to the operator.
+func getTokenKeyConfig(config *Config) error {
+	config.TokenSigningKey = os.Getenv("TOKEN_SIGNING_KEY")
+	config.TokenKeysDir = os.Getenv("TOKEN_KEYS_DIR")
+	if config.TokenKeysDir == "" {
+		if config.TokenSigningKey == "" {
+			return fmt.Errorf("missing environment variables: [TOKEN_SIGNING_KEY], or set TOKEN_KEYS_DIR")
+		}
+		return nil
+	}
+
+	if until := os.Getenv("TOKEN_SIGNING_KEY_UNTIL"); until != "" {
+		v, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fmt.Errorf("invalid TOKEN_SIGNING_KEY_UNTIL '%s', must be an RFC 3339 time", until)
+		}
+
+		if config.TokenSigningKey == "" {
+			return fmt.Errorf("TOKEN_SIGNING_KEY_UNTIL is set without TOKEN_SIGNING_KEY")
+		}
+		config.TokenSigningKeyUntil = v
+	} else {
+		config.TokenSigningKey = ""
+	}
+
+	config.TokenKeyAlgorithm = os.Getenv("TOKEN_KEY_ALGORITHM")
+	switch config.TokenKeyAlgorithm {
+	case "":
+		config.TokenKeyAlgorithm = token.ALG_EDDSA
+	case token.ALG_EDDSA, token.ALG_ES256:
+	default:
+		return fmt.Errorf("invalid TOKEN_KEY_ALGORITHM '%s', must be %s or %s", config.TokenKeyAlgorithm, token.ALG_EDDSA, token.ALG_ES256)
+	}
+
+	config.TokenKeyRotation = DEFAULT_TOKEN_KEY_ROTATION
+	if rotation := os.Getenv("TOKEN_KEY_ROTATION"); rotation != "" {
+		v, err := time.ParseDuration(rotation)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid TOKEN_KEY_ROTATION '%s'", rotation)
+		}
+		config.TokenKeyRotation = v
+	}
+
+	return nil
+}
+
+// getTokenClaimConfig reads the issuer stamped into tokens and the clock skew allowed when checking
+// them. The issuer defaults to one per environment, so a development server never accepts tokens
+// of production even when they share a key.
+func getTokenClaimConfig(config *Config) error {
+	config.TokenIssuer = os.Getenv("TOKEN_ISSUER")
+	if config.TokenIssuer == "" {
+		if config.Env == PROD {
+			config.TokenIssuer = token.DEFAULT_ISSUER + "-prod"
+		} else {
+			config.TokenIssuer = token.DEFAULT_ISSUER + "-dev"
+		}
+	}
+
+	config.TokenLeeway = DEFAULT_TOKEN_LEEWAY
+	if leeway := os.Getenv("TOKEN_LEEWAY"); leeway != "" {
+		v, err := time.ParseDuration(leeway)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid TOKEN_LEEWAY '%s'", leeway)
+		}
+		config.TokenLeeway = v
+	}
+
+	return nil
+}
+
+// newKeySet loads the configured signing keys, it returns nil when tokens are signed with the secret.
+// Replaced keys verify for as long as the longest lived token, clock skew included.
+func newKeySet(config *Config) (*token.KeySet, error) {
+	if config.TokenKeysDir == "" {
+		return nil, nil
+	}
+
+	return token.NewKeySet(config.TokenKeysDir, &token.KeySetOpts{
+		Algorithm: config.TokenKeyAlgorithm,
+		Rotate:    config.TokenKeyRotation,
+		Retain:    coreAuth.REFRESH_TOKEN_EXPIRY + config.TokenLeeway,
+	})
+}
+
+// newMailer connects the configured SMTP server, or logs emails when there is none.
+func newMailer(config *Config, logger *logger.Logger) (mailer.Mailer, error) {
+	if config.SmtpHost == "" {
+		return &mailer.Log{Logger: logger}, nil
+	}
+
+	return mailer.NewSMTP(config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword, config.SmtpFrom)
+}
+
+// newBlobStore opens the configured blob store, it returns nil when images are kept in Postgres.
+func newBlobStore(config *Config) (blob.BlobStore, error) {
+	switch config.BlobStore {
+	case BLOB_STORE_FILESYSTEM:
+		return blob.NewFileSystem(config.BlobDir)
+	case BLOB_STORE_S3:
+		return blob.NewS3(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey, config.S3PathStyle)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/mailer"
+	"github.com/gopher93185789/luxora/server/pkg/password"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+const (
+	EMAIL_VERIFICATION_EXPIRY = 24 * time.Hour
+	PASSWORD_RECOVERY_EXPIRY  = 1 * time.Hour
+	UPDATE_EMAIL_EXPIRY       = 1 * time.Hour
+)
+
+// Pages of the web app that the links in emails open, they post the token back to the API.
+const (
+	VERIFY_EMAIL_PATH   = "/auth/verify-email"
+	RESET_PASSWORD_PATH = "/auth/reset-password"
+	CONFIRM_EMAIL_PATH  = "/auth/confirm-email"
+)
+
+var ErrEmailAlreadyVerified = errors.New("email is already verified")
+
+// hashToken is what is stored of a token sent by email, a database leak must not hand out working links.
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendToken creates a single-use token and emails a link with it to the given address.
+func (s *CoreAuthContext) sendToken(ctx context.Context, userID uuid.UUID, tokenType uint8, payload, to, subject, path, text string, expiry time.Duration) error {
+	exp := time.Now().Add(expiry)
+	t, err := s.TokenConfig.GenerateTokenWithPayload(userID, exp, tokenType, payload)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to generate email token: %v", err))
+		return err
+	}
+
+	err = s.Database.InsertUserToken(ctx, userID, tokenType, hashToken(t), exp)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to store email token: %v", err))
+		return err
+	}
+
+	link := s.AppURL + path + "?token=" + url.QueryEscape(t)
+	err = s.Mailer.Send(ctx, &mailer.Message{
+		To:      to,
+		Subject: subject,
+		Body:    fmt.Sprintf(text, link),
+	})
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to send email to user %s: %v", userID, err))
+		return err
+	}
+
+	return nil
+}
+
+// verifyToken checks the signature, type and expiry of a token from an email, whether it was
+// used already is checked when it is used.
+func (s *CoreAuthContext) verifyToken(t string, tokenType uint8) (userID uuid.UUID, payload string, err error) {
+	userID, payload, err = s.TokenConfig.VerifyPayloadToken(t, tokenType)
+	if err != nil {
+		s.Logger.Debug(fmt.Sprintf("Invalid email token: %v", err))
+		return uuid.Nil, "", database.ErrTokenInvalid
+	}
+
+	return userID, payload, nil
+}
+
+func (s *CoreAuthContext) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	return s.sendToken(ctx, userID, token.EMAIL_VERIFICATION_TOKEN, email, email,
+		"Verify your email address",
+		VERIFY_EMAIL_PATH,
+		"Welcome to Luxora!\n\nOpen the link below to verify your email address:\n\n%s\n\nThe link works once and expires in 24 hours.\n",
+		EMAIL_VERIFICATION_EXPIRY,
+	)
+}
+
+// SendEmailVerification emails a verification link to the current address of a user.
+func (s *CoreAuthContext) SendEmailVerification(ctx context.Context, userID uuid.UUID) error {
+	details, err := s.Database.GetUserDetails(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get user details: %v", err))
+		return err
+	}
+
+	if !details.Email.Valid || details.Email.String == "" {
+		return fmt.Errorf("%w: account has no email address", ErrInvalidEmail)
+	}
+
+	if details.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendEmailVerification(ctx, userID, details.Email.String)
+}
+
+func (s *CoreAuthContext) VerifyEmail(ctx context.Context, t string) error {
+	userID, email, err := s.verifyToken(t, token.EMAIL_VERIFICATION_TOKEN)
+	if err != nil {
+		return err
+	}
+
+	err = s.Database.VerifyEmail(ctx, userID, hashToken(t), email)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Verified email of user: %s", userID))
+	return nil
+}
+
+// RequestPasswordReset emails a reset link if email belongs to an account with a password. It
+// behaves the same whether or not it does, so it can not be used to find out who has an account.
+func (s *CoreAuthContext) RequestPasswordReset(ctx context.Context, email string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	// the email is sent in the background, so the response does not take longer for real accounts
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+
+		userID, _, err := s.Database.GetPasswordHash(ctx, email)
+		if err != nil {
+			s.Logger.Debug(fmt.Sprintf("No password account for reset: %v", err))
+			return
+		}
+
+		s.sendToken(ctx, userID, token.PASSWORD_RECOVERY_TOKEN, "", email,
+			"Reset your password",
+			RESET_PASSWORD_PATH,
+			"Someone asked to reset the password of your Luxora account.\n\nOpen the link below to choose a new password:\n\n%s\n\nThe link works once and expires in 1 hour. If you did not ask for this, you can ignore this email.\n",
+			PASSWORD_RECOVERY_EXPIRY,
+		)
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset email, which logs the user out.
+func (s *CoreAuthContext) ResetPassword(ctx context.Context, t, newPassword string) error {
+	userID, _, err := s.verifyToken(t, token.PASSWORD_RECOVERY_TOKEN)
+	if err != nil {
+		return err
+	}
+
+	details, err := s.Database.GetUserDetails(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get user details: %v", err))
+		return err
+	}
+
+	if err := ValidatePassword(newPassword, details.Email.String, details.Username); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPassword, err)
+	}
+
+	hash, err := password.Hash(newPassword)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to hash password: %v", err))
+		return err
+	}
+
+	err = s.Database.ResetPassword(ctx, userID, hashToken(t), hash)
+	if err != nil {
+		return err
+	}
+
+	err = s.revoke(ctx, revocation.KIND_USER, userID.String())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Reset password of user: %s", userID))
+	return nil
+}
+
+// RequestEmailChange emails a confirmation link to a new address, the email only changes once the
+// link is opened. The current address is told about the request.
+func (s *CoreAuthContext) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail string) error {
+	newEmail, err := NormalizeEmail(newEmail)
+	if err != nil {
+		return err
+	}
+
+	details, err := s.Database.GetUserDetails(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get user details: %v", err))
+		return err
+	}
+
+	if details.Email.Valid && details.Email.String == newEmail {
+		return fmt.Errorf("%w: this is already your email address", ErrInvalidEmail)
+	}
+
+	err = s.sendToken(ctx, userID, token.UPDATE_EMAIL_TOKEN, newEmail, newEmail,
+		"Confirm your new email address",
+		CONFIRM_EMAIL_PATH,
+		"Open the link below to use this address for your Luxora account:\n\n%s\n\nThe link works once and expires in 1 hour.\n",
+		UPDATE_EMAIL_EXPIRY,
+	)
+	if err != nil {
+		return err
+	}
+
+	if details.Email.Valid && details.Email.String != "" {
+		err = s.Mailer.Send(ctx, &mailer.Message{
+			To:      details.Email.String,
+			Subject: "Your email address is being changed",
+			Body:    "Someone asked to change the email address of your Luxora account to " + newEmail + ".\n\nIf this was not you, reset your password right away.\n",
+		})
+		if err != nil {
+			s.Logger.Error(fmt.Sprintf("Failed to notify user %s of email change: %v", userID, err))
+		}
+	}
+
+	return nil
+}
+
+func (s *CoreAuthContext) ChangeEmail(ctx context.Context, t string) error {
+	userID, email, err := s.verifyToken(t, token.UPDATE_EMAIL_TOKEN)
+	if err != nil {
+		return err
+	}
+
+	err = s.Database.ChangeEmail(ctx, userID, hashToken(t), email)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Changed email of user: %s", userID))
+	return nil
+}
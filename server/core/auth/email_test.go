@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/mailer"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+// captureMailer keeps sent messages instead of sending them.
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []*mailer.Message
+}
+
+func (m *captureMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// token returns the token of the last link sent to an address, waiting for emails sent in the
+// background.
+func (m *captureMailer) token(t *testing.T, to string) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		m.mu.Lock()
+		for i := len(m.sent) - 1; i >= 0; i-- {
+			if m.sent[i].To != to {
+				continue
+			}
+			_, rest, ok := strings.Cut(m.sent[i].Body, "?token=")
+			if !ok {
+				continue
+			}
+			tok, _, _ := strings.Cut(rest, "\n")
+			m.mu.Unlock()
+
+			tok, err := url.QueryUnescape(tok)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return tok
+		}
+		m.mu.Unlock()
+	}
+
+	t.Fatalf("no link sent to %s", to)
+	return ""
+}
+
+func TestEmailTokens(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	mail := &captureMailer{}
+	c := CoreAuthContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		TokenConfig: token.BstConfig{
+			SecretKey: []byte("skjvkfbvdkfhvjfvkjf"),
+		},
+		Logger: logger.New(os.Stdout),
+		Mailer: mail,
+		AppURL: "https://luxoras.nl",
+	}
+	defer c.Logger.Close()
+
+	at, _, err := c.Signup(t.Context(), &models.Signup{Email: "jack@example.com", Username: "jack", Password: "correct horse battery staple"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, err := c.TokenConfig.VerifyToken(at, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new verification link replaces the one sent on signup
+	first := mail.token(t, "jack@example.com")
+	if err := c.SendEmailVerification(t.Context(), uid); err != nil {
+		t.Fatal(err)
+	}
+	verify := mail.token(t, "jack@example.com")
+
+	if err := c.VerifyEmail(t.Context(), first); !errors.Is(err, database.ErrTokenInvalid) {
+		t.Fatalf("replaced token: got %v, want %v", err, database.ErrTokenInvalid)
+	}
+	if err := c.VerifyEmail(t.Context(), verify); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyEmail(t.Context(), verify); !errors.Is(err, database.ErrTokenInvalid) {
+		t.Fatalf("reused token: got %v, want %v", err, database.ErrTokenInvalid)
+	}
+
+	details, err := c.Database.GetUserDetails(t.Context(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !details.EmailVerified {
+		t.Fatal("expected email to be verified")
+	}
+
+	if err := c.SendEmailVerification(t.Context(), uid); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Fatalf("got %v, want %v", err, ErrEmailAlreadyVerified)
+	}
+
+	// password reset
+	if err := c.RequestPasswordReset(t.Context(), "Jack@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+	reset := mail.token(t, "jack@example.com")
+	if reset == verify {
+		t.Fatal("expected a reset link")
+	}
+
+	if err := c.ResetPassword(t.Context(), reset, "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidPassword)
+	}
+	if err := c.VerifyEmail(t.Context(), reset); !errors.Is(err, database.ErrTokenInvalid) {
+		t.Fatalf("reset token used to verify: got %v, want %v", err, database.ErrTokenInvalid)
+	}
+	if err := c.ResetPassword(t.Context(), reset, "a brand new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetPassword(t.Context(), reset, "another new passphrase"); !errors.Is(err, database.ErrTokenInvalid) {
+		t.Fatalf("reused token: got %v, want %v", err, database.ErrTokenInvalid)
+	}
+
+	if _, _, err := c.Login(t.Context(), &models.Login{Email: "jack@example.com", Password: "correct horse battery staple"}, nil); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("old password: got %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, _, err := c.Login(t.Context(), &models.Login{Email: "jack@example.com", Password: "a brand new passphrase"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// email change
+	if err := c.RequestEmailChange(t.Context(), uid, "jack@example.com"); !errors.Is(err, ErrInvalidEmail) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidEmail)
+	}
+	if err := c.RequestEmailChange(t.Context(), uid, "jack.smith@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	change := mail.token(t, "jack.smith@example.com")
+
+	if err := c.ChangeEmail(t.Context(), change); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeEmail(t.Context(), change); !errors.Is(err, database.ErrTokenInvalid) {
+		t.Fatalf("reused token: got %v, want %v", err, database.ErrTokenInvalid)
+	}
+
+	details, err = c.Database.GetUserDetails(t.Context(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Email.String != "jack.smith@example.com" {
+		t.Fatalf("got email %s", details.Email.String)
+	}
+	if !details.EmailVerified {
+		t.Fatal("expected the confirmed email to be verified")
+	}
+}
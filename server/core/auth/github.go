@@ -5,48 +5,42 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"golang.org/x/oauth2"
 )
 
-func (s *CoreAuthContext) handleOauthSignup(ctx context.Context, username, providerID, profileImageLink string) (accessToken, refreshToken string, err error) {
+func (s *CoreAuthContext) handleOauthSignup(ctx context.Context, username, providerID, profileImageLink string) (userID uuid.UUID, err error) {
 	if len(username) == 0 {
-		return "", "", fmt.Errorf("invalid username")
+		return uuid.Nil, fmt.Errorf("invalid username")
 	}
 
-	uid, err := s.Database.InsertOauthUser(ctx, username, "github", providerID, profileImageLink)
+	uid, err := s.Database.InsertOauthUser(ctx, username, PROVIDER_GITHUB, providerID, profileImageLink)
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Failed to insert OAuth user: %v", err))
-		return "", "", err
-	}
-
-	accessToken, refreshToken, err = s.generateTokens(uid)
-	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to generate tokens: %v", err))
-		return "", "", err
-	}
-
-	err = s.Database.UpdateRefreshToken(ctx, uid, refreshToken)
-	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to update refresh token: %v", err))
-		return "", "", err
+		return uuid.Nil, err
 	}
 
 	s.Logger.Info(fmt.Sprintf("Successfully completed OAuth signup for user: %s", username))
-	return accessToken, refreshToken, err
+	return uid, nil
 }
 
-func (s *CoreAuthContext) HandleGithubOauth(ctx context.Context, code string) (accessToken, refreshToken string, err error) {
+// HandleGithubOauth exchanges a code for a Github token, proving with verifier that this server started the login.
+// When link is set the Github account is linked to that user, who is then logged in.
+func (s *CoreAuthContext) HandleGithubOauth(ctx context.Context, code, verifier string, link uuid.UUID, client *models.Client) (accessToken, refreshToken string, err error) {
 	if code == "" {
 		return "", "", fmt.Errorf("invalid exchange code")
 	}
 
-	token, err := s.GithubConfig.Exchange(ctx, code)
+	token, err := s.GithubConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("GitHub token exchange failed: %v", err))
 		return "", "", err
 	}
 
-	client := s.GithubConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://api.github.com/user")
+	httpClient := s.GithubConfig.Client(context.Background(), token)
+	resp, err := httpClient.Get("https://api.github.com/user")
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Failed to fetch GitHub user details: %v", err))
 		return "", "", err
@@ -62,27 +56,17 @@ func (s *CoreAuthContext) HandleGithubOauth(ctx context.Context, code string) (a
 	pidn := strconv.Itoa(user.ProviderID)
 	s.Logger.Debug(fmt.Sprintf("Looking up user with GitHub ID: %s", pidn))
 
-	id, err := s.Database.GetOauthUserIdByProviderID(ctx, pidn)
-	if err != nil {
+	id, err := s.resolveIdentity(ctx, PROVIDER_GITHUB, pidn, link, func(ctx context.Context) (uuid.UUID, error) {
 		s.Logger.Info(fmt.Sprintf("User not found, starting OAuth signup flow for GitHub user: %s", user.Login))
-		accessToken, refreshToken, err = s.handleOauthSignup(ctx, user.Login, pidn, user.ProfileImageLink)
-		if err != nil {
-			return "", "", err
-		}
-
-		return accessToken, refreshToken, nil
-	}
-
-	s.Logger.Debug(fmt.Sprintf("Generating new tokens for existing user: %s", id))
-	accessToken, refreshToken, err = s.generateTokens(id)
+		return s.handleOauthSignup(ctx, user.Login, pidn, user.ProfileImageLink)
+	})
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to generate tokens: %v", err))
 		return "", "", err
 	}
 
-	err = s.Database.UpdateRefreshToken(ctx, id, refreshToken)
+	s.Logger.Debug(fmt.Sprintf("Generating new tokens for user: %s", id))
+	accessToken, refreshToken, err = s.issueTokens(ctx, id, client)
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to update refresh token: %v", err))
 		return "", "", err
 	}
 
@@ -6,44 +6,36 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"golang.org/x/oauth2"
 )
 
-func (s *CoreAuthContext) handleGoogleOauthSignup(ctx context.Context, providerID, profileImageLink string) (accessToken, refreshToken string, err error) {
-	uid, err := s.Database.InsertOauthUser(ctx, "Anonymous"+uuid.New().String(), "google", providerID, profileImageLink)
+func (s *CoreAuthContext) handleGoogleOauthSignup(ctx context.Context, providerID, profileImageLink string) (userID uuid.UUID, err error) {
+	uid, err := s.Database.InsertOauthUser(ctx, "Anonymous"+uuid.New().String(), PROVIDER_GOOGLE, providerID, profileImageLink)
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Failed to insert Google OAuth user: %v", err))
-		return "", "", err
-	}
-
-	accessToken, refreshToken, err = s.generateTokens(uid)
-	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to generate tokens: %v", err))
-		return "", "", err
-	}
-
-	err = s.Database.UpdateRefreshToken(ctx, uid, refreshToken)
-	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to update refresh token: %v", err))
-		return "", "", err
+		return uuid.Nil, err
 	}
 
 	s.Logger.Info(fmt.Sprintf("Successfully completed Google OAuth signup for user: %s", uid))
-	return accessToken, refreshToken, err
+	return uid, nil
 }
 
-func (s *CoreAuthContext) HandleGoogleOauth(ctx context.Context, code string) (accessToken, refreshToken string, err error) {
+// HandleGoogleOauth exchanges a code for a Google token, proving with verifier that this server started the login.
+// When link is set the Google account is linked to that user, who is then logged in.
+func (s *CoreAuthContext) HandleGoogleOauth(ctx context.Context, code, verifier string, link uuid.UUID, client *models.Client) (accessToken, refreshToken string, err error) {
 	if code == "" {
 		return "", "", fmt.Errorf("invalid exchange code")
 	}
 
-	token, err := s.GoogleConfig.Exchange(ctx, code)
+	token, err := s.GoogleConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Google token exchange failed: %v", err))
 		return "", "", err
 	}
 
-	client := s.GoogleConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	httpClient := s.GoogleConfig.Client(context.Background(), token)
+	resp, err := httpClient.Get("https://www.googleapis.com/oauth2/v2/userinfo")
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Failed to fetch Google user details: %v", err))
 		return "", "", err
@@ -62,27 +54,17 @@ func (s *CoreAuthContext) HandleGoogleOauth(ctx context.Context, code string) (a
 	}
 
 	s.Logger.Debug(fmt.Sprintf("Looking up user with Google ID: %s", user.ProviderID))
-	_, id, err := s.Database.GetIsUsernameAndIDByProviderID(ctx, user.ProviderID)
-	if err != nil {
+	id, err := s.resolveIdentity(ctx, PROVIDER_GOOGLE, user.ProviderID, link, func(ctx context.Context) (uuid.UUID, error) {
 		s.Logger.Info("User not found, starting Google OAuth signup flow")
-		accessToken, refreshToken, err = s.handleGoogleOauthSignup(ctx, user.ProviderID, user.Picture)
-		if err != nil {
-			return "", "", err
-		}
-
-		return accessToken, refreshToken, nil
-	}
-
-	s.Logger.Debug(fmt.Sprintf("Generating new tokens for existing user: %s", id))
-	accessToken, refreshToken, err = s.generateTokens(id)
+		return s.handleGoogleOauthSignup(ctx, user.ProviderID, user.Picture)
+	})
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to generate tokens: %v", err))
 		return "", "", err
 	}
 
-	err = s.Database.UpdateRefreshToken(ctx, id, refreshToken)
+	s.Logger.Debug(fmt.Sprintf("Generating new tokens for user: %s", id))
+	accessToken, refreshToken, err = s.issueTokens(ctx, id, client)
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to update refresh token: %v", err))
 		return "", "", err
 	}
 
@@ -1,19 +1,37 @@
 package auth
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/token"
 )
 
-func (s *CoreAuthContext) generateTokens(userID uuid.UUID) (accessToken, refreshToken string, err error) {
-	accessToken, err = s.TokenConfig.GenerateToken(userID, time.Now().Add(1*time.Hour), token.ACCESS_TOKEN)
+const (
+	ACCESS_TOKEN_EXPIRY  = 1 * time.Hour
+	REFRESH_TOKEN_EXPIRY = 720 * time.Hour
+)
+
+// generateTokens creates the tokens of a session, both carry the session id so a refresh can find
+// its session and a request can tell which session it was made with. The access token carries the
+// roles of the user, they are read again on every refresh.
+func (s *CoreAuthContext) generateTokens(ctx context.Context, userID, sessionID uuid.UUID) (accessToken, refreshToken string, err error) {
+	roles, err := s.Database.GetRoles(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get roles of user %s: %v", userID, err))
+		return "", "", err
+	}
+	roles = append([]string{models.ROLE_USER}, roles...)
+
+	accessToken, err = s.TokenConfig.GenerateTokenWithRoles(userID, time.Now().Add(ACCESS_TOKEN_EXPIRY), token.ACCESS_TOKEN, sessionID.String(), roles)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err = s.TokenConfig.GenerateToken(userID, time.Now().Add(720*time.Hour), token.REFRESH_TOKEN)
+	refreshToken, err = s.TokenConfig.GenerateTokenWithPayload(userID, time.Now().Add(REFRESH_TOKEN_EXPIRY), token.REFRESH_TOKEN, sessionID.String())
 	if err != nil {
 		return "", "", err
 	}
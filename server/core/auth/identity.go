@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+)
+
+// resolveIdentity finds the user a provider account belongs to. When link is set the account is
+// linked to that user instead, and when the account is unknown and there is nothing to link to,
+// signup creates a new user for it.
+func (s *CoreAuthContext) resolveIdentity(ctx context.Context, provider, providerID string, link uuid.UUID, signup func(ctx context.Context) (uuid.UUID, error)) (userID uuid.UUID, err error) {
+	id, err := s.Database.GetUserIdByIdentity(ctx, provider, providerID)
+	if err != nil && !errors.Is(err, database.ErrIdentityNotFound) {
+		s.Logger.Error(fmt.Sprintf("Failed to look up %s identity: %v", provider, err))
+		return uuid.Nil, err
+	}
+
+	if link == uuid.Nil {
+		if err == nil {
+			return id, nil
+		}
+
+		return signup(ctx)
+	}
+
+	if err == nil {
+		if id != link {
+			s.Logger.Info(fmt.Sprintf("Refused to link %s account of user %s to user %s", provider, id, link))
+			return uuid.Nil, database.ErrIdentityLinked
+		}
+
+		return link, nil
+	}
+
+	err = s.Database.InsertIdentity(ctx, link, provider, providerID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to link %s account to user %s: %v", provider, link, err))
+		return uuid.Nil, err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Linked %s account to user: %s", provider, link))
+	return link, nil
+}
+
+// UnlinkProvider removes the account of provider from a user, as long as the user can still log in
+// some other way afterwards.
+func (s *CoreAuthContext) UnlinkProvider(ctx context.Context, userID uuid.UUID, provider string) error {
+	if _, err := s.oauthConfig(provider); err != nil {
+		return err
+	}
+
+	err := s.Database.DeleteIdentity(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Unlinked %s account from user: %s", provider, userID))
+	return nil
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/revocation"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/mailer"
 	"github.com/gopher93185789/luxora/server/pkg/token"
 	"golang.org/x/oauth2"
 )
@@ -10,10 +12,17 @@ import (
 type CoreAuthContext struct {
 	GoogleConfig *oauth2.Config
 	GithubConfig *oauth2.Config
-	OauthState   string
-	Database     database.Database
-	TokenConfig  token.BstConfig
-	Logger       *logger.Logger
+	// StateKey signs the cookies that bind an oauth login to the browser that started it
+	StateKey    []byte
+	Database    database.Database
+	TokenConfig token.BstConfig
+	Logger      *logger.Logger
+	Mailer      mailer.Mailer
+	// AppURL is the address of the web app, links in emails point to its pages
+	AppURL string
+	// Revocations makes access tokens stop working when their session ends, without it they stay
+	// valid until they expire
+	Revocations *revocation.Store
 }
 
 type GithubUserDetails struct {
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	PROVIDER_GITHUB = "github"
+	PROVIDER_GOOGLE = "google"
+)
+
+// OAUTH_STATE_EXPIRY is how long a user has to log in with a provider, after which the login has to
+// be started again.
+const OAUTH_STATE_EXPIRY = 10 * time.Minute
+
+var (
+	ErrOauthStateMissing  = errors.New("missing oauth state, start the login again")
+	ErrOauthStateInvalid  = errors.New("invalid oauth state, start the login again")
+	ErrOauthStateExpired  = errors.New("oauth login expired, start the login again")
+	ErrOauthStateMismatch = errors.New("oauth state does not match this login")
+	ErrUnknownProvider    = errors.New("unknown oauth provider")
+)
+
+// oauthLogin is what a browser has to present to finish a login it started. It is kept in a
+// cookie signed with the StateKey, so the server does not have to remember logins in progress.
+type oauthLogin struct {
+	Provider string    `json:"p"`
+	State    string    `json:"s"`
+	Verifier string    `json:"v"`
+	Exp      time.Time `json:"exp"`
+	// Link is the user the provider account gets linked to, empty for a login
+	Link string `json:"l,omitempty"`
+}
+
+func (s *CoreAuthContext) oauthConfig(provider string) (*oauth2.Config, error) {
+	switch provider {
+	case PROVIDER_GITHUB:
+		return s.GithubConfig, nil
+	case PROVIDER_GOOGLE:
+		return s.GoogleConfig, nil
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownProvider, provider)
+	}
+}
+
+// signOauthLogin MACs the login together with a label, so the StateKey can not be used to forge
+// anything else it signs.
+func (s *CoreAuthContext) signOauthLogin(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.StateKey)
+	mac.Write([]byte("luxora oauth state\n"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// StartOauthLogin creates a random state and PKCE verifier for a new login with provider. It returns
+// the URL to send the user to and the value of the cookie that binds the login to their browser.
+func (s *CoreAuthContext) StartOauthLogin(provider string) (authURL, cookie string, err error) {
+	return s.startOauth(provider, uuid.Nil)
+}
+
+// StartOauthLink starts a login with provider that links the provider account to userID instead of
+// logging in as whoever owns it. It is finished by the same exchange as a login.
+func (s *CoreAuthContext) StartOauthLink(provider string, userID uuid.UUID) (authURL, cookie string, err error) {
+	if userID == uuid.Nil {
+		return "", "", fmt.Errorf("invalid user id")
+	}
+
+	return s.startOauth(provider, userID)
+}
+
+func (s *CoreAuthContext) startOauth(provider string, link uuid.UUID) (authURL, cookie string, err error) {
+	config, err := s.oauthConfig(provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return "", "", err
+	}
+
+	login := oauthLogin{
+		Provider: provider,
+		State:    base64.RawURLEncoding.EncodeToString(state),
+		Verifier: oauth2.GenerateVerifier(),
+		Exp:      time.Now().Add(OAUTH_STATE_EXPIRY),
+	}
+
+	if link != uuid.Nil {
+		login.Link = link.String()
+	}
+
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", "", err
+	}
+
+	cookie = base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.signOauthLogin(payload))
+	authURL = config.AuthCodeURL(login.State, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(login.Verifier))
+	return authURL, cookie, nil
+}
+
+// VerifyOauthLogin checks that the state a provider redirected back with belongs to the login
+// started in this browser, and returns the PKCE verifier to exchange the code with. When the login
+// was started by StartOauthLink, link is the user to link the provider account to.
+func (s *CoreAuthContext) VerifyOauthLogin(provider, cookie, state string) (verifier string, link uuid.UUID, err error) {
+	if cookie == "" {
+		return "", uuid.Nil, ErrOauthStateMissing
+	}
+
+	encodedPayload, encodedMAC, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return "", uuid.Nil, ErrOauthStateInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", uuid.Nil, ErrOauthStateInvalid
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.signOauthLogin(payload)) {
+		return "", uuid.Nil, ErrOauthStateInvalid
+	}
+
+	var login oauthLogin
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return "", uuid.Nil, ErrOauthStateInvalid
+	}
+
+	if time.Now().After(login.Exp) {
+		return "", uuid.Nil, ErrOauthStateExpired
+	}
+
+	if login.Provider != provider || subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		return "", uuid.Nil, ErrOauthStateMismatch
+	}
+
+	if login.Link != "" {
+		link, err = uuid.Parse(login.Link)
+		if err != nil {
+			return "", uuid.Nil, ErrOauthStateInvalid
+		}
+	}
+
+	return login.Verifier, link, nil
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+func newOauthTestContext(key string) *CoreAuthContext {
+	return &CoreAuthContext{
+		GithubConfig: &oauth2.Config{
+			ClientID: "client",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://github.example/login/oauth/authorize"},
+		},
+		GoogleConfig: &oauth2.Config{
+			ClientID: "client",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://google.example/o/oauth2/auth"},
+		},
+		StateKey: []byte(key),
+	}
+}
+
+func TestOauthLogin(t *testing.T) {
+	c := newOauthTestContext("skjvkfbvdkfhvjfvkjf")
+
+	authURL, cookie, err := c.StartOauthLogin(PROVIDER_GITHUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := u.Query().Get("state")
+	if len(state) < 32 {
+		t.Fatalf("state %q is too short", state)
+	}
+
+	if u.Query().Get("code_challenge_method") != "S256" || u.Query().Get("code_challenge") == "" {
+		t.Fatalf("missing PKCE challenge in %s", authURL)
+	}
+
+	verifier, link, err := c.VerifyOauthLogin(PROVIDER_GITHUB, cookie, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != uuid.Nil {
+		t.Fatalf("login verified as a link to %s", link)
+	}
+
+	if oauth2.S256ChallengeFromVerifier(verifier) != u.Query().Get("code_challenge") {
+		t.Fatal("verifier does not match the challenge sent to the provider")
+	}
+
+	_, other, err := c.StartOauthLogin(PROVIDER_GITHUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == cookie {
+		t.Fatal("expected every login to get its own state")
+	}
+
+	payload, mac, _ := strings.Cut(cookie, ".")
+	tampered, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered[len(tampered)-2] ^= 1
+
+	tests := map[string]struct {
+		provider, cookie, state string
+		key                     string
+		want                    error
+	}{
+		"missing cookie":   {PROVIDER_GITHUB, "", state, "", ErrOauthStateMissing},
+		"other state":      {PROVIDER_GITHUB, cookie, "attacker", "", ErrOauthStateMismatch},
+		"empty state":      {PROVIDER_GITHUB, cookie, "", "", ErrOauthStateMismatch},
+		"other provider":   {PROVIDER_GOOGLE, cookie, state, "", ErrOauthStateMismatch},
+		"other login":      {PROVIDER_GITHUB, other, state, "", ErrOauthStateMismatch},
+		"tampered payload": {PROVIDER_GITHUB, base64.RawURLEncoding.EncodeToString(tampered) + "." + mac, state, "", ErrOauthStateInvalid},
+		"no signature":     {PROVIDER_GITHUB, payload, state, "", ErrOauthStateInvalid},
+		"other key":        {PROVIDER_GITHUB, cookie, state, "another key", ErrOauthStateInvalid},
+	}
+
+	for name, tt := range tests {
+		verifyWith := c
+		if tt.key != "" {
+			verifyWith = newOauthTestContext(tt.key)
+		}
+
+		if _, _, err := verifyWith.VerifyOauthLogin(tt.provider, tt.cookie, tt.state); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tt.want)
+		}
+	}
+}
+
+func TestOauthLoginExpired(t *testing.T) {
+	c := newOauthTestContext("skjvkfbvdkfhvjfvkjf")
+
+	payload, err := json.Marshal(oauthLogin{
+		Provider: PROVIDER_GOOGLE,
+		State:    "state",
+		Verifier: oauth2.GenerateVerifier(),
+		Exp:      time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.signOauthLogin(payload))
+	if _, _, err := c.VerifyOauthLogin(PROVIDER_GOOGLE, cookie, "state"); !errors.Is(err, ErrOauthStateExpired) {
+		t.Fatalf("got %v, want %v", err, ErrOauthStateExpired)
+	}
+}
+
+func TestOauthLink(t *testing.T) {
+	c := newOauthTestContext("skjvkfbvdkfhvjfvkjf")
+	uid := uuid.New()
+
+	authURL, cookie, err := c.StartOauthLink(PROVIDER_GOOGLE, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, link, err := c.VerifyOauthLogin(PROVIDER_GOOGLE, cookie, u.Query().Get("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != uid {
+		t.Fatalf("got link to %s, want %s", link, uid)
+	}
+
+	if _, _, err := c.StartOauthLink(PROVIDER_GOOGLE, uuid.Nil); err == nil {
+		t.Fatal("expected a link without a user to fail")
+	}
+
+	if _, _, err := c.StartOauthLink("gitlab", uid); err == nil {
+		t.Fatal("expected an unknown provider to fail")
+	}
+}
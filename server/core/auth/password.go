@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/password"
+)
+
+const SIGNUP_TYPE_PLAIN = "plain"
+
+// Passwords are capped so a single login can not make the server hash megabytes.
+const (
+	PASSWORD_MIN_LENGTH = 10
+	PASSWORD_MAX_LENGTH = 128
+	USERNAME_MIN_LENGTH = 3
+	USERNAME_MAX_LENGTH = 32
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidSignup      = errors.New("invalid signup")
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrInvalidEmail       = errors.New("invalid email address")
+)
+
+// dummyHash is verified against when an email is unknown, so a login takes as long whether or not
+// the account exists.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := password.Hash(uuid.NewString())
+	return hash
+})
+
+// NormalizeEmail validates an email address and lowercases it, the way emails are stored.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+func validateUsername(username string) error {
+	if n := utf8.RuneCountInString(username); n < USERNAME_MIN_LENGTH || n > USERNAME_MAX_LENGTH {
+		return fmt.Errorf("username must be between %d and %d characters", USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH)
+	}
+
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' {
+			return fmt.Errorf("username may only contain letters, digits, '_', '-' and '.'")
+		}
+	}
+
+	return nil
+}
+
+// ValidatePassword enforces the password policy: a length between PASSWORD_MIN_LENGTH and
+// PASSWORD_MAX_LENGTH, at least one letter and one other character, and not containing the
+// email or username of the account.
+func ValidatePassword(pw, email, username string) error {
+	if n := utf8.RuneCountInString(pw); n < PASSWORD_MIN_LENGTH || n > PASSWORD_MAX_LENGTH {
+		return fmt.Errorf("password must be between %d and %d characters", PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH)
+	}
+
+	var letter, other bool
+	for _, r := range pw {
+		if unicode.IsLetter(r) {
+			letter = true
+		} else {
+			other = true
+		}
+	}
+
+	if !letter || !other {
+		return fmt.Errorf("password must contain a letter and a digit or symbol")
+	}
+
+	lower := strings.ToLower(pw)
+	local, _, _ := strings.Cut(email, "@")
+	for _, personal := range []string{local, strings.ToLower(username)} {
+		if len(personal) >= USERNAME_MIN_LENGTH && strings.Contains(lower, personal) {
+			return fmt.Errorf("password must not contain your email or username")
+		}
+	}
+
+	return nil
+}
+
+// issueTokens starts a session for a user who just proved who they are, on the device client.
+func (s *CoreAuthContext) issueTokens(ctx context.Context, userID uuid.UUID, client *models.Client) (accessToken, refreshToken string, err error) {
+	err = s.checkSuspended(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	sessionID := uuid.New()
+	accessToken, refreshToken, err = s.generateTokens(ctx, userID, sessionID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to generate tokens: %v", err))
+		return "", "", err
+	}
+
+	session := newSession(userID, refreshToken, client)
+	session.SessionID = sessionID
+	err = s.Database.InsertSession(ctx, session)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to start session: %v", err))
+		return "", "", err
+	}
+
+	err = s.Database.UpdateLastLogin(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to update last login: %v", err))
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func (s *CoreAuthContext) Signup(ctx context.Context, signup *models.Signup, client *models.Client) (accessToken, refreshToken string, err error) {
+	email, err := NormalizeEmail(signup.Email)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidSignup, err)
+	}
+
+	username := strings.TrimSpace(signup.Username)
+	if err := validateUsername(username); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidSignup, err)
+	}
+
+	if err := ValidatePassword(signup.Password, email, username); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidSignup, err)
+	}
+
+	hash, err := password.Hash(signup.Password)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to hash password: %v", err))
+		return "", "", err
+	}
+
+	uid, err := s.Database.InsertUser(ctx, username, email, SIGNUP_TYPE_PLAIN, hash)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to insert user: %v", err))
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err = s.issueTokens(ctx, uid, client)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the account works without a verified email, a failed email can be sent again later
+	if err := s.sendEmailVerification(ctx, uid, email); err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to send verification email to user %s: %v", uid, err))
+	}
+
+	s.Logger.Info(fmt.Sprintf("Successfully signed up user: %s", uid))
+	return accessToken, refreshToken, nil
+}
+
+func (s *CoreAuthContext) Login(ctx context.Context, login *models.Login, client *models.Client) (accessToken, refreshToken string, err error) {
+	if utf8.RuneCountInString(login.Password) > PASSWORD_MAX_LENGTH {
+		return "", "", ErrInvalidCredentials
+	}
+
+	email, err := NormalizeEmail(login.Email)
+	if err != nil {
+		return "", "", ErrInvalidCredentials
+	}
+
+	uid, hash, err := s.Database.GetPasswordHash(ctx, email)
+	if err != nil {
+		s.Logger.Debug(fmt.Sprintf("No password account for login: %v", err))
+		password.Verify(login.Password, dummyHash())
+		return "", "", ErrInvalidCredentials
+	}
+
+	ok, err := password.Verify(login.Password, hash)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to verify password of user %s: %v", uid, err))
+		return "", "", ErrInvalidCredentials
+	}
+
+	if !ok {
+		s.Logger.Info(fmt.Sprintf("Failed login for user: %s", uid))
+		return "", "", ErrInvalidCredentials
+	}
+
+	// hashes made with older parameters are upgraded while the password is at hand
+	if password.NeedsRehash(hash, password.DefaultParams) {
+		if hash, err := password.Hash(login.Password); err == nil {
+			if err := s.Database.UpdatePasswordHash(ctx, uid, hash); err != nil {
+				s.Logger.Error(fmt.Sprintf("Failed to rehash password of user %s: %v", uid, err))
+			}
+		}
+	}
+
+	accessToken, refreshToken, err = s.issueTokens(ctx, uid, client)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Successfully logged in user: %s", uid))
+	return accessToken, refreshToken, nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := NormalizeEmail("  Jack.Smith@Example.COM ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email != "jack.smith@example.com" {
+		t.Fatalf("got %s", email)
+	}
+
+	for _, invalid := range []string{"", "jack", "jack@", "@example.com", "Jack <jack@example.com>", "jack@example.com, jill@example.com"} {
+		if _, err := NormalizeEmail(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	if err := ValidatePassword("correct horse battery staple", "jack@example.com", "jack"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"too short":        "short1!",
+		"too long":         string(make([]byte, PASSWORD_MAX_LENGTH+1)),
+		"only letters":     "onlyletterspassword",
+		"only digits":      "12345678901234",
+		"contains email":   "jacksmith-2024!",
+		"contains name":    "i-am-Jack1234",
+		"multibyte length": "ééééé1",
+	}
+
+	for name, pw := range tests {
+		if err := ValidatePassword(pw, "jacksmith@example.com", "jack1234"); err == nil {
+			t.Errorf("%s: expected %q to be rejected", name, pw)
+		}
+	}
+}
+
+func TestPasswordSignupAndLogin(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := CoreAuthContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		TokenConfig: token.BstConfig{
+			SecretKey: []byte("skjvkfbvdkfhvjfvkjf"),
+		},
+		Logger: logger.New(os.Stdout),
+		Mailer: &captureMailer{},
+	}
+	defer c.Logger.Close()
+
+	at, rt, err := c.Signup(t.Context(), &models.Signup{Email: "Jack@Example.com", Username: "jack", Password: "correct horse battery staple"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at == "" || rt == "" {
+		t.Fatal("expected tokens")
+	}
+
+	uid, err := c.TokenConfig.VerifyToken(at, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = c.Signup(t.Context(), &models.Signup{Email: "jack@example.com", Username: "jill", Password: "correct horse battery staple"}, nil)
+	if !errors.Is(err, database.ErrUserExists) {
+		t.Fatalf("got %v, want %v", err, database.ErrUserExists)
+	}
+
+	_, _, err = c.Signup(t.Context(), &models.Signup{Email: "jill@example.com", Username: "jill", Password: "short"}, nil)
+	if !errors.Is(err, ErrInvalidSignup) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidSignup)
+	}
+
+	at, _, err = c.Login(t.Context(), &models.Login{Email: " JACK@example.com", Password: "correct horse battery staple"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggedIn, err := c.TokenConfig.VerifyToken(at, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn != uid {
+		t.Fatal("logged in as another user")
+	}
+
+	lastLogin, err := c.Database.GetLastLogin(t.Context(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lastLogin.Valid {
+		t.Fatal("expected last login to be set")
+	}
+
+	for _, login := range []models.Login{
+		{Email: "jack@example.com", Password: "correct horse battery stapler"},
+		{Email: "nobody@example.com", Password: "correct horse battery staple"},
+		{Email: "not an email", Password: "correct horse battery staple"},
+	} {
+		if _, _, err := c.Login(t.Context(), &login, nil); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%+v: got %v, want %v", login, err, ErrInvalidCredentials)
+		}
+	}
+}
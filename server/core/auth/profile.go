@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/revocation"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 )
 
@@ -17,10 +20,21 @@ func (c *CoreAuthContext) GetUserInfo(ctx context.Context, userID uuid.UUID) (de
 	return details, nil
 }
 
-func (c *CoreAuthContext) Logout(ctx context.Context, userID uuid.UUID) (err error) {
-	err = c.Database.UpdateRefreshToken(ctx, userID, "")
+// Logout ends the session the request was made with, other devices stay logged in. A token
+// without a session is revoked by itself.
+func (c *CoreAuthContext) Logout(ctx context.Context, userID, sessionID uuid.UUID, tokenID string) (err error) {
+	if sessionID == uuid.Nil {
+		return c.revoke(ctx, revocation.KIND_TOKEN, tokenID)
+	}
+
+	err = c.Database.DeleteSession(ctx, userID, sessionID)
+	if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		c.Logger.Error(fmt.Sprintf("Failed to end session during logout: %v", err))
+		return err
+	}
+
+	err = c.revoke(ctx, revocation.KIND_SESSION, sessionID.String())
 	if err != nil {
-		c.Logger.Error(fmt.Sprintf("Failed to clear refresh token during logout: %v", err))
 		return err
 	}
 	c.Logger.Info(fmt.Sprintf("Successfully logged out user: %s", userID))
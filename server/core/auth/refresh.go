@@ -2,40 +2,72 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/models"
 	tk "github.com/gopher93185789/luxora/server/pkg/token"
 )
 
-func (s *CoreAuthContext) RefreshToken(ctx context.Context, token string) (accessToken, refreshToken string, err error) {
+// newSession describes the session a refresh token belongs to, only a hash of the token is stored.
+func newSession(userID uuid.UUID, refreshToken string, client *models.Client) *models.Session {
+	session := &models.Session{
+		UserID:    userID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(REFRESH_TOKEN_EXPIRY),
+	}
+
+	if client != nil {
+		session.UserAgent = client.UserAgent
+		session.IPAddress = client.IPAddress
+	}
+
+	return session
+}
+
+// RefreshToken swaps the refresh token of a session for new tokens. The old refresh token stops
+// working, and other sessions of the user are not affected. Presenting a refresh token that was
+// already swapped revokes the session, both the thief and the user have to log in again.
+func (s *CoreAuthContext) RefreshToken(ctx context.Context, token string, client *models.Client) (accessToken, refreshToken string, err error) {
 	if token == "" {
 		return "", "", fmt.Errorf("no token provided")
 	}
 
-	userid, err := s.TokenConfig.VerifyToken(token, tk.REFRESH_TOKEN)
+	userid, payload, err := s.TokenConfig.VerifyPayloadToken(token, tk.REFRESH_TOKEN)
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Token verification failed: %v", err))
 		return "", "", err
 	}
 
-	dbtoken, err := s.Database.GetRefreshToken(ctx, userid)
+	sessionID, err := uuid.Parse(payload)
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to get refresh token from database: %v", err))
-		return "", "", err
+		s.Logger.Info(fmt.Sprintf("Refresh token without session for user: %s", userid))
+		return "", "", database.ErrSessionNotFound
 	}
 
-	if token != dbtoken {
-		return "", "", fmt.Errorf("tokens dont match")
+	err = s.checkSuspended(ctx, userid)
+	if err != nil {
+		return "", "", err
 	}
 
-	accessToken, refreshToken, err = s.generateTokens(userid)
+	accessToken, refreshToken, err = s.generateTokens(ctx, userid, sessionID)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate tokens")
 	}
 
-	err = s.Database.UpdateRefreshToken(ctx, userid, refreshToken)
+	session := newSession(userid, refreshToken, client)
+	err = s.Database.RotateSession(ctx, userid, sessionID, hashToken(token), session)
+	if errors.Is(err, database.ErrTokenReused) {
+		s.Logger.Warn(fmt.Sprintf("SECURITY: rotated refresh token of session %s reused for user %s from %s (%s), session revoked", sessionID, userid, session.IPAddress, session.UserAgent))
+		s.revoke(ctx, revocation.KIND_SESSION, sessionID.String())
+		return "", "", err
+	}
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("Failed to update refresh token in database: %v", err))
+		s.Logger.Error(fmt.Sprintf("Failed to rotate session %s: %v", sessionID, err))
 		return "", "", err
 	}
 
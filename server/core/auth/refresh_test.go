@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
 	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/database/revocation"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/testutils"
 	"github.com/gopher93185789/luxora/server/pkg/token"
 )
@@ -35,18 +40,143 @@ func TestRefreshToken(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	rt, err := c.TokenConfig.GenerateToken(uid, time.Now().Add(1*time.Hour), token.REFRESH_TOKEN)
+	_, rt, err := c.issueTokens(t.Context(), uid, &models.Client{UserAgent: "laptop", IPAddress: "192.0.2.1"})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.Database.UpdateRefreshToken(t.Context(), uid, rt)
+	_, next, err := c.RefreshToken(t.Context(), rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, _, err = c.RefreshToken(t.Context(), rt)
+	_, next, err = c.RefreshToken(t.Context(), next, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	// replaying any earlier token of the session revokes it, including the token the user holds now
+	if _, _, err := c.RefreshToken(t.Context(), rt, nil); !errors.Is(err, database.ErrTokenReused) {
+		t.Fatalf("replaced token: got %v, want %v", err, database.ErrTokenReused)
+	}
+
+	if _, _, err := c.RefreshToken(t.Context(), next, nil); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("token of a revoked session: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+
+	if _, _, err := c.RefreshToken(t.Context(), rt, nil); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("replaying again: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+
+	// tokens from before sessions carry no session id
+	old, err := c.TokenConfig.GenerateToken(uid, time.Now().Add(1*time.Hour), token.REFRESH_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.RefreshToken(t.Context(), old, nil); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("token without session: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := CoreAuthContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		TokenConfig: token.BstConfig{
+			SecretKey: []byte("skjvkfbvdkfhvjfvkjf"),
+		},
+		Logger: logger.New(os.Stdout),
+	}
+	defer c.Logger.Close()
+	c.Revocations = revocation.New(c.Database, ACCESS_TOKEN_EXPIRY)
+
+	uid, err := c.Database.InsertUser(t.Context(), "dffdf@dkjfdj.com", "sfksuhuv", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	laptopAccess, laptop, err := c.issueTokens(t.Context(), uid, &models.Client{UserAgent: "laptop", IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phoneAccess, phone, err := c.issueTokens(t.Context(), uid, &models.Client{UserAgent: "phone", IPAddress: "192.0.2.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// logging in on the phone keeps the laptop logged in
+	_, laptop, err = c.RefreshToken(t.Context(), laptop, &models.Client{UserAgent: "laptop", IPAddress: "192.0.2.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, current, err := c.TokenConfig.VerifyPayloadToken(laptopAccess, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentID := uuid.MustParse(current)
+
+	sessions, err := c.GetSessions(t.Context(), uid, currentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].SessionID != currentID || !sessions[0].Current || sessions[0].IPAddress != "192.0.2.3" {
+		t.Fatalf("expected the refreshed laptop session first, got %+v", sessions[0])
+	}
+	if sessions[1].Current || sessions[1].UserAgent != "phone" {
+		t.Fatalf("got %+v", sessions[1])
+	}
+
+	other, err := c.Database.InsertUser(t.Context(), "jack@example.com", "jack", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RevokeSession(t.Context(), other, sessions[1].SessionID); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("session of another user: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+
+	if err := c.RevokeSession(t.Context(), uid, sessions[1].SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.RefreshToken(t.Context(), phone, nil); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("revoked session: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+	if !isRevoked(t, &c, phoneAccess) {
+		t.Fatal("expected access token of revoked session to be revoked")
+	}
+	if isRevoked(t, &c, laptopAccess) {
+		t.Fatal("expected access token of other session to still work")
+	}
+
+	if err := c.LogoutEverywhere(t.Context(), uid); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.RefreshToken(t.Context(), laptop, nil); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("after logging out everywhere: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+	if !isRevoked(t, &c, laptopAccess) {
+		t.Fatal("expected access tokens to be revoked after logging out everywhere")
+	}
+}
+
+func isRevoked(t *testing.T, c *CoreAuthContext, accessToken string) bool {
+	t.Helper()
+
+	claims, err := c.TokenConfig.VerifyTokenAndGetFields(accessToken, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Revocations.IsRevoked(claims)
 }
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+var (
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrForbidden is returned when a user may not act on another user
+	ErrForbidden = errors.New("forbidden")
+)
+
+// grantableRoles are the roles stored per user, every user has models.ROLE_USER without it.
+var grantableRoles = []string{models.ROLE_VERIFIER, models.ROLE_MODERATOR, models.ROLE_ADMIN}
+
+func (s *CoreAuthContext) GetRoles(ctx context.Context, userID uuid.UUID) (roles []string, err error) {
+	roles, err = s.Database.GetRoles(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get roles of user %s: %v", userID, err))
+		return nil, err
+	}
+
+	return append([]string{models.ROLE_USER}, roles...), nil
+}
+
+// isStaff reports whether a user moderates, staff can only be suspended by admins.
+func (s *CoreAuthContext) isStaff(ctx context.Context, userID uuid.UUID) (staff, admin bool, err error) {
+	roles, err := s.GetRoles(ctx, userID)
+	if err != nil {
+		return false, false, err
+	}
+
+	admin = slices.Contains(roles, models.ROLE_ADMIN)
+	return admin || slices.Contains(roles, models.ROLE_MODERATOR), admin, nil
+}
+
+// roleChanged revokes the access tokens of a user so a role change applies at once, the client
+// gets a token with the new roles on its next refresh.
+func (s *CoreAuthContext) roleChanged(ctx context.Context, actorID, userID uuid.UUID, role, action string) error {
+	s.Logger.Info(fmt.Sprintf("User %s did %s role %s for user %s", actorID, action, role, userID))
+	return s.revoke(ctx, revocation.KIND_USER, userID.String())
+}
+
+// GrantRole gives a user a role and records who did so in the audit log. An actorID of uuid.Nil is
+// for grants made from the command line.
+func (s *CoreAuthContext) GrantRole(ctx context.Context, actorID, userID uuid.UUID, role string) error {
+	if !slices.Contains(grantableRoles, role) {
+		return fmt.Errorf("%w '%s'", ErrInvalidRole, role)
+	}
+
+	changed, err := s.Database.GrantRole(ctx, actorID, userID, role)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to grant role %s to user %s: %v", role, userID, err))
+		return err
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.roleChanged(ctx, actorID, userID, role, models.ROLE_ACTION_GRANT)
+}
+
+// RevokeRole takes a role from a user and records who did so in the audit log. Admins can not
+// revoke their own admin role, so there is always an admin left.
+func (s *CoreAuthContext) RevokeRole(ctx context.Context, actorID, userID uuid.UUID, role string) error {
+	if !slices.Contains(grantableRoles, role) {
+		return fmt.Errorf("%w '%s'", ErrInvalidRole, role)
+	}
+
+	if actorID == userID && role == models.ROLE_ADMIN {
+		return fmt.Errorf("%w: admins can not revoke their own admin role", ErrForbidden)
+	}
+
+	changed, err := s.Database.RevokeRole(ctx, actorID, userID, role)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to revoke role %s of user %s: %v", role, userID, err))
+		return err
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.roleChanged(ctx, actorID, userID, role, models.ROLE_ACTION_REVOKE)
+}
+
+// GetRoleChanges returns the role audit log newest first, of every user when userID is uuid.Nil.
+func (s *CoreAuthContext) GetRoleChanges(ctx context.Context, userID uuid.UUID, limit, page int) (changes []models.RoleChange, err error) {
+	if limit <= 0 || page <= 0 {
+		return nil, fmt.Errorf("invalid pagination parameters")
+	}
+
+	changes, err = s.Database.GetRoleChanges(ctx, userID, limit, (page-1)*limit)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get role changes: %v", err))
+		return nil, err
+	}
+
+	return changes, nil
+}
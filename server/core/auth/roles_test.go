@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+func TestRoles(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := CoreAuthContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		TokenConfig: token.BstConfig{
+			SecretKey: []byte("skjvkfbvdkfhvjfvkjf"),
+		},
+		Logger: logger.New(os.Stdout),
+	}
+	defer c.Logger.Close()
+	c.Revocations = revocation.New(c.Database, ACCESS_TOKEN_EXPIRY)
+
+	admin, err := c.Database.InsertUser(t.Context(), "admin@example.com", "admin", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, err := c.Database.InsertUser(t.Context(), "jack@example.com", "jack", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.GrantRole(t.Context(), uuid.Nil, admin, models.ROLE_ADMIN); err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, _, err := c.issueTokens(t.Context(), uid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := c.TokenConfig.VerifyTokenAndGetFields(accessToken, token.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(claims.Roles, []string{models.ROLE_USER}) {
+		t.Fatalf("got roles %v, want only %s", claims.Roles, models.ROLE_USER)
+	}
+
+	if err := c.GrantRole(t.Context(), admin, uid, "owner"); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("unknown role: got %v, want %v", err, ErrInvalidRole)
+	}
+
+	if err := c.GrantRole(t.Context(), admin, uid, models.ROLE_MODERATOR); err != nil {
+		t.Fatal(err)
+	}
+	// granting a role twice changes nothing and is not logged twice
+	if err := c.GrantRole(t.Context(), admin, uid, models.ROLE_MODERATOR); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isRevoked(t, &c, accessToken) {
+		t.Fatal("expected tokens issued before the role change to be revoked")
+	}
+
+	roles, err := c.GetRoles(t.Context(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roles, []string{models.ROLE_USER, models.ROLE_MODERATOR}) {
+		t.Fatalf("got roles %v", roles)
+	}
+
+	if err := c.RevokeRole(t.Context(), admin, admin, models.ROLE_ADMIN); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("revoking own admin role: got %v, want %v", err, ErrForbidden)
+	}
+
+	if err := c.RevokeRole(t.Context(), admin, uid, models.ROLE_MODERATOR); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := c.GetRoleChanges(t.Context(), uid, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d role changes, want 2", len(changes))
+	}
+	if changes[0].Action != models.ROLE_ACTION_REVOKE || changes[1].Action != models.ROLE_ACTION_GRANT {
+		t.Fatalf("got %+v", changes)
+	}
+	if changes[1].ActorID == nil || *changes[1].ActorID != admin {
+		t.Fatalf("expected admin as actor, got %v", changes[1].ActorID)
+	}
+
+	all, err := c.GetRoleChanges(t.Context(), uuid.Nil, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[2].ActorID != nil {
+		t.Fatalf("expected the command line grant without actor last, got %+v", all)
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// GetSessions lists the devices a user is logged in on, marking the session current.
+func (s *CoreAuthContext) GetSessions(ctx context.Context, userID, current uuid.UUID) (sessions []models.Session, err error) {
+	sessions, err = s.Database.GetSessions(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to get sessions: %v", err))
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == current
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs a user out on one device.
+func (s *CoreAuthContext) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	err := s.Database.DeleteSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	err = s.revoke(ctx, revocation.KIND_SESSION, sessionID.String())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Revoked session %s of user: %s", sessionID, userID))
+	return nil
+}
+
+// LogoutEverywhere ends every session of a user, revoking the user so that access tokens of
+// sessions that were never stored stop working too.
+func (s *CoreAuthContext) LogoutEverywhere(ctx context.Context, userID uuid.UUID) error {
+	err := s.Database.DeleteSessions(ctx, userID)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to end sessions of user %s: %v", userID, err))
+		return err
+	}
+
+	err = s.revoke(ctx, revocation.KIND_USER, userID.String())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info(fmt.Sprintf("Logged out user everywhere: %s", userID))
+	return nil
+}
+
+// revoke makes access tokens stop working before they expire, if the server keeps revocations.
+func (s *CoreAuthContext) revoke(ctx context.Context, kind, subject string) error {
+	if s.Revocations == nil || subject == "" {
+		return nil
+	}
+
+	err := s.Revocations.Revoke(ctx, kind, subject)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Failed to revoke %s %s: %v", kind, subject, err))
+		return err
+	}
+
+	return nil
+}
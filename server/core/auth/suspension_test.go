@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/database/revocation"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+func TestSuspendUser(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := CoreAuthContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		TokenConfig: token.BstConfig{
+			SecretKey: []byte("skjvkfbvdkfhvjfvkjf"),
+		},
+		Logger: logger.New(os.Stdout),
+	}
+	defer c.Logger.Close()
+	c.Revocations = revocation.New(c.Database, ACCESS_TOKEN_EXPIRY)
+
+	uid, err := c.Database.InsertUser(t.Context(), "jack@example.com", "jack", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, refreshToken, err := c.issueTokens(t.Context(), uid, &models.Client{UserAgent: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moderator, err := c.Database.InsertUser(t.Context(), "mod@example.com", "mod", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GrantRole(t.Context(), uuid.Nil, moderator, models.ROLE_MODERATOR); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SuspendUser(t.Context(), moderator, moderator); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("suspending yourself: got %v, want %v", err, ErrForbidden)
+	}
+
+	if err := c.SuspendUser(t.Context(), uid, moderator); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("suspending a moderator without being admin: got %v, want %v", err, ErrForbidden)
+	}
+
+	if err := c.SuspendUser(t.Context(), moderator, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isRevoked(t, &c, accessToken) {
+		t.Fatal("expected access token of suspended user to be revoked")
+	}
+
+	if _, _, err := c.RefreshToken(t.Context(), refreshToken, nil); !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("refresh: got %v, want %v", err, ErrUserSuspended)
+	}
+
+	if _, _, err := c.issueTokens(t.Context(), uid, nil); !errors.Is(err, ErrUserSuspended) {
+		t.Fatalf("login: got %v, want %v", err, ErrUserSuspended)
+	}
+
+	if err := c.UnsuspendUser(t.Context(), moderator, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.issueTokens(t.Context(), uid, nil); err != nil {
+		t.Fatalf("login after unsuspending: %v", err)
+	}
+
+	// a suspension an admin put on staff can only be lifted by an admin
+	admin, err := c.Database.InsertUser(t.Context(), "admin@example.com", "admin", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GrantRole(t.Context(), uuid.Nil, admin, models.ROLE_ADMIN); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := c.Database.InsertUser(t.Context(), "mod2@example.com", "mod2", "google", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GrantRole(t.Context(), uuid.Nil, other, models.ROLE_MODERATOR); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SuspendUser(t.Context(), admin, moderator); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UnsuspendUser(t.Context(), other, moderator); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unsuspending a moderator without being admin: got %v, want %v", err, ErrForbidden)
+	}
+
+	if err := c.UnsuspendUser(t.Context(), moderator, moderator); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unsuspending yourself: got %v, want %v", err, ErrForbidden)
+	}
+
+	if err := c.UnsuspendUser(t.Context(), admin, moderator); err != nil {
+		t.Fatal(err)
+	}
+}
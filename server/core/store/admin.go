@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// GetAnyListing returns a listing for moderation, drafts of other users included.
+func (c *CoreStoreContext) GetAnyListing(ctx context.Context, productID uuid.UUID) (product models.ProductInfo, err error) {
+	owner, err := c.Database.GetListingOwner(ctx, productID)
+	if err != nil {
+		return product, err
+	}
+
+	return c.GetListingByid(ctx, owner, productID)
+}
+
+// RemoveListing deletes a listing of any user, moderatorID is who removed it.
+func (c *CoreStoreContext) RemoveListing(ctx context.Context, moderatorID, productID uuid.UUID) (err error) {
+	owner, err := c.Database.GetListingOwner(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	err = c.Database.DeleteListing(ctx, owner, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to remove listing %s: %v", productID, err))
+		return err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Moderator %s removed listing %s of user %s", moderatorID, productID, owner))
+	return nil
+}
+
+func (c *CoreStoreContext) GetPlatformStats(ctx context.Context) (stats models.PlatformStats, err error) {
+	stats, err = c.Database.GetPlatformStats(ctx)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get platform stats: %v", err))
+		return stats, err
+	}
+
+	return stats, nil
+}
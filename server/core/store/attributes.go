@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,99}$`)
+
+const maxAttributeLength = 255
+
+// validateAttributes checks the attributes of a listing against the schema of its category.
+// Listings can only be put in categories of the managed tree, a typo would otherwise create a
+// category no filter ever finds.
+func (c *CoreStoreContext) validateAttributes(ctx context.Context, category string, attributes map[string]any) (values []models.ProductAttribute, err error) {
+	schema, exists, err := c.Database.GetCategorySchema(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("unknown category '%s'", category)
+	}
+
+	definitions := make(map[string]models.CategoryAttribute, len(schema))
+	for _, a := range schema {
+		definitions[a.Key] = a
+	}
+
+	values = make([]models.ProductAttribute, 0, len(attributes))
+	seen := make(map[string]bool, len(attributes))
+	for key, raw := range attributes {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !attributeKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid attribute key '%s'", key)
+		}
+
+		if seen[key] {
+			return nil, fmt.Errorf("attribute '%s' is set more than once", key)
+		}
+		seen[key] = true
+
+		definition, ok := definitions[key]
+		if !ok {
+			return nil, fmt.Errorf("attribute '%s' is not defined for category '%s'", key, category)
+		}
+
+		value, err := parseAttributeValue(key, definition.Type, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	for _, a := range schema {
+		if a.Required && !seen[a.Key] {
+			return nil, fmt.Errorf("missing required attribute '%s' for category '%s'", a.Key, category)
+		}
+	}
+
+	return values, nil
+}
+
+func parseAttributeValue(key, valueType string, raw any) (value models.ProductAttribute, err error) {
+	value = models.ProductAttribute{Key: key, Type: valueType}
+
+	// attributes read back from the database hold their numbers as json.Number
+	if n, ok := raw.(json.Number); ok {
+		raw = n.String()
+	}
+
+	switch valueType {
+	case models.ATTRIBUTE_TYPE_NUMBER:
+		var d decimal.Decimal
+		switch v := raw.(type) {
+		case float64:
+			d = decimal.NewFromFloat(v)
+		case string:
+			d, err = decimal.NewFromString(strings.TrimSpace(v))
+			if err != nil {
+				return value, fmt.Errorf("attribute '%s' must be a number", key)
+			}
+		default:
+			return value, fmt.Errorf("attribute '%s' must be a number", key)
+		}
+		value.Text = d.String()
+		value.Number = &d
+
+	case models.ATTRIBUTE_TYPE_BOOLEAN:
+		var b bool
+		switch v := raw.(type) {
+		case bool:
+			b = v
+		case string:
+			b, err = strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return value, fmt.Errorf("attribute '%s' must be a boolean", key)
+			}
+		default:
+			return value, fmt.Errorf("attribute '%s' must be a boolean", key)
+		}
+		value.Text = strconv.FormatBool(b)
+
+	default:
+		switch v := raw.(type) {
+		case string:
+			value.Text = strings.TrimSpace(v)
+		case float64:
+			value.Text = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			value.Text = strconv.FormatBool(v)
+		default:
+			return value, fmt.Errorf("attribute '%s' must be a string", key)
+		}
+
+		if value.Text == "" || len(value.Text) > maxAttributeLength {
+			return value, fmt.Errorf("attribute '%s' must be between 1 and %d characters", key, maxAttributeLength)
+		}
+	}
+
+	return value, nil
+}
+
+// parseAttributeFilters turns attr.<key>[_gt|_gte|_lt|_lte] query parameters, with the
+// attr. prefix already stripped, into filters. The result is sorted by key so the same
+// query always produces the same SQL.
+func parseAttributeFilters(raw map[string][]string) (filters []models.AttributeFilter, err error) {
+	suffixes := []string{models.FILTER_GTE, models.FILTER_LTE, models.FILTER_GT, models.FILTER_LT}
+
+	for name, values := range raw {
+		filter := models.AttributeFilter{Key: strings.ToLower(name), Op: models.FILTER_EQ}
+		for _, op := range suffixes {
+			if key, ok := strings.CutSuffix(filter.Key, "_"+op); ok {
+				filter.Key, filter.Op = key, op
+				break
+			}
+		}
+
+		if !attributeKeyPattern.MatchString(filter.Key) {
+			return nil, fmt.Errorf("invalid attribute filter '%s'", name)
+		}
+
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				filter.Values = append(filter.Values, v)
+			}
+		}
+
+		if len(filter.Values) == 0 {
+			return nil, fmt.Errorf("missing value for attribute filter '%s'", name)
+		}
+
+		if filter.Op != models.FILTER_EQ {
+			if len(filter.Values) > 1 {
+				return nil, fmt.Errorf("attribute filter '%s' accepts a single value", name)
+			}
+
+			d, err := decimal.NewFromString(filter.Values[0])
+			if err != nil {
+				return nil, fmt.Errorf("attribute filter '%s' must be a number", name)
+			}
+			filter.Values[0] = d.String()
+		}
+
+		filters = append(filters, filter)
+	}
+
+	sort.Slice(filters, func(i, j int) bool {
+		if filters[i].Key != filters[j].Key {
+			return filters[i].Key < filters[j].Key
+		}
+		return filters[i].Op < filters[j].Op
+	})
+
+	return filters, nil
+}
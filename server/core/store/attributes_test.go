@@ -0,0 +1,201 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseAttributeFilters(t *testing.T) {
+	filters, err := parseAttributeFilters(map[string][]string{
+		"brand":    {"Rolex", "Omega"},
+		"year_gte": {"2010"},
+		"year_lt":  {"2020.50"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.AttributeFilter{
+		{Key: "brand", Op: models.FILTER_EQ, Values: []string{"Rolex", "Omega"}},
+		{Key: "year", Op: models.FILTER_GTE, Values: []string{"2010"}},
+		{Key: "year", Op: models.FILTER_LT, Values: []string{"2020.5"}},
+	}
+
+	if len(filters) != len(want) {
+		t.Fatalf("got %d filters, want %d", len(filters), len(want))
+	}
+
+	for i := range want {
+		if filters[i].Key != want[i].Key || filters[i].Op != want[i].Op || len(filters[i].Values) != len(want[i].Values) || filters[i].Values[0] != want[i].Values[0] {
+			t.Errorf("filter %d = %+v, want %+v", i, filters[i], want[i])
+		}
+	}
+
+	tests := []map[string][]string{
+		{"year_gte": {"twenty ten"}},
+		{"year_gte": {"2010", "2011"}},
+		{"brand": {""}},
+		{"Brand'; --": {"Rolex"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseAttributeFilters(tt); err == nil {
+			t.Errorf("parseAttributeFilters(%v) did not return an error", tt)
+		}
+	}
+}
+
+func TestParseAttributeValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		raw       any
+		want      string
+		wantErr   bool
+	}{
+		{name: "number from json", valueType: models.ATTRIBUTE_TYPE_NUMBER, raw: 2010.0, want: "2010"},
+		{name: "number from string", valueType: models.ATTRIBUTE_TYPE_NUMBER, raw: " 1.50 ", want: "1.5"},
+		{name: "invalid number", valueType: models.ATTRIBUTE_TYPE_NUMBER, raw: "old", wantErr: true},
+		{name: "boolean", valueType: models.ATTRIBUTE_TYPE_BOOLEAN, raw: true, want: "true"},
+		{name: "boolean from string", valueType: models.ATTRIBUTE_TYPE_BOOLEAN, raw: "false", want: "false"},
+		{name: "invalid boolean", valueType: models.ATTRIBUTE_TYPE_BOOLEAN, raw: 1.0, wantErr: true},
+		{name: "string", valueType: models.ATTRIBUTE_TYPE_STRING, raw: " Rolex ", want: "Rolex"},
+		{name: "string from number", valueType: models.ATTRIBUTE_TYPE_STRING, raw: 42.0, want: "42"},
+		{name: "empty string", valueType: models.ATTRIBUTE_TYPE_STRING, raw: " ", wantErr: true},
+		{name: "nested object", valueType: models.ATTRIBUTE_TYPE_STRING, raw: map[string]any{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAttributeValue("key", tt.valueType, tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAttributeValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && got.Text != tt.want {
+				t.Errorf("parseAttributeValue() = %q, want %q", got.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNewListingValidatesAttributes(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string]any
+		wantErr    bool
+	}{
+		{name: "valid", attributes: map[string]any{"brand": "Rolex", "year": 2010.0}},
+		{name: "missing required brand", attributes: map[string]any{"year": 2010.0}, wantErr: true},
+		{name: "wrong type", attributes: map[string]any{"brand": "Rolex", "year": "old"}, wantErr: true},
+		{name: "unknown attribute", attributes: map[string]any{"brand": "Rolex", "colour": "gold"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.CreateNewListing(t.Context(), uid, &models.Product{
+				ItemName:   "submariner",
+				Category:   "Watches",
+				Price:      decimal.NewFromInt(9000),
+				Attributes: tt.attributes,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateNewListing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	prods, err := c.GetListings(t.Context(), uid, "accessories", "", "", "", "", map[string][]string{"brand": {"rolex"}, "year_gte": {"2005"}}, false, 40, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 1 || prods[0].Attributes["brand"] != "Rolex" {
+		t.Fatalf("attribute filters returned %+v", prods)
+	}
+
+	prods, err = c.GetListings(t.Context(), uid, "", "", "", "", "", map[string][]string{"year_gt": {"2010"}}, false, 40, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 0 {
+		t.Fatalf("expected no listings newer than 2010, got %d", len(prods))
+	}
+}
+
+func TestUpdateProductValidatesAttributes(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{
+		ItemName:   "submariner",
+		Category:   "collectibles",
+		Price:      decimal.NewFromInt(9000),
+		Attributes: map[string]any{"year": 2010.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateProduct(t.Context(), uid, &models.UpdateProduct{Id: pid, Category: "watches"}); err == nil {
+		t.Fatal("moved a listing into a category without its required attributes")
+	}
+
+	if err := c.UpdateProduct(t.Context(), uid, &models.UpdateProduct{Id: pid, Attributes: map[string]any{"year": "old"}}); err == nil {
+		t.Fatal("set an attribute of the wrong type")
+	}
+
+	err = c.UpdateProduct(t.Context(), uid, &models.UpdateProduct{Id: pid, Category: "watches", Attributes: map[string]any{"brand": "Rolex", "year": 2010.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prods, err := c.GetListings(t.Context(), uid, "accessories", "", "", "", "", map[string][]string{"brand": {"rolex"}, "year_gte": {"2005"}}, false, 40, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 1 || prods[0].ItemID != pid {
+		t.Fatalf("attribute filters returned %+v after moving the listing", prods)
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"image/color"
 	"os"
 	"testing"
 
@@ -38,16 +39,16 @@ func TestCreateNewBid(t *testing.T) {
 
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "products",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image: "wlieblwelkjhe",
+				Image: testutils.Base64PNG(2, 2, color.White),
 				Order: 0,
 			},
 			{
-				Image: "sdvsrtvs",
+				Image: testutils.Base64PNG(2, 2, color.Black),
 				Order: 1,
 			},
 		},
@@ -109,16 +110,16 @@ func TestGetHighestBid(t *testing.T) {
 
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "products",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image: "wlieblwelkjhe",
+				Image: testutils.Base64PNG(2, 2, color.White),
 				Order: 0,
 			},
 			{
-				Image: "sdvsrtvs",
+				Image: testutils.Base64PNG(2, 2, color.Black),
 				Order: 1,
 			},
 		},
@@ -196,21 +197,21 @@ func TestGetBids(t *testing.T) {
 
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "products",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    testutils.Base64PNG(2, 2, color.White),
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    testutils.Base64PNG(2, 2, color.Black),
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gopher93185789/luxora/server/pkg/blob"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+const (
+	BLOB_URL_EXPIRY      = 1 * time.Hour
+	BLOB_DELETION_BATCH  = 100
+	BLOB_MIGRATION_BATCH = 50
+)
+
+var blobSizes = []string{imaging.SIZE_FULL, imaging.SIZE_MEDIUM, imaging.SIZE_THUMB}
+
+// blobKey is the key an image rendition is stored under. Images are shared by checksum, so every
+// listing using the same image uses the same keys.
+func blobKey(checksum, size string) string {
+	return "images/" + checksum + "/" + size
+}
+
+// putImageBlobs writes an image and its renditions to the blob store and drops their bytes, so
+// only the metadata ends up in the database. Without a blob store the image is left untouched.
+func (c *CoreStoreContext) putImageBlobs(ctx context.Context, image *models.ProductImage) (err error) {
+	if c.Blobs == nil || image.Data == nil {
+		return nil
+	}
+
+	for i := range image.Renditions {
+		r := &image.Renditions[i]
+		err = c.Blobs.Put(ctx, blobKey(image.Checksum, r.Size), bytes.NewReader(r.Data), int64(len(r.Data)), r.ContentType)
+		if err != nil {
+			return err
+		}
+		r.Data = nil
+	}
+
+	err = c.Blobs.Put(ctx, blobKey(image.Checksum, imaging.SIZE_FULL), bytes.NewReader(image.Data), int64(len(image.Data)), image.ContentType)
+	if err != nil {
+		return err
+	}
+
+	image.Data = nil
+	return nil
+}
+
+// storeImageBlobs puts images in the blob store, claiming their checksums first so the blobs are not
+// deleted before the database references them. release has to be called once the images are stored
+// in the database or not, blobs of images the database never stored are then queued for deletion.
+func (c *CoreStoreContext) storeImageBlobs(ctx context.Context, images ...*models.ProductImage) (release func(), err error) {
+	if c.Blobs == nil {
+		return func() {}, nil
+	}
+
+	checksums := make([]string, 0, len(images))
+	for _, image := range images {
+		checksums = append(checksums, image.Checksum)
+	}
+
+	uploadID, err := c.Database.ClaimBlobUpload(ctx, checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	release = func() {
+		if err := c.Database.ReleaseBlobUpload(context.WithoutCancel(ctx), uploadID); err != nil {
+			c.Logger.Error(fmt.Sprintf("Failed to release upload %s, its blobs stay claimed until it expires: %v", uploadID, err))
+		}
+	}
+
+	for _, image := range images {
+		if err = c.putImageBlobs(ctx, image); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+// getImageBlob fills in an image whose bytes live in the blob store, with a presigned URL when the
+// store hands those out and with the bytes otherwise.
+func (c *CoreStoreContext) getImageBlob(ctx context.Context, image *models.ProductImage) (err error) {
+	if c.Blobs == nil {
+		return fmt.Errorf("image %s is kept in a blob store but none is configured", image.ID)
+	}
+
+	key := blobKey(image.Checksum, image.Size)
+	image.BlobURL, err = c.Blobs.PresignedURL(ctx, key, BLOB_URL_EXPIRY)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, blob.ErrPresignNotSupported) {
+		return err
+	}
+
+	body, _, err := c.Blobs.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	image.Data, err = io.ReadAll(body)
+	return err
+}
+
+// WatchBlobDeletions removes blobs from the blob store once the database no longer references them.
+// It checks every interval until ctx is cancelled.
+func (c *CoreStoreContext) WatchBlobDeletions(ctx context.Context, interval time.Duration) {
+	if c.Blobs == nil {
+		return
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				deleted, err := c.DeleteUnusedBlobs(ctx)
+				if err != nil {
+					c.Logger.Error(fmt.Sprintf("Failed to delete unused blobs: %v", err))
+					continue
+				}
+
+				if deleted > 0 {
+					c.Logger.Info(fmt.Sprintf("Deleted %d unused images from the blob store", deleted))
+				}
+			}
+		}
+	}()
+}
+
+// DeleteUnusedBlobs deletes a batch of queued blobs from the blob store and returns how many were deleted.
+func (c *CoreStoreContext) DeleteUnusedBlobs(ctx context.Context) (deleted int, err error) {
+	checksums, err := c.Database.GetBlobDeletions(ctx, BLOB_DELETION_BATCH)
+	if err != nil || len(checksums) == 0 {
+		return 0, err
+	}
+
+	for _, checksum := range checksums {
+		// the database decides whether the blobs can go, and keeps them from being uploaded again
+		// while they are deleted
+		var removed bool
+		removed, err = c.Database.DeleteBlobDeletion(ctx, checksum, func() error {
+			return c.deleteImageBlobs(ctx, checksum)
+		})
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("Failed to delete blobs of image %s: %v", checksum, err))
+			continue
+		}
+
+		if removed {
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (c *CoreStoreContext) deleteImageBlobs(ctx context.Context, checksum string) (err error) {
+	for _, size := range blobSizes {
+		if err = c.Blobs.Delete(ctx, blobKey(checksum, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateBlobs moves every image still stored in Postgres into the blob store. It can be stopped
+// and run again, images are only dropped from the database once they have been written out.
+func (c *CoreStoreContext) MigrateBlobs(ctx context.Context) (migrated int, err error) {
+	if c.Blobs == nil {
+		return 0, fmt.Errorf("no blob store configured")
+	}
+
+	moved, err := c.Database.MoveInlineProductImages(ctx)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to move inline product images: %v", err))
+		return 0, err
+	}
+	c.Logger.Info(fmt.Sprintf("Moved %d inline product images into shared blobs", moved))
+
+	for {
+		images, err := c.Database.GetInlineImageBlobs(ctx, BLOB_MIGRATION_BATCH)
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("Failed to get images to migrate: %v", err))
+			return migrated, err
+		}
+
+		if len(images) == 0 {
+			return migrated, nil
+		}
+
+		for i := range images {
+			image := &images[i]
+			if image.ContentType == "" {
+				image.Data, err = decodeLegacyImage(image.Data)
+				if err != nil {
+					c.Logger.Error(fmt.Sprintf("Failed to decode legacy image %s: %v", image.Checksum, err))
+					return migrated, err
+				}
+				image.ContentType = http.DetectContentType(image.Data)
+			}
+
+			release, err := c.storeImageBlobs(ctx, image)
+			if err != nil {
+				c.Logger.Error(fmt.Sprintf("Failed to write image %s to the blob store: %v", image.Checksum, err))
+				return migrated, err
+			}
+
+			err = c.Database.UpdateImageBlobExternal(ctx, image.Checksum, image.ContentType)
+			release()
+			if err != nil {
+				c.Logger.Error(fmt.Sprintf("Failed to mark image %s as migrated: %v", image.Checksum, err))
+				return migrated, err
+			}
+			migrated++
+		}
+
+		c.Logger.Info(fmt.Sprintf("Migrated %d images to the blob store", migrated))
+	}
+}
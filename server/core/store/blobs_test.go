@@ -0,0 +1,331 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/pkg/blob"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/shopspring/decimal"
+)
+
+func TestBlobStoreImages(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	blobs, err := blob.NewFileSystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+		Blobs:  blobs,
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "test item", Category: "collectibles", Price: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(testutils.PNG(400, 300, color.White)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inline int
+	err = conn.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_blob WHERE compressed_image IS NOT NULL").Scan(&inline)
+	if err != nil || inline != 0 {
+		t.Fatalf("expected no image bytes in postgres, found %d (%v)", inline, err)
+	}
+
+	for _, size := range []string{imaging.SIZE_FULL, imaging.SIZE_THUMB} {
+		image, err := c.GetImage(t.Context(), uploaded.ID, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Size != size || len(image.Data) == 0 || image.ContentType != imaging.CONTENT_PNG {
+			t.Fatalf("unexpected %s image: size %s, %d bytes of %s", size, image.Size, len(image.Data), image.ContentType)
+		}
+	}
+
+	full, err := c.GetImage(t.Context(), uploaded.ID, imaging.SIZE_FULL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteListing(t.Context(), uid, pid); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := c.DeleteUnusedBlobs(t.Context())
+	if err != nil || deleted != 1 {
+		t.Fatalf("deleted %d blobs, want 1 (%v)", deleted, err)
+	}
+
+	if _, err := blobs.Stat(t.Context(), blobKey(full.Checksum, imaging.SIZE_FULL)); !errors.Is(err, blob.ErrNotFound) {
+		t.Fatalf("expected the blob to be deleted, got %v", err)
+	}
+
+	if deleted, err := c.DeleteUnusedBlobs(t.Context()); err != nil || deleted != 0 {
+		t.Fatalf("expected the deletion queue to be empty, deleted %d (%v)", deleted, err)
+	}
+}
+
+func TestBlobDeletionWaitsForUploads(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	blobs, err := blob.NewFileSystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+		Blobs:  blobs,
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "test item", Category: "collectibles", Price: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := testutils.PNG(40, 30, color.White)
+	uploaded, err := c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the image is queued for deletion, then uploaded again before the queue is worked off
+	if err := c.DeleteListingImage(t.Context(), uid, pid, uploaded.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := newProductImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := c.storeImageBlobs(t.Context(), &image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted, err := c.DeleteUnusedBlobs(t.Context()); err != nil || deleted != 0 {
+		t.Fatalf("deleted %d blobs of an upload in progress (%v)", deleted, err)
+	}
+
+	if _, _, err := c.Database.InsertProductImage(t.Context(), uid, pid, &image); err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if deleted, err := c.DeleteUnusedBlobs(t.Context()); err != nil || deleted != 0 {
+		t.Fatalf("deleted %d blobs of a stored image (%v)", deleted, err)
+	}
+
+	if _, err := blobs.Stat(t.Context(), blobKey(image.Checksum, imaging.SIZE_FULL)); err != nil {
+		t.Fatalf("expected the blob to be kept, got %v", err)
+	}
+
+	// an upload whose image is never stored leaves its blobs to be deleted
+	other, err := newProductImage(testutils.PNG(40, 30, color.Black))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err = c.storeImageBlobs(t.Context(), &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if deleted, err := c.DeleteUnusedBlobs(t.Context()); err != nil || deleted != 1 {
+		t.Fatalf("deleted %d blobs, want 1 (%v)", deleted, err)
+	}
+
+	if _, err := blobs.Stat(t.Context(), blobKey(other.Checksum, imaging.SIZE_FULL)); !errors.Is(err, blob.ErrNotFound) {
+		t.Fatalf("expected the blob to be deleted, got %v", err)
+	}
+}
+
+// failingInsertDatabase knows every category and no image, and fails to insert listings. Released
+// uploads are queued for deletion, since no image they put was ever stored.
+type failingInsertDatabase struct {
+	database.Database
+	claimed map[uuid.UUID][]string
+	queued  []string
+}
+
+func (failingInsertDatabase) GetCategorySchema(ctx context.Context, slug string) ([]models.CategoryAttribute, bool, error) {
+	return []models.CategoryAttribute{}, true, nil
+}
+
+func (failingInsertDatabase) InsertListing(ctx context.Context, userId uuid.UUID, product *models.Product) (uuid.UUID, error) {
+	return uuid.Nil, errors.New("insert failed")
+}
+
+func (db *failingInsertDatabase) ClaimBlobUpload(ctx context.Context, checksums []string) (uuid.UUID, error) {
+	id := uuid.New()
+	db.claimed[id] = checksums
+	return id, nil
+}
+
+func (db *failingInsertDatabase) ReleaseBlobUpload(ctx context.Context, uploadID uuid.UUID) error {
+	db.queued = append(db.queued, db.claimed[uploadID]...)
+	delete(db.claimed, uploadID)
+	return nil
+}
+
+func (db *failingInsertDatabase) GetBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	return db.queued, nil
+}
+
+func (db *failingInsertDatabase) DeleteBlobDeletion(ctx context.Context, checksum string, remove func() error) (bool, error) {
+	return true, remove()
+}
+
+func TestCreateNewListingDiscardsBlobs(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := blob.NewFileSystem(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &failingInsertDatabase{claimed: map[uuid.UUID][]string{}}
+	c := &CoreStoreContext{
+		Database: db,
+		Logger:   logger.New(os.Stdout),
+		Blobs:    blobs,
+	}
+
+	_, err = c.CreateNewListing(t.Context(), uuid.New(), &models.Product{
+		ItemName: "test item",
+		Category: "collectibles",
+		Price:    decimal.NewFromInt(100),
+		Images: []models.ProductImage{
+			{Image: testutils.Base64PNG(2, 2, color.White), Order: 0},
+			{Image: testutils.Base64PNG(2, 2, color.Black), Order: 1},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected the listing insert to fail")
+	}
+
+	if len(db.claimed) != 0 || len(db.queued) != 2 {
+		t.Fatalf("expected both images to be released and queued, %d uploads claimed and %d queued", len(db.claimed), len(db.queued))
+	}
+
+	deleted, err := c.DeleteUnusedBlobs(t.Context())
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleted %d blobs, want 2 (%v)", deleted, err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("blob %s was left in the store", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateBlobs(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	if _, err := c.MigrateBlobs(t.Context()); err == nil {
+		t.Fatal("expected migrating without a blob store to fail")
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "test item", Category: "collectibles", Price: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(testutils.PNG(3, 3, color.White)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := c.GetImage(t.Context(), uploaded.ID, imaging.SIZE_FULL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Blobs, err = blob.NewFileSystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := c.MigrateBlobs(t.Context())
+	if err != nil || migrated != 1 {
+		t.Fatalf("migrated %d images, want 1 (%v)", migrated, err)
+	}
+
+	if migrated, err := c.MigrateBlobs(t.Context()); err != nil || migrated != 0 {
+		t.Fatalf("expected a second migration to be a no-op, migrated %d (%v)", migrated, err)
+	}
+
+	after, err := c.GetImage(t.Context(), uploaded.ID, imaging.SIZE_FULL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(before.Data, after.Data) || before.ContentType != after.ContentType {
+		t.Fatal("image changed while migrating it to the blob store")
+	}
+}
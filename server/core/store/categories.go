@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// NormalizeCategory turns a free-text category into its slug form so that
+// "Watches", "watches " and "WATCHES" all end up as the same category.
+func NormalizeCategory(category string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(category), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-' || r == '\t'
+	}), "-")
+}
+
+func (c *CoreStoreContext) GetCategoryTree(ctx context.Context) (tree []models.Category, err error) {
+	c.Logger.Debug("Fetching category tree")
+	categories, err := c.Database.GetCategories(ctx)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get categories: %v", err))
+		return nil, err
+	}
+
+	children := map[uuid.UUID][]models.Category{}
+	tree = []models.Category{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			tree = append(tree, category)
+			continue
+		}
+		children[*category.ParentID] = append(children[*category.ParentID], category)
+	}
+
+	for i := range tree {
+		attachChildren(&tree[i], children)
+	}
+
+	return tree, nil
+}
+
+// attachChildren builds the subtree below category and rolls the listing counts of
+// the children up into their parent.
+func attachChildren(category *models.Category, children map[uuid.UUID][]models.Category) {
+	category.Children = children[category.ID]
+	if category.Children == nil {
+		category.Children = []models.Category{}
+	}
+
+	for i := range category.Children {
+		attachChildren(&category.Children[i], children)
+		category.ListingCount += category.Children[i].ListingCount
+	}
+}
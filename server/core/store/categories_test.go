@@ -0,0 +1,116 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/shopspring/decimal"
+)
+
+func TestNormalizeCategory(t *testing.T) {
+	tests := map[string]string{
+		"Watches":           "watches",
+		"  watches ":        "watches",
+		"Fine   Jewellery":  "fine-jewellery",
+		"fine_jewellery":    "fine-jewellery",
+		"Fine - Jewellery ": "fine-jewellery",
+		"":                  "",
+	}
+
+	for in, want := range tests {
+		if got := NormalizeCategory(in); got != want {
+			t.Errorf("NormalizeCategory(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGetCategoryTree(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, category := range []string{"Watches", "jewellery", "accessories"} {
+		_, err := c.CreateNewListing(t.Context(), uid, &models.Product{
+			ItemName:   "rizz",
+			Category:   category,
+			Price:      decimal.NewFromInt(10),
+			Attributes: map[string]any{"brand": "Rolex"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree, err := c.GetCategoryTree(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range tree {
+		if root.Slug != "accessories" {
+			continue
+		}
+
+		if root.ListingCount != 3 {
+			t.Fatalf("got %d listings under accessories, want 3", root.ListingCount)
+		}
+
+		if len(root.Children) == 0 {
+			t.Fatal("accessories has no children")
+		}
+		return
+	}
+
+	t.Fatal("accessories category missing from tree")
+}
+
+func TestListingCategoryMustExist(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "rizz", Category: "Wacthes", Price: decimal.NewFromInt(10)}); err == nil {
+		t.Fatal("created a listing in an unknown category")
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "rizz", Category: "Collectibles", Price: decimal.NewFromInt(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateProduct(t.Context(), uid, &models.UpdateProduct{Id: pid, Category: "Wacthes"}); err == nil {
+		t.Fatal("moved a listing into an unknown category")
+	}
+}
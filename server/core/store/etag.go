@@ -0,0 +1,24 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// ListingETag is a strong validator for the JSON of the given listings. It is derived from what
+// versions a listing rather than from the JSON itself: the time the listing was last updated, the
+// current price row and the checksums of its images, so it changes whenever the JSON can.
+func ListingETag(products ...models.ProductInfo) string {
+	h := sha256.New()
+	for _, p := range products {
+		fmt.Fprintf(h, "%s|%d|%d|%s|%s|%s\n", p.ItemID, p.UpdatedAt.UnixNano(), p.PriceUpdatedAt.UnixNano(), p.Price, p.Currency, p.CreatedBy)
+		for _, image := range p.Images {
+			fmt.Fprintf(h, "%s|%d|%s\n", image.ID, image.Order, image.Checksum)
+		}
+	}
+
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:18]) + `"`
+}
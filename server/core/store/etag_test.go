@@ -0,0 +1,65 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestListingETag(t *testing.T) {
+	now := time.Now()
+	newProduct := func() models.ProductInfo {
+		return models.ProductInfo{
+			ItemID:         uuid.MustParse("0c8a6a5e-59a4-4b65-9c3a-5a3f2b1e0d11"),
+			CreatedBy:      "jack",
+			Price:          decimal.NewFromInt(100),
+			Currency:       "EUR",
+			UpdatedAt:      now,
+			PriceUpdatedAt: now,
+			Images: []models.ProductImage{
+				{ID: uuid.MustParse("6f2d4b1e-0a7c-4c1f-8e2b-3d9a1c5e7f20"), Order: 1, Checksum: "a"},
+				{ID: uuid.MustParse("9b1e3c5a-7d2f-4e8b-a6c4-1f0d2e3b4a59"), Order: 2, Checksum: "b"},
+			},
+		}
+	}
+
+	etag := ListingETag(newProduct())
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		t.Fatalf("etag %s is not a quoted strong etag", etag)
+	}
+
+	if etag != ListingETag(newProduct()) {
+		t.Fatal("expected the same listing to get the same etag")
+	}
+
+	// filling in image urls does not change the version of a listing
+	product := newProduct()
+	setImageURLs(product.Images)
+	if etag != ListingETag(product) {
+		t.Fatal("expected image urls not to change the etag")
+	}
+
+	changes := map[string]func(p *models.ProductInfo){
+		"updated":       func(p *models.ProductInfo) { p.UpdatedAt = now.Add(time.Microsecond) },
+		"price":         func(p *models.ProductInfo) { p.PriceUpdatedAt = now.Add(time.Microsecond) },
+		"image content": func(p *models.ProductInfo) { p.Images[0].Checksum = "c" },
+		"image order":   func(p *models.ProductInfo) { p.Images[0].Order, p.Images[1].Order = 2, 1 },
+		"image removed": func(p *models.ProductInfo) { p.Images = p.Images[:1] },
+	}
+
+	for name, change := range changes {
+		product := newProduct()
+		change(&product)
+		if ListingETag(product) == etag {
+			t.Errorf("%s: expected the etag to change", name)
+		}
+	}
+
+	if ListingETag(newProduct(), newProduct()) == etag {
+		t.Fatal("expected a page of listings to get its own etag")
+	}
+}
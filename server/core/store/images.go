@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// ImageURL is the path GetImage is served on, listing responses link to images through it.
+// An empty size links to the full size image.
+func ImageURL(imageID uuid.UUID, size string) string {
+	if size == "" || size == imaging.SIZE_FULL {
+		return "/images/" + imageID.String()
+	}
+	return "/images/" + imageID.String() + "?size=" + size
+}
+
+func setImageURL(image *models.ProductImage) {
+	image.URL = ImageURL(image.ID, imaging.SIZE_FULL)
+	image.MediumURL = ImageURL(image.ID, imaging.SIZE_MEDIUM)
+	image.ThumbnailURL = ImageURL(image.ID, imaging.SIZE_THUMB)
+}
+
+func setImageURLs(images []models.ProductImage) {
+	for i := range images {
+		setImageURL(&images[i])
+	}
+}
+
+// newProductImage validates an uploaded image and re-encodes it into its renditions.
+// The checksum is taken over the re-encoded full size image, which is what gets stored and served.
+func newProductImage(data []byte) (image models.ProductImage, err error) {
+	renditions, err := imaging.Process(data)
+	if err != nil {
+		return image, err
+	}
+
+	for _, r := range renditions {
+		if r.Size == imaging.SIZE_FULL {
+			image.Data = r.Data
+			image.ContentType = r.ContentType
+			continue
+		}
+
+		image.Renditions = append(image.Renditions, models.ImageRendition{
+			Size:        r.Size,
+			ContentType: r.ContentType,
+			Width:       r.Width,
+			Height:      r.Height,
+			Data:        r.Data,
+		})
+	}
+
+	hash := sha256.Sum256(image.Data)
+	image.Checksum = hex.EncodeToString(hash[:])
+	return image, nil
+}
+
+// decodeLegacyImage turns an image that was stored as zstd compressed base64 text back into raw bytes.
+func decodeLegacyImage(data []byte) ([]byte, error) {
+	decompressed, err := compression.DecompressZSTD(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(decompressed)))
+	if err != nil {
+		return decompressed, nil
+	}
+
+	return decoded, nil
+}
+
+// readProductImage reads a single uploaded image from r and stores its bytes in the blob store, if there is one.
+// release has to be called once the image is stored in the database or not.
+func (c *CoreStoreContext) readProductImage(ctx context.Context, productID uuid.UUID, r io.Reader) (image models.ProductImage, release func(), err error) {
+	data, err := io.ReadAll(io.LimitReader(r, imaging.MAX_BYTES+1))
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to read uploaded image: %v", err))
+		return image, nil, err
+	}
+
+	image, err = newProductImage(data)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Rejected image upload for listing %s: %v", productID, err))
+		return image, nil, err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Storing %d byte %s image for listing %s", len(data), image.ContentType, productID))
+	release, err = c.storeImageBlobs(ctx, &image)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to store image: %v", err))
+		return image, nil, err
+	}
+
+	return image, release, nil
+}
+
+// UploadListingImage reads a single image from r and appends it to a listing owned by userID.
+func (c *CoreStoreContext) UploadListingImage(ctx context.Context, userID, productID uuid.UUID, r io.Reader) (image models.ProductImage, err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for image upload")
+		return image, fmt.Errorf("invalid product id")
+	}
+
+	image, release, err := c.readProductImage(ctx, productID, r)
+	if err != nil {
+		return image, err
+	}
+	defer release()
+
+	image.ID, image.Order, err = c.Database.InsertProductImage(ctx, userID, productID, &image)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to insert image: %v", err))
+		return image, err
+	}
+
+	setImageURL(&image)
+	return image, nil
+}
+
+// ReplaceListingImage reads a single image from r and puts it in place of an image of a listing owned by userID.
+// The new image gets its own ID and URLs.
+func (c *CoreStoreContext) ReplaceListingImage(ctx context.Context, userID, productID, imageID uuid.UUID, r io.Reader) (image models.ProductImage, err error) {
+	if productID == uuid.Nil || imageID == uuid.Nil {
+		c.Logger.Error("Invalid product or image ID provided for image replacement")
+		return image, fmt.Errorf("invalid product or image id")
+	}
+
+	image, release, err := c.readProductImage(ctx, productID, r)
+	if err != nil {
+		return image, err
+	}
+	defer release()
+
+	c.Logger.Info(fmt.Sprintf("Replacing image %s of listing %s for user %s", imageID, productID, userID))
+	image.ID, image.Order, err = c.Database.ReplaceProductImage(ctx, userID, productID, imageID, &image)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to replace image: %v", err))
+		return image, err
+	}
+
+	setImageURL(&image)
+	return image, nil
+}
+
+func (c *CoreStoreContext) DeleteListingImage(ctx context.Context, userID, productID, imageID uuid.UUID) (err error) {
+	if productID == uuid.Nil || imageID == uuid.Nil {
+		c.Logger.Error("Invalid product or image ID provided for image deletion")
+		return fmt.Errorf("invalid product or image id")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Deleting image %s of listing %s for user %s", imageID, productID, userID))
+	err = c.Database.DeleteProductImage(ctx, userID, productID, imageID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to delete image: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// ReorderListingImages sets the order of the images of a listing owned by userID. Every image of
+// the listing has to be listed exactly once.
+func (c *CoreStoreContext) ReorderListingImages(ctx context.Context, userID, productID uuid.UUID, imageIDs []uuid.UUID) (err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for image reorder")
+		return fmt.Errorf("invalid product id")
+	}
+
+	if len(imageIDs) == 0 {
+		c.Logger.Error("No image IDs provided for image reorder")
+		return fmt.Errorf("image_ids is required")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Reordering %d images of listing %s for user %s", len(imageIDs), productID, userID))
+	err = c.Database.UpdateImageOrder(ctx, userID, productID, imageIDs)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to reorder images: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// GetImage returns an image in the given rendition size, an empty size returns the full size image.
+// Images in a blob store that hands out URLs come back with BlobURL set and without data.
+func (c *CoreStoreContext) GetImage(ctx context.Context, imageID uuid.UUID, size string) (image models.ProductImage, err error) {
+	if size == "" {
+		size = imaging.SIZE_FULL
+	}
+
+	if !imaging.IsSize(size) {
+		return image, fmt.Errorf("invalid image size '%s'", size)
+	}
+
+	image, err = c.Database.GetImage(ctx, imageID, size)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get image %s: %v", imageID, err))
+		return image, err
+	}
+
+	if image.Data == nil {
+		if err = c.getImageBlob(ctx, &image); err != nil {
+			c.Logger.Error(fmt.Sprintf("Failed to get image %s from the blob store: %v", imageID, err))
+			return image, err
+		}
+
+		if image.BlobURL != "" {
+			return image, nil
+		}
+	}
+
+	if image.ContentType == "" {
+		image.Data, err = decodeLegacyImage(image.Data)
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("Failed to decode legacy image %s: %v", imageID, err))
+			return image, err
+		}
+		image.ContentType = http.DetectContentType(image.Data)
+	}
+
+	if image.Checksum == "" {
+		hash := sha256.Sum256(image.Data)
+		image.Checksum = hex.EncodeToString(hash[:])
+	}
+
+	return image, nil
+}
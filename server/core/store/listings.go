@@ -2,12 +2,11 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
-	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/shopspring/decimal"
 )
@@ -23,18 +22,77 @@ func (c *CoreStoreContext) CreateNewListing(ctx context.Context, userID uuid.UUI
 		return uuid.Nil, err
 	}
 
+	product.Category = NormalizeCategory(product.Category)
+	if product.Category == "" {
+		c.Logger.Error("Failed to create listing: empty category")
+		return uuid.Nil, fmt.Errorf("invalid product category")
+	}
+
+	product.AttributeValues, err = c.validateAttributes(ctx, product.Category, product.Attributes)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to create listing: invalid attributes - %v", err))
+		return uuid.Nil, err
+	}
+
+	product.Condition, err = normalizeCondition(product.Condition)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to create listing: %v", err))
+		return uuid.Nil, err
+	}
+
+	switch product.Status {
+	case "":
+		product.Status = models.LISTING_STATUS_ACTIVE
+	case models.LISTING_STATUS_DRAFT, models.LISTING_STATUS_ACTIVE:
+	default:
+		c.Logger.Error(fmt.Sprintf("Failed to create listing: invalid status %q", product.Status))
+		return uuid.Nil, fmt.Errorf("invalid listing status, must be '%s' or '%s'", models.LISTING_STATUS_DRAFT, models.LISTING_STATUS_ACTIVE)
+	}
+
+	if product.PublishAt != nil {
+		if product.Status != models.LISTING_STATUS_DRAFT {
+			c.Logger.Error("Failed to create listing: publish_at set on a non-draft listing")
+			return uuid.Nil, fmt.Errorf("publish_at can only be set on draft listings")
+		}
+
+		if !product.PublishAt.After(time.Now()) {
+			c.Logger.Error("Failed to create listing: publish_at is not in the future")
+			return uuid.Nil, fmt.Errorf("publish_at must be in the future")
+		}
+	}
+
+	if len(product.Images) > models.MAX_LISTING_IMAGES {
+		c.Logger.Error(fmt.Sprintf("Failed to create listing: %d images", len(product.Images)))
+		return uuid.Nil, fmt.Errorf("a listing can have at most %d images", models.MAX_LISTING_IMAGES)
+	}
+
 	c.Logger.Debug(fmt.Sprintf("Processing %d images for listing", len(product.Images)))
+	images := make([]*models.ProductImage, 0, len(product.Images))
 	for i := range product.Images {
-		img := []byte(product.Images[i].Image)
-		product.Images[i].CompressedImage, err = compression.CompressZSTD(img)
+		data, err := base64.StdEncoding.DecodeString(product.Images[i].Image)
 		if err != nil {
-			c.Logger.Error(fmt.Sprintf("Image compression failed: %v", err))
+			c.Logger.Error(fmt.Sprintf("Failed to decode image %d: %v", i, err))
+			return uuid.Nil, fmt.Errorf("image %d is not valid base64", i)
+		}
+
+		image, err := newProductImage(data)
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("Rejected image %d: %v", i, err))
 			return uuid.Nil, err
 		}
+		image.Order = product.Images[i].Order
 
-		hash := sha256.Sum256(img)
-		product.Images[i].Checksum = hex.EncodeToString(hash[:])
+		product.Images[i] = image
+		images = append(images, &product.Images[i])
+	}
+
+	// blobs are put before the listing exists, they are queued for deletion when it never does
+	release, err := c.storeImageBlobs(ctx, images...)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to store images: %v", err))
+		return uuid.Nil, err
 	}
+	defer release()
 
 	c.Logger.Info(fmt.Sprintf("Creating new listing for user %s: %s", userID, product.ItemName))
 	productID, err = c.Database.InsertListing(ctx, userID, product)
@@ -58,6 +116,57 @@ func (c *CoreStoreContext) DeleteListing(ctx context.Context, userID uuid.UUID,
 	return nil
 }
 
+func (c *CoreStoreContext) PublishListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for publishing")
+		return fmt.Errorf("invalid product id")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Publishing draft listing %s for user %s", productID, userID))
+	err = c.Database.PublishListing(ctx, userID, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to publish listing: %v", err))
+		return err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Successfully published listing %s", productID))
+	return nil
+}
+
+func (c *CoreStoreContext) RelistListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for relisting")
+		return uuid.Nil, fmt.Errorf("invalid product id")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Relisting listing %s for user %s", productID, userID))
+	newProductID, err = c.Database.InsertRelistedListing(ctx, userID, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to relist listing: %v", err))
+		return uuid.Nil, err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Successfully relisted listing %s as %s", productID, newProductID))
+	return newProductID, nil
+}
+
+func (c *CoreStoreContext) DuplicateListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for duplication")
+		return uuid.Nil, fmt.Errorf("invalid product id")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Duplicating listing %s for user %s", productID, userID))
+	newProductID, err = c.Database.InsertDuplicatedListing(ctx, userID, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to duplicate listing: %v", err))
+		return uuid.Nil, err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Successfully duplicated listing %s as draft %s", productID, newProductID))
+	return newProductID, nil
+}
+
 func (c *CoreStoreContext) SetItemsSoldViaBid(ctx context.Context, userId uuid.UUID, info *models.SellItemViaBid) (err error) {
 	if info.BidID == uuid.Nil {
 		c.Logger.Error("Invalid bid ID provided for sale")
@@ -85,7 +194,7 @@ func (c *CoreStoreContext) SetItemsSoldViaBid(ctx context.Context, userId uuid.U
 	return nil
 }
 
-func (c *CoreStoreContext) GetListings(ctx context.Context, userID uuid.UUID, category, searchQuery, startPriceStr, endPriceStr, createdByStr string, limit, page int) (products []models.ProductInfo, err error) {
+func (c *CoreStoreContext) GetListings(ctx context.Context, userID uuid.UUID, category, searchQuery, startPriceStr, endPriceStr, createdByStr string, attributes map[string][]string, primaryImageOnly bool, limit, page int) (products []models.ProductInfo, err error) {
 	if limit < 1 || page < 1 {
 		c.Logger.Error(fmt.Sprintf("Invalid pagination parameters: limit=%d, page=%d", limit, page))
 		return nil, fmt.Errorf("invalid limit or page param")
@@ -117,7 +226,7 @@ func (c *CoreStoreContext) GetListings(ctx context.Context, userID uuid.UUID, ca
 		endPrice = &ep
 	}
 
-	if category != "" {
+	if category = NormalizeCategory(category); category != "" {
 		ct = &category
 	}
 
@@ -133,23 +242,21 @@ func (c *CoreStoreContext) GetListings(ctx context.Context, userID uuid.UUID, ca
 		}
 	}
 
-	c.Logger.Debug(fmt.Sprintf("Fetching listings (page %d, limit %d, category %v, search %v)", page, limit, category, searchQuery))
-	products, err = c.Database.GetProducts(ctx, userID, createdBy, ct, searchWQ, startPrice, endPrice, limit, limit*(page-1))
+	filters, err := parseAttributeFilters(attributes)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Invalid attribute filters: %v", err))
+		return nil, err
+	}
+
+	c.Logger.Debug(fmt.Sprintf("Fetching listings (page %d, limit %d, category %v, search %v, attributes %v)", page, limit, category, searchQuery, filters))
+	products, err = c.Database.GetProducts(ctx, userID, createdBy, ct, searchWQ, startPrice, endPrice, filters, primaryImageOnly, limit, limit*(page-1))
 	if err != nil {
 		c.Logger.Error(fmt.Sprintf("Failed to get products: %v", err))
 		return nil, err
 	}
 
-	c.Logger.Debug(fmt.Sprintf("Decompressing images for %d products", len(products)))
 	for i := range products {
-		for j := range products[i].Images {
-			decompressed, err := compression.DecompressZSTD(products[i].Images[j].CompressedImage)
-			if err != nil {
-				c.Logger.Error(fmt.Sprintf("Failed to decompress image %d for product index %d: %v", j, i, err))
-				continue
-			}
-			products[i].Images[j].Image = string(decompressed)
-		}
+		setImageURLs(products[i].Images)
 	}
 
 	c.Logger.Debug(fmt.Sprintf("Successfully retrieved %d products", len(products)))
@@ -187,33 +294,50 @@ func (c *CoreStoreContext) UpdateProduct(ctx context.Context, userID uuid.UUID,
 		return fmt.Errorf("invalid product id")
 	}
 
-	if update.Category == "" && update.Name == "" && update.Description == "" {
+	if update.Category == "" && update.Name == "" && update.Description == "" && update.Condition == "" && len(update.Attributes) == 0 {
 		return fmt.Errorf("please provide a field to update")
 
 	}
 
+	update.Category = NormalizeCategory(update.Category)
+	if update.Category != "" || len(update.Attributes) > 0 {
+		// the attributes that stay have to fit the new category, and new attributes the current one
+		current, err := c.Database.GetProductById(ctx, userID, update.Id)
+		if err != nil {
+			return err
+		}
+
+		category, attributes := update.Category, update.Attributes
+		if category == "" {
+			category = current.Category
+		}
+		if len(attributes) == 0 {
+			attributes = current.Attributes
+		}
+
+		update.AttributeValues, err = c.validateAttributes(ctx, category, attributes)
+		if err != nil {
+			return err
+		}
+	}
+
+	update.Condition, err = normalizeCondition(update.Condition)
+	if err != nil {
+		return err
+	}
+
 	err = c.Database.UpdateItemListing(ctx, userID, update)
 	return
 }
 
-func (c *CoreStoreContext) GetListingByid(ctx context.Context, productID uuid.UUID) (product models.ProductInfo, err error) {
+func (c *CoreStoreContext) GetListingByid(ctx context.Context, userID, productID uuid.UUID) (product models.ProductInfo, err error) {
 	c.Logger.Debug(fmt.Sprintf("Fetching listings (pid: %v)", productID))
-	product, err = c.Database.GetProductById(ctx, productID)
+	product, err = c.Database.GetProductById(ctx, userID, productID)
 	if err != nil {
 		c.Logger.Error(fmt.Sprintf("Failed to get products: %v", err))
 		return product, err
 	}
-	c.Logger.Debug(fmt.Sprintf("Decompressing images for %v", productID))
-
-	for i := range product.Images {
-		decompressed, err := compression.DecompressZSTD(product.Images[i].CompressedImage)
-		if err != nil {
-			c.Logger.Error("failed to get image for product")
-			continue
-		}
-
-		product.Images[i].Image = string(decompressed)
-	}
+	setImageURLs(product.Images)
 
 	c.Logger.Debug(fmt.Sprintf("Successfully retrieved info for %v", productID))
 	return product, nil
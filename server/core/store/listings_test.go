@@ -1,12 +1,20 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"image/color"
+	"image/png"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/database/postgres"
+	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/testutils"
@@ -39,16 +47,16 @@ func TestCreateNewListing(t *testing.T) {
 
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "products",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image: "wlieblwelkjhe",
+				Image: testutils.Base64PNG(2, 2, color.White),
 				Order: 0,
 			},
 			{
-				Image: "sdvsrtvs",
+				Image: testutils.Base64PNG(2, 2, color.Black),
 				Order: 1,
 			},
 		},
@@ -94,12 +102,12 @@ func TestGetListings(t *testing.T) {
 	price := decimal.NewFromInt(0)
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "rozz",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
-			{Image: "img1", Order: 0},
-			{Image: "img2", Order: 1},
+			{Image: testutils.Base64PNG(2, 2, color.White), Order: 0},
+			{Image: testutils.Base64PNG(2, 2, color.Black), Order: 1},
 		},
 	}
 
@@ -108,7 +116,7 @@ func TestGetListings(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	prods, err := c.GetListings(ctx, id, "", "", "", "", "", 40, 1)
+	prods, err := c.GetListings(ctx, id, "", "", "", "", "", nil, false, 40, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -117,7 +125,7 @@ func TestGetListings(t *testing.T) {
 		t.Fatal("incorrect product fetched", prods)
 	}
 
-	if prods[0].Images[0].Image != product.Images[0].Image {
+	if len(prods[0].Images) != 2 || prods[0].Images[0].URL != ImageURL(prods[0].Images[0].ID, imaging.SIZE_FULL) || prods[0].Images[0].Image != "" {
 		t.Fatal("incorrect product image fetched", prods)
 	}
 }
@@ -146,12 +154,12 @@ func TestGetListingsById(t *testing.T) {
 	price := decimal.NewFromInt(0)
 	product := &models.Product{
 		ItemName:    "rizz",
-		Category:    "rozz",
+		Category:    "collectibles",
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
-			{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)},
-			{Image: "img2", Order: 1, Checksum: "chk2", CompressedImage: make([]byte, 10)},
+			{Image: testutils.Base64PNG(2, 2, color.White), Order: 0, Checksum: "chk1", Data: make([]byte, 10)},
+			{Image: testutils.Base64PNG(2, 2, color.Black), Order: 1, Checksum: "chk2", Data: make([]byte, 10)},
 		},
 	}
 
@@ -160,7 +168,7 @@ func TestGetListingsById(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	prods, err := c.GetListingByid(ctx, pid)
+	prods, err := c.GetListingByid(ctx, id, pid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -169,12 +177,22 @@ func TestGetListingsById(t *testing.T) {
 		t.Fatalf("product names dont match got %s want %s", prods.Name, product.ItemName)
 	}
 
-	if prods.Images[0].Image != product.Images[0].Image {
-		t.Fatalf("product images dont match got %s want %s", prods.Images[0].Image, product.Images[0].Image)
+	image, err := c.GetImage(ctx, prods.Images[0].ID, imaging.SIZE_THUMB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(image.Data))
+	if err != nil || image.ContentType != "image/png" {
+		t.Fatalf("product image is not a png: %s %v", image.ContentType, err)
+	}
+
+	if r, g, b, _ := decoded.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Fatal("product images dont match")
 	}
 }
 
-func TestCreateNewListingWithImageCompression(t *testing.T) {
+func TestCreateNewListingStoresProcessedImages(t *testing.T) {
 	conn, clean, err := testutils.SetupTestPostgresDB("")
 	if err != nil {
 		t.Fatal(err)
@@ -193,15 +211,15 @@ func TestCreateNewListingWithImageCompression(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	testImage := "Hello, this is a test image content!"
+	testImage := testutils.PNG(4, 4, color.White)
 	product := &models.Product{
 		ItemName:    "test item",
-		Category:    "products",
+		Category:    "collectibles",
 		Description: "test description",
 		Price:       decimal.NewFromInt(100),
 		Images: []models.ProductImage{
 			{
-				Image: testImage,
+				Image: base64.StdEncoding.EncodeToString(testImage),
 				Order: 0,
 			},
 		},
@@ -212,17 +230,221 @@ func TestCreateNewListingWithImageCompression(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	var compressedImage []byte
-	err = conn.QueryRow(t.Context(), "SELECT compressed_image FROM luxora_product_image WHERE product_id=$1", pid).Scan(&compressedImage)
+	var (
+		stored      []byte
+		contentType string
+	)
+	err = conn.QueryRow(t.Context(), "SELECT b.compressed_image, b.content_type FROM luxora_product_image pi JOIN luxora_image_blob b ON b.checksum = pi.checksum WHERE pi.product_id=$1", pid).Scan(&stored, &contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := png.DecodeConfig(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Width != 4 || config.Height != 4 || contentType != "image/png" {
+		t.Fatalf("stored a %dx%d %s image, want a 4x4 image/png", config.Width, config.Height, contentType)
+	}
+
+	var renditions int
+	err = conn.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_rendition r JOIN luxora_product_image pi ON pi.checksum = r.checksum WHERE pi.product_id=$1", pid).Scan(&renditions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renditions != 2 {
+		t.Fatalf("got %d renditions, want thumb and medium", renditions)
+	}
+
+	_, err = c.CreateNewListing(t.Context(), uid, &models.Product{
+		ItemName: "test item",
+		Category: "collectibles",
+		Price:    decimal.NewFromInt(100),
+		Images:   []models.ProductImage{{Image: base64.StdEncoding.EncodeToString([]byte("not an image"))}},
+	})
+	if err == nil {
+		t.Fatal("expected a listing with a non image upload to be rejected")
+	}
+}
+
+func TestUploadListingImage(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := c.Database.InsertOauthUser(t.Context(), "jill", "google", "skofj", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "test item", Category: "collectibles", Price: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c2 := range []color.Color{color.White, color.Black} {
+		image, err := c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(testutils.PNG(3, 3, c2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Order != i || image.URL != ImageURL(image.ID, imaging.SIZE_FULL) {
+			t.Fatalf("unexpected uploaded image %+v", image)
+		}
+	}
+
+	_, err = c.UploadListingImage(t.Context(), other, pid, bytes.NewReader(testutils.PNG(3, 3, color.White)))
+	if err == nil {
+		t.Fatal("expected uploading to another user's listing to fail")
+	}
+
+	_, err = c.UploadListingImage(t.Context(), uid, pid, strings.NewReader("<html></html>"))
+	if err == nil {
+		t.Fatal("expected a non image upload to be rejected")
+	}
+
+	product, err := c.GetListingByid(t.Context(), uid, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(product.Images) != 2 || product.Images[1].Order != 1 {
+		t.Fatalf("got images %+v, want 2", product.Images)
+	}
+}
+
+func TestManageListingImages(t *testing.T) {
+	conn, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	c := &CoreStoreContext{
+		Database: &postgres.Postgres{
+			Pool: conn,
+		},
+		Logger: logger.New(os.Stdout),
+	}
+
+	uid, err := c.Database.InsertOauthUser(t.Context(), "jack", "google", "skofk", "")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(compressedImage) == 0 {
-		t.Fatal("compressed image is empty")
+	other, err := c.Database.InsertOauthUser(t.Context(), "jill", "google", "skofj", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := c.CreateNewListing(t.Context(), uid, &models.Product{ItemName: "test item", Category: "collectibles", Price: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []uuid.UUID{}
+	for i := range models.MAX_LISTING_IMAGES {
+		image, err := c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(testutils.PNG(3, 3, color.Gray{Y: uint8(i)})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, image.ID)
+	}
+
+	_, err = c.UploadListingImage(t.Context(), uid, pid, bytes.NewReader(testutils.PNG(3, 3, color.White)))
+	if err == nil {
+		t.Fatal("expected uploading more than the maximum number of images to fail")
+	}
+
+	if err := c.DeleteListingImage(t.Context(), other, pid, ids[0]); err == nil {
+		t.Fatal("expected deleting another user's image to fail")
+	}
+
+	if err := c.DeleteListingImage(t.Context(), uid, pid, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids[:1], ids[2:]...)
+
+	replaced, err := c.ReplaceListingImage(t.Context(), uid, pid, ids[0], bytes.NewReader(testutils.PNG(3, 3, color.White)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replaced.ID == ids[0] || replaced.Order != 0 {
+		t.Fatalf("expected a new image in the first position, got %+v", replaced)
+	}
+	ids[0] = replaced.ID
+
+	if _, err := c.ReplaceListingImage(t.Context(), other, pid, ids[1], bytes.NewReader(testutils.PNG(3, 3, color.White))); err == nil {
+		t.Fatal("expected replacing another user's image to fail")
+	}
+
+	if err := c.ReorderListingImages(t.Context(), uid, pid, ids[1:]); err == nil {
+		t.Fatal("expected an order missing an image to be rejected")
+	}
+
+	if err := c.ReorderListingImages(t.Context(), uid, pid, append(ids[1:], ids[1])); err == nil {
+		t.Fatal("expected an order listing an image twice to be rejected")
+	}
+
+	if err := c.ReorderListingImages(t.Context(), other, pid, ids); err == nil {
+		t.Fatal("expected reordering another user's images to fail")
+	}
+
+	reversed := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		reversed[len(ids)-1-i] = id
+	}
+
+	if err := c.ReorderListingImages(t.Context(), uid, pid, reversed); err != nil {
+		t.Fatal(err)
+	}
+
+	product, err := c.GetListingByid(t.Context(), uid, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(product.Images) != len(reversed) {
+		t.Fatalf("got %d images, want %d", len(product.Images), len(reversed))
+	}
+
+	for i, image := range product.Images {
+		if image.ID != reversed[i] || image.Order != i {
+			t.Fatalf("image %d is %s with order %d, want %s", i, image.ID, image.Order, reversed[i])
+		}
+	}
+}
+
+func TestDecodeLegacyImage(t *testing.T) {
+	want := testutils.PNG(2, 2, color.White)
+	legacy, err := compression.CompressZSTD([]byte(base64.StdEncoding.EncodeToString(want)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decodeLegacyImage(legacy)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if len(compressedImage) == len(testImage) {
-		t.Fatal("image doesn't appear to be compressed")
+	if !bytes.Equal(got, want) {
+		t.Fatal("legacy image was not decoded back to its raw bytes")
 	}
 }
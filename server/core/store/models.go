@@ -1,11 +1,19 @@
 package store
 
 import (
+	"errors"
+
 	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/blob"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
 )
 
+// CoreStoreContext holds what the store needs. Image bytes are kept in Postgres when Blobs is nil.
 type CoreStoreContext struct {
 	Database database.Database
 	Logger   *logger.Logger
+	Blobs    blob.BlobStore
 }
+
+// ErrForbidden is returned when the user does not have the role an action requires.
+var ErrForbidden = errors.New("forbidden")
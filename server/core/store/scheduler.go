@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WatchScheduledListings publishes drafts whose publish_at has passed. It checks
+// every interval until ctx is cancelled.
+func (c *CoreStoreContext) WatchScheduledListings(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				published, err := c.Database.PublishScheduledListings(ctx, now)
+				if err != nil {
+					c.Logger.Error(fmt.Sprintf("Failed to publish scheduled listings: %v", err))
+					continue
+				}
+
+				if published > 0 {
+					c.Logger.Info(fmt.Sprintf("Published %d scheduled listings", published))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+const maxVerificationNotesLength = 2000
+
+var conditions = []string{
+	models.CONDITION_NEW,
+	models.CONDITION_LIKE_NEW,
+	models.CONDITION_EXCELLENT,
+	models.CONDITION_GOOD,
+	models.CONDITION_FAIR,
+}
+
+// normalizeCondition lowercases a condition grade and checks it is one of the known grades.
+// An empty condition means the listing is not graded.
+func normalizeCondition(condition string) (string, error) {
+	condition = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(condition)), " ", "_")
+	if condition == "" {
+		return "", nil
+	}
+
+	for _, c := range conditions {
+		if condition == c {
+			return condition, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid condition, must be one of '%s'", strings.Join(conditions, "', '"))
+}
+
+func (c *CoreStoreContext) requireRole(ctx context.Context, userID uuid.UUID, role string) error {
+	ok, err := c.Database.HasRole(ctx, userID, role)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to check role %s for user %s: %v", role, userID, err))
+		return err
+	}
+
+	if !ok {
+		c.Logger.Info(fmt.Sprintf("User %s does not have role %s", userID, role))
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func (c *CoreStoreContext) RequestVerification(ctx context.Context, userID, productID uuid.UUID) (verificationID uuid.UUID, err error) {
+	if productID == uuid.Nil {
+		c.Logger.Error("Invalid product ID provided for verification")
+		return uuid.Nil, fmt.Errorf("invalid product id")
+	}
+
+	c.Logger.Info(fmt.Sprintf("Requesting verification of listing %s for user %s", productID, userID))
+	verificationID, err = c.Database.InsertVerificationRequest(ctx, userID, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to request verification: %v", err))
+		return uuid.Nil, err
+	}
+
+	c.Logger.Info(fmt.Sprintf("Created verification request %s for listing %s", verificationID, productID))
+	return verificationID, nil
+}
+
+func (c *CoreStoreContext) GetPendingVerifications(ctx context.Context, userID uuid.UUID, limit, page int) (verifications []models.Verification, err error) {
+	if err := c.requireRole(ctx, userID, models.ROLE_VERIFIER); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || page <= 0 {
+		c.Logger.Error(fmt.Sprintf("Invalid pagination parameters: limit=%d, page=%d", limit, page))
+		return nil, fmt.Errorf("invalid 'limit' or 'page' amount: minimum 1")
+	}
+
+	verifications, err = c.Database.GetPendingVerifications(ctx, limit, limit*(page-1))
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get pending verifications: %v", err))
+		return nil, err
+	}
+
+	c.Logger.Debug(fmt.Sprintf("Retrieved %d pending verifications", len(verifications)))
+	return verifications, nil
+}
+
+func (c *CoreStoreContext) ReviewVerification(ctx context.Context, userID, verificationID uuid.UUID, review *models.VerificationReview) (err error) {
+	if verificationID == uuid.Nil {
+		c.Logger.Error("Invalid verification ID provided for review")
+		return fmt.Errorf("invalid verification id")
+	}
+
+	if err := c.requireRole(ctx, userID, models.ROLE_VERIFIER); err != nil {
+		return err
+	}
+
+	review.Notes = strings.TrimSpace(review.Notes)
+	if len(review.Notes) > maxVerificationNotesLength {
+		return fmt.Errorf("notes must be at most %d characters", maxVerificationNotesLength)
+	}
+
+	status := models.VERIFICATION_STATUS_REJECTED
+	if review.Approved {
+		status = models.VERIFICATION_STATUS_VERIFIED
+	} else if review.Notes == "" {
+		return fmt.Errorf("notes are required when rejecting a verification")
+	}
+
+	c.Logger.Info(fmt.Sprintf("User %s is marking verification %s as %s", userID, verificationID, status))
+	err = c.Database.UpdateVerification(ctx, userID, verificationID, status, review.Notes)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to review verification: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// GetVerificationHistory returns every verification request of a listing, newest first.
+// The history is visible to anyone who can see the listing.
+func (c *CoreStoreContext) GetVerificationHistory(ctx context.Context, userID, productID uuid.UUID) (verifications []models.Verification, err error) {
+	if productID == uuid.Nil {
+		return nil, fmt.Errorf("invalid product id")
+	}
+
+	_, err = c.Database.GetProductById(ctx, userID, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get listing %s for verification history: %v", productID, err))
+		return nil, err
+	}
+
+	verifications, err = c.Database.GetVerificationHistory(ctx, productID)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to get verification history: %v", err))
+		return nil, err
+	}
+
+	return verifications, nil
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+func TestNormalizeCondition(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "new", want: models.CONDITION_NEW},
+		{in: " Like New ", want: models.CONDITION_LIKE_NEW},
+		{in: "EXCELLENT", want: models.CONDITION_EXCELLENT},
+		{in: "mint", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCondition(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("normalizeCondition(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+
+		if got != tt.want {
+			t.Errorf("normalizeCondition(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package cache wraps a database.Database with an in-process read-through cache for listings.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DEFAULT_SIZE = 1000
+	DEFAULT_TTL  = 30 * time.Second
+)
+
+type productKey struct {
+	userID    uuid.UUID
+	productID uuid.UUID
+}
+
+// CacheStats are the counters of every cache, for monitoring.
+type CacheStats struct {
+	Products Stats `json:"products"`
+	Listings Stats `json:"listings"`
+}
+
+// Cache caches product details and listing pages in front of another Database. Every other method
+// is passed through, methods that change listings invalidate what they could have changed. Entries
+// also expire after a TTL, which bounds how stale they get when another server changes the data.
+//
+// Active products and listing pages look the same to every user and are cached once for all of
+// them. Drafts and closed listings are only visible to their owner, so those products and the
+// owner's pages of their own listings are cached per user. Searches are not cached as they rarely
+// repeat.
+type Cache struct {
+	database.Database
+
+	products *lru[productKey, models.ProductInfo]
+	listings *lru[string, []models.ProductInfo]
+}
+
+// New wraps db with caches holding up to size entries each for at most ttl.
+func New(db database.Database, size int, ttl time.Duration) *Cache {
+	return &Cache{
+		Database: db,
+		products: newLRU[productKey, models.ProductInfo](size, ttl),
+		listings: newLRU[string, []models.ProductInfo](size, ttl),
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Products: c.products.Stats(),
+		Listings: c.listings.Stats(),
+	}
+}
+
+// cloneProduct copies the slices and maps of a product, callers fill in image URLs in place and
+// must not write to a value other requests are reading.
+func cloneProduct(p models.ProductInfo) models.ProductInfo {
+	p.Images = slices.Clone(p.Images)
+	p.Attributes = maps.Clone(p.Attributes)
+	if p.PublishAt != nil {
+		publishAt := *p.PublishAt
+		p.PublishAt = &publishAt
+	}
+	if p.Verification != nil {
+		verification := *p.Verification
+		p.Verification = &verification
+	}
+	return p
+}
+
+func cloneProducts(products []models.ProductInfo) []models.ProductInfo {
+	if products == nil {
+		return nil
+	}
+
+	clone := make([]models.ProductInfo, len(products))
+	for i := range products {
+		clone[i] = cloneProduct(products[i])
+	}
+	return clone
+}
+
+func (c *Cache) GetProductById(ctx context.Context, userID, productID uuid.UUID) (product models.ProductInfo, err error) {
+	shared := productKey{productID: productID}
+	own := productKey{userID: userID, productID: productID}
+	cached, generation, ok := c.products.GetFirst(shared, own)
+	if ok {
+		return cloneProduct(cached), nil
+	}
+
+	product, err = c.Database.GetProductById(ctx, userID, productID)
+	if err != nil {
+		return product, err
+	}
+
+	// only the owner gets to see a product that is not active
+	key := shared
+	if product.Status != models.LISTING_STATUS_ACTIVE {
+		key = own
+	}
+
+	c.products.Set(key, cloneProduct(product), generation)
+	return product, nil
+}
+
+func listingsKey(userID, createdBy uuid.UUID, category *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, primaryImageOnly bool, limit, offset int) string {
+	// drafts only show up when users list their own listings, every other page is shared
+	if createdBy != userID {
+		userID = uuid.Nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%t|%d|%d", userID, createdBy, primaryImageOnly, limit, offset)
+
+	if category != nil {
+		fmt.Fprintf(&b, "|category=%q", *category)
+	}
+	if startPrice != nil {
+		fmt.Fprintf(&b, "|start=%s", startPrice.String())
+	}
+	if endPrice != nil {
+		fmt.Fprintf(&b, "|end=%s", endPrice.String())
+	}
+	for _, a := range attributes {
+		fmt.Fprintf(&b, "|attr=%q,%q,%q", a.Key, a.Op, a.Values)
+	}
+
+	return b.String()
+}
+
+func (c *Cache) GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, primaryImageOnly bool, limit, offset int) (products []models.ProductInfo, err error) {
+	if searchQuery != nil {
+		return c.Database.GetProducts(ctx, userID, createdBy, category, searchQuery, startPrice, endPrice, attributes, primaryImageOnly, limit, offset)
+	}
+
+	key := listingsKey(userID, createdBy, category, startPrice, endPrice, attributes, primaryImageOnly, limit, offset)
+	cached, generation, ok := c.listings.Get(key)
+	if ok {
+		return cloneProducts(cached), nil
+	}
+
+	products, err = c.Database.GetProducts(ctx, userID, createdBy, category, searchQuery, startPrice, endPrice, attributes, primaryImageOnly, limit, offset)
+	if err != nil {
+		return products, err
+	}
+
+	c.listings.Set(key, cloneProducts(products), generation)
+	return products, nil
+}
+
+// invalidate drops the given products and every listing page, any change to a listing can move it
+// onto or off a page.
+func (c *Cache) invalidate(productIDs ...uuid.UUID) {
+	c.products.Invalidate(func(key productKey) bool {
+		return slices.Contains(productIDs, key.productID)
+	})
+	c.listings.Purge()
+}
+
+// invalidateAll is for changes that can touch any number of products.
+func (c *Cache) invalidateAll() {
+	c.products.Purge()
+	c.listings.Purge()
+}
+
+func (c *Cache) InsertListing(ctx context.Context, userId uuid.UUID, product *models.Product) (productId uuid.UUID, err error) {
+	defer c.invalidate()
+	return c.Database.InsertListing(ctx, userId, product)
+}
+
+func (c *Cache) InsertBid(ctx context.Context, userID uuid.UUID, bid *models.Bid) (bidID uuid.UUID, err error) {
+	defer c.invalidate(bid.ProductID)
+	return c.Database.InsertBid(ctx, userID, bid)
+}
+
+func (c *Cache) InsertRelistedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	defer c.invalidate(productID)
+	return c.Database.InsertRelistedListing(ctx, userID, productID)
+}
+
+func (c *Cache) InsertDuplicatedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	defer c.invalidate(productID)
+	return c.Database.InsertDuplicatedListing(ctx, userID, productID)
+}
+
+// InsertCategory changes which listings a category filter matches.
+func (c *Cache) InsertCategory(ctx context.Context, category *models.Category) (categoryID uuid.UUID, err error) {
+	defer c.invalidate()
+	return c.Database.InsertCategory(ctx, category)
+}
+
+func (c *Cache) InsertProductImage(ctx context.Context, userID, productID uuid.UUID, image *models.ProductImage) (imageID uuid.UUID, order int, err error) {
+	defer c.invalidate(productID)
+	return c.Database.InsertProductImage(ctx, userID, productID, image)
+}
+
+func (c *Cache) InsertVerificationRequest(ctx context.Context, userID, productID uuid.UUID) (verificationID uuid.UUID, err error) {
+	defer c.invalidate(productID)
+	return c.Database.InsertVerificationRequest(ctx, userID, productID)
+}
+
+func (c *Cache) UpdateItemSoldViaBid(ctx context.Context, userId uuid.UUID, sold bool, bidID, itemID uuid.UUID) (err error) {
+	defer c.invalidate(itemID)
+	return c.Database.UpdateItemSoldViaBid(ctx, userId, sold, bidID, itemID)
+}
+
+func (c *Cache) UpdateItemSoldViaCheckout(ctx context.Context, buyerID uuid.UUID, cart *models.CartItems) (err error) {
+	defer c.invalidate(cart.Products...)
+	return c.Database.UpdateItemSoldViaCheckout(ctx, buyerID, cart)
+}
+
+func (c *Cache) UpdateItemListing(ctx context.Context, userID uuid.UUID, update *models.UpdateProduct) (err error) {
+	defer c.invalidate(update.Id)
+	return c.Database.UpdateItemListing(ctx, userID, update)
+}
+
+func (c *Cache) PublishListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (err error) {
+	defer c.invalidate(productID)
+	return c.Database.PublishListing(ctx, userID, productID)
+}
+
+func (c *Cache) PublishScheduledListings(ctx context.Context, now time.Time) (published int64, err error) {
+	published, err = c.Database.PublishScheduledListings(ctx, now)
+	if published > 0 {
+		c.invalidateAll()
+	}
+	return published, err
+}
+
+// UpdateVerification only knows the verification, not the product it belongs to.
+func (c *Cache) UpdateVerification(ctx context.Context, reviewerID, verificationID uuid.UUID, status, notes string) (err error) {
+	defer c.invalidateAll()
+	return c.Database.UpdateVerification(ctx, reviewerID, verificationID, status, notes)
+}
+
+func (c *Cache) ReplaceProductImage(ctx context.Context, userID, productID, imageID uuid.UUID, image *models.ProductImage) (newID uuid.UUID, order int, err error) {
+	defer c.invalidate(productID)
+	return c.Database.ReplaceProductImage(ctx, userID, productID, imageID, image)
+}
+
+func (c *Cache) UpdateImageOrder(ctx context.Context, userID, productID uuid.UUID, imageIDs []uuid.UUID) (err error) {
+	defer c.invalidate(productID)
+	return c.Database.UpdateImageOrder(ctx, userID, productID, imageIDs)
+}
+
+func (c *Cache) DeleteListing(ctx context.Context, userID uuid.UUID, productId uuid.UUID) (err error) {
+	defer c.invalidate(productId)
+	return c.Database.DeleteListing(ctx, userID, productId)
+}
+
+func (c *Cache) DeleteProductImage(ctx context.Context, userID, productID, imageID uuid.UUID) (err error) {
+	defer c.invalidate(productID)
+	return c.Database.DeleteProductImage(ctx, userID, productID, imageID)
+}
@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+// countingDatabase serves products from memory and counts how often it is read.
+type countingDatabase struct {
+	database.Database
+
+	mu       sync.Mutex
+	products map[uuid.UUID]models.ProductInfo
+	reads    int
+	// afterRead runs once a read has its result, before returning it
+	afterRead func()
+}
+
+func (d *countingDatabase) done() {
+	d.mu.Lock()
+	afterRead := d.afterRead
+	d.afterRead = nil
+	d.mu.Unlock()
+
+	if afterRead != nil {
+		afterRead()
+	}
+}
+
+func (d *countingDatabase) GetProductById(ctx context.Context, userID, productID uuid.UUID) (models.ProductInfo, error) {
+	d.mu.Lock()
+	d.reads++
+	product := d.products[productID]
+	d.mu.Unlock()
+
+	d.done()
+	return product, nil
+}
+
+func (d *countingDatabase) GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, primaryImageOnly bool, limit, offset int) ([]models.ProductInfo, error) {
+	d.mu.Lock()
+	d.reads++
+	products := []models.ProductInfo{}
+	for _, p := range d.products {
+		products = append(products, p)
+	}
+	d.mu.Unlock()
+
+	d.done()
+	return products, nil
+}
+
+func (d *countingDatabase) UpdateItemListing(ctx context.Context, userID uuid.UUID, update *models.UpdateProduct) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := d.products[update.Id]
+	p.Name = update.Name
+	d.products[update.Id] = p
+	return nil
+}
+
+func newCountingDatabase() (*countingDatabase, uuid.UUID) {
+	id := uuid.New()
+	return &countingDatabase{
+		products: map[uuid.UUID]models.ProductInfo{
+			id: {ItemID: id, Name: "watch", Status: models.LISTING_STATUS_ACTIVE, Images: []models.ProductImage{{Order: 1}}},
+		},
+	}, id
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRU[int, int](2, time.Minute)
+
+	_, gen, _ := c.Get(1)
+	c.Set(1, 1, gen)
+	c.Set(2, 2, gen)
+	c.Get(1)
+	c.Set(3, 3, gen)
+
+	if _, _, ok := c.Get(2); ok {
+		t.Fatal("expected least recently used entry to be evicted")
+	}
+	if _, _, ok := c.Get(1); !ok {
+		t.Fatal("expected recently used entry to be kept")
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Entries != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	now := time.Now()
+	c := newLRU[int, int](2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, gen, _ := c.Get(1)
+	c.Set(1, 1, gen)
+
+	now = now.Add(time.Minute)
+	if _, _, ok := c.Get(1); ok {
+		t.Fatal("expected entry to expire")
+	}
+	if c.Stats().Entries != 0 {
+		t.Fatal("expected expired entry to be removed")
+	}
+}
+
+func TestLRUIgnoresStaleSet(t *testing.T) {
+	c := newLRU[int, int](2, time.Minute)
+
+	_, gen, _ := c.Get(1)
+	c.Purge()
+	c.Set(1, 1, gen)
+
+	if _, _, ok := c.Get(1); ok {
+		t.Fatal("expected value read before an invalidation not to be cached")
+	}
+}
+
+func TestGetProductByIdCached(t *testing.T) {
+	db, id := newCountingDatabase()
+	c := New(db, 10, time.Minute)
+	user := uuid.New()
+
+	for range 3 {
+		p, err := c.GetProductById(t.Context(), user, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != "watch" {
+			t.Fatalf("expected watch, got %s", p.Name)
+		}
+
+		// callers fill in image urls in place, that must not leak into the cache
+		p.Images[0].URL = "changed"
+	}
+
+	if db.reads != 1 {
+		t.Fatalf("expected 1 read, got %d", db.reads)
+	}
+
+	p, _ := c.GetProductById(t.Context(), user, id)
+	if p.Images[0].URL != "" {
+		t.Fatal("cached product was modified by a caller")
+	}
+
+	stats := c.Stats().Products
+	if stats.Hits != 3 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// active products look the same to everyone
+	if _, err := c.GetProductById(t.Context(), uuid.New(), id); err != nil {
+		t.Fatal(err)
+	}
+	if db.reads != 1 {
+		t.Fatalf("expected 1 read, got %d", db.reads)
+	}
+
+	// drafts are cached for their owner only
+	draft := uuid.New()
+	db.products[draft] = models.ProductInfo{ItemID: draft, Name: "ring", Status: models.LISTING_STATUS_DRAFT}
+	for range 2 {
+		if _, err := c.GetProductById(t.Context(), user, draft); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.reads != 2 {
+		t.Fatalf("expected 2 reads, got %d", db.reads)
+	}
+
+	if _, err := c.GetProductById(t.Context(), uuid.New(), draft); err != nil {
+		t.Fatal(err)
+	}
+	if db.reads != 3 {
+		t.Fatalf("expected 3 reads, got %d", db.reads)
+	}
+}
+
+func TestListingPagesShared(t *testing.T) {
+	db, _ := newCountingDatabase()
+	c := New(db, 10, time.Minute)
+	category := "watches"
+
+	// a public page is read once for every user
+	for range 2 {
+		if _, err := c.GetProducts(t.Context(), uuid.New(), uuid.Nil, &category, nil, nil, nil, nil, true, 40, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.reads != 1 {
+		t.Fatalf("expected 1 read, got %d", db.reads)
+	}
+
+	stats := c.Stats().Listings
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// users listing their own listings see their drafts, their pages are not shared
+	owner := uuid.New()
+	if _, err := c.GetProducts(t.Context(), owner, owner, nil, nil, nil, nil, nil, true, 40, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetProducts(t.Context(), uuid.New(), owner, nil, nil, nil, nil, nil, true, 40, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.reads != 3 {
+		t.Fatalf("expected 3 reads, got %d", db.reads)
+	}
+}
+
+func TestUpdateInvalidates(t *testing.T) {
+	db, id := newCountingDatabase()
+	c := New(db, 10, time.Minute)
+	user := uuid.New()
+
+	if _, err := c.GetProductById(t.Context(), user, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetProducts(t.Context(), user, uuid.Nil, nil, nil, nil, nil, nil, true, 40, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateItemListing(t.Context(), user, &models.UpdateProduct{Id: id, Name: "clock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := c.GetProductById(t.Context(), user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "clock" {
+		t.Fatalf("expected updated product, got %s", p.Name)
+	}
+
+	products, err := c.GetProducts(t.Context(), user, uuid.Nil, nil, nil, nil, nil, nil, true, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].Name != "clock" {
+		t.Fatalf("expected updated listing, got %+v", products)
+	}
+
+	if db.reads != 4 {
+		t.Fatalf("expected 4 reads, got %d", db.reads)
+	}
+}
+
+func TestUpdateDuringReadIsNotCached(t *testing.T) {
+	db, id := newCountingDatabase()
+	c := New(db, 10, time.Minute)
+	user := uuid.New()
+
+	// the update lands while the first read is still running, its result is already stale
+	db.afterRead = func() {
+		c.UpdateItemListing(t.Context(), user, &models.UpdateProduct{Id: id, Name: "clock"})
+	}
+
+	p, err := c.GetProductById(t.Context(), user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "watch" {
+		t.Fatalf("expected product from before the update, got %s", p.Name)
+	}
+
+	p, err = c.GetProductById(t.Context(), user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "clock" {
+		t.Fatalf("expected updated product, got %s", p.Name)
+	}
+}
+
+func TestSearchesNotCached(t *testing.T) {
+	db, _ := newCountingDatabase()
+	c := New(db, 10, time.Minute)
+	search := "watch"
+
+	for range 2 {
+		if _, err := c.GetProducts(t.Context(), uuid.New(), uuid.Nil, nil, &search, nil, nil, nil, true, 40, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.reads != 2 {
+		t.Fatalf("expected 2 reads, got %d", db.reads)
+	}
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of a single cache. Invalidations counts entries dropped because the data
+// behind them changed, evictions counts entries dropped to make room.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// lru is a least recently used cache whose entries also expire after a fixed TTL. Every
+// invalidation bumps a generation, values read from the database before an invalidation are not
+// stored afterwards, so a slow read can not put stale data back in the cache.
+type lru[K comparable, V any] struct {
+	mu         sync.Mutex
+	capacity   int
+	ttl        time.Duration
+	items      map[K]*list.Element
+	order      *list.List
+	generation uint64
+	now        func() time.Time
+
+	hits, misses, evictions, invalidations atomic.Uint64
+}
+
+func newLRU[K comparable, V any](capacity int, ttl time.Duration) *lru[K, V] {
+	return &lru[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value cached under key, along with the current generation to pass to Set.
+func (c *lru[K, V]) Get(key K) (value V, generation uint64, ok bool) {
+	return c.GetFirst(key)
+}
+
+// GetFirst is Get for the first of keys that is cached. Looking up several keys counts as a single
+// hit or miss.
+func (c *lru[K, V]) GetFirst(keys ...K) (value V, generation uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		el, found := c.items[key]
+		if found && c.now().Before(el.Value.(*entry[K, V]).expires) {
+			c.order.MoveToFront(el)
+			c.hits.Add(1)
+			return el.Value.(*entry[K, V]).value, c.generation, true
+		}
+
+		if found {
+			c.remove(el)
+		}
+	}
+
+	c.misses.Add(1)
+	return value, c.generation, false
+}
+
+// Set caches value under key, unless the cache was invalidated since generation was handed out.
+func (c *lru[K, V]) Set(key K, value V, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	e := &entry[K, V]{key: key, value: value, expires: c.now().Add(c.ttl)}
+	if el, found := c.items[key]; found {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(e)
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// Invalidate drops every entry whose key matches.
+func (c *lru[K, V]) Invalidate(match func(key K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key, el := range c.items {
+		if match(key) {
+			c.remove(el)
+			c.invalidations.Add(1)
+		}
+	}
+}
+
+// Purge drops every entry.
+func (c *lru[K, V]) Purge() {
+	c.Invalidate(func(K) bool { return true })
+}
+
+func (c *lru[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
+
+func (c *lru[K, V]) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.items)
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       entries,
+	}
+}
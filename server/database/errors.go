@@ -0,0 +1,33 @@
+package database
+
+import "errors"
+
+// ErrUserExists is returned when a new user has the email or username of an existing user.
+var ErrUserExists = errors.New("a user with this email or username already exists")
+
+// ErrTokenInvalid is returned when a single-use token is unknown, expired or already used.
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// ErrIdentityLinked is returned when a provider account is already linked to a user, or the user
+// already has an account of that provider linked.
+var ErrIdentityLinked = errors.New("this account is already linked")
+
+// ErrIdentityNotFound is returned when a user has no linked account of a provider.
+var ErrIdentityNotFound = errors.New("no linked account for this provider")
+
+// ErrLastLoginMethod is returned when removing a login method would leave a user unable to log in.
+var ErrLastLoginMethod = errors.New("can not remove the last way to log in")
+
+// ErrSessionNotFound is returned when a session does not exist, belongs to another user, has
+// expired, or its refresh token was replaced.
+var ErrSessionNotFound = errors.New("session not found or expired")
+
+// ErrTokenReused is returned when a refresh token that was already rotated is presented again. The
+// session it belonged to is revoked, since the token was likely stolen.
+var ErrTokenReused = errors.New("refresh token was already used, log in again")
+
+// ErrUserNotFound is returned when a user does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrListingNotFound is returned when a listing does not exist.
+var ErrListingNotFound = errors.New("listing not found")
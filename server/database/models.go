@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/pkg/models"
@@ -15,26 +16,72 @@ type Database interface {
 	InsertOauthUser(ctx context.Context, username, provider, providerId, profileImageLink string) (userID uuid.UUID, err error)
 	InsertListing(ctx context.Context, userId uuid.UUID, product *models.Product) (productId uuid.UUID, err error)
 	InsertBid(ctx context.Context, userID uuid.UUID, bid *models.Bid) (bidID uuid.UUID, err error)
+	InsertRelistedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error)
+	InsertDuplicatedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error)
+	InsertCategory(ctx context.Context, category *models.Category) (categoryID uuid.UUID, err error)
+	InsertProductImage(ctx context.Context, userID, productID uuid.UUID, image *models.ProductImage) (imageID uuid.UUID, order int, err error)
+	InsertVerificationRequest(ctx context.Context, userID, productID uuid.UUID) (verificationID uuid.UUID, err error)
+	InsertUserToken(ctx context.Context, userID uuid.UUID, tokenType uint8, tokenHash string, expiresAt time.Time) (err error)
+	InsertIdentity(ctx context.Context, userID uuid.UUID, provider, providerID string) (err error)
+	InsertSession(ctx context.Context, session *models.Session) (err error)
+	InsertRevocation(ctx context.Context, kind, subject string, ttl time.Duration) (revocation models.Revocation, err error)
+	ClaimBlobUpload(ctx context.Context, checksums []string) (uploadID uuid.UUID, err error)
 
 	// query
 	GetLastLogin(ctx context.Context, userID uuid.UUID) (LastLogin sql.NullTime, err error)
-	GetOauthUserIdByProviderID(ctx context.Context, pid string) (id uuid.UUID, err error)
-	GetRefreshToken(ctx context.Context, userId uuid.UUID) (refreshToken string, err error)
-	GetIsUsernameAndIDByProviderID(ctx context.Context, providerID string) (username string, userID uuid.UUID, err error)
+	GetPasswordHash(ctx context.Context, email string) (userID uuid.UUID, passwordHash string, err error)
+	GetUserIdByIdentity(ctx context.Context, provider, providerID string) (userID uuid.UUID, err error)
+	GetSessions(ctx context.Context, userID uuid.UUID) (sessions []models.Session, err error)
+	GetRevocations(ctx context.Context, since time.Time) (revocations []models.Revocation, err error)
+	IsSuspended(ctx context.Context, userID uuid.UUID) (suspended bool, err error)
 	GetHighestBid(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (bid *models.BidDetails, err error)
-	GetProductById(ctx context.Context, productID uuid.UUID) (product models.ProductInfo, err error)
+	GetProductById(ctx context.Context, userID, productID uuid.UUID) (product models.ProductInfo, err error)
 
 	GetBids(ctx context.Context, userID uuid.UUID, productID uuid.UUID, limit, page int) (bids []models.BidDetails, err error)
 	GetUserBids(ctx context.Context, userID uuid.UUID, limit, offset int) (bids []models.BidDetails, err error)
 	GetBidsOnUserListings(ctx context.Context, userID uuid.UUID) (bidsByProduct []models.BidsOnUserListing, err error)
-	GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, limit, offset int) (products []models.ProductInfo, err error)
+	GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, primaryImageOnly bool, limit, offset int) (products []models.ProductInfo, err error)
 	GetUserDetails(ctx context.Context, userID uuid.UUID) (details models.UserDetails, err error)
+	GetCategories(ctx context.Context) (categories []models.Category, err error)
+	GetCategorySchema(ctx context.Context, slug string) (attributes []models.CategoryAttribute, exists bool, err error)
+	GetImage(ctx context.Context, imageID uuid.UUID, size string) (image models.ProductImage, err error)
+	HasRole(ctx context.Context, userID uuid.UUID, role string) (ok bool, err error)
+	GetRoles(ctx context.Context, userID uuid.UUID) (roles []string, err error)
+	GetRoleChanges(ctx context.Context, userID uuid.UUID, limit, offset int) (changes []models.RoleChange, err error)
+	GetListingOwner(ctx context.Context, productID uuid.UUID) (userID uuid.UUID, err error)
+	GetPlatformStats(ctx context.Context) (stats models.PlatformStats, err error)
+	GetPendingVerifications(ctx context.Context, limit, offset int) (verifications []models.Verification, err error)
+	GetVerificationHistory(ctx context.Context, productID uuid.UUID) (verifications []models.Verification, err error)
+	GetBlobDeletions(ctx context.Context, limit int) (checksums []string, err error)
+	GetInlineImageBlobs(ctx context.Context, limit int) (images []models.ProductImage, err error)
 
 	// update
-	UpdateRefreshToken(ctx context.Context, userId uuid.UUID, refreshToken string) (err error)
+	RotateSession(ctx context.Context, userID, sessionID uuid.UUID, oldTokenHash string, session *models.Session) (err error)
+	SetSuspended(ctx context.Context, userID uuid.UUID, suspended bool) (err error)
+	GrantRole(ctx context.Context, actorID, userID uuid.UUID, role string) (changed bool, err error)
+	RevokeRole(ctx context.Context, actorID, userID uuid.UUID, role string) (changed bool, err error)
+	UpdateLastLogin(ctx context.Context, userID uuid.UUID) (err error)
+	UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) (err error)
+	VerifyEmail(ctx context.Context, userID uuid.UUID, tokenHash, email string) (err error)
+	ResetPassword(ctx context.Context, userID uuid.UUID, tokenHash, passwordHash string) (err error)
+	ChangeEmail(ctx context.Context, userID uuid.UUID, tokenHash, email string) (err error)
 	UpdateItemSoldViaBid(ctx context.Context, userId uuid.UUID, sold bool, bidID, itemID uuid.UUID) (err error)
 	UpdateItemSoldViaCheckout(ctx context.Context, buyerID uuid.UUID, cart *models.CartItems) (err error)
 	UpdateItemListing(ctx context.Context, userID uuid.UUID, update *models.UpdateProduct) (err error)
+	PublishListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (err error)
+	PublishScheduledListings(ctx context.Context, now time.Time) (published int64, err error)
+	UpdateVerification(ctx context.Context, reviewerID, verificationID uuid.UUID, status, notes string) (err error)
+	UpdateImageBlobExternal(ctx context.Context, checksum, contentType string) (err error)
+	ReplaceProductImage(ctx context.Context, userID, productID, imageID uuid.UUID, image *models.ProductImage) (newID uuid.UUID, order int, err error)
+	UpdateImageOrder(ctx context.Context, userID, productID uuid.UUID, imageIDs []uuid.UUID) (err error)
+	MoveInlineProductImages(ctx context.Context) (moved int64, err error)
 	// delete
 	DeleteListing(ctx context.Context, userID uuid.UUID, productId uuid.UUID) (err error)
+	DeleteBlobDeletion(ctx context.Context, checksum string, remove func() error) (deleted bool, err error)
+	ReleaseBlobUpload(ctx context.Context, uploadID uuid.UUID) (err error)
+	DeleteProductImage(ctx context.Context, userID, productID, imageID uuid.UUID) (err error)
+	DeleteIdentity(ctx context.Context, userID uuid.UUID, provider string) (err error)
+	DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) (err error)
+	DeleteSessions(ctx context.Context, userID uuid.UUID) (err error)
+	DeleteExpiredRevocations(ctx context.Context) (err error)
 }
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetListingOwner returns who created a listing, drafts included.
+func (p *Postgres) GetListingOwner(ctx context.Context, productID uuid.UUID) (userID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	err = p.Pool.QueryRow(ctx, "SELECT user_id FROM luxora_product WHERE item_id = $1", productID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, database.ErrListingNotFound
+	}
+	return
+}
+
+func (p *Postgres) GetPlatformStats(ctx context.Context) (stats models.PlatformStats, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = p.Pool.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM luxora_user),
+			(SELECT COUNT(*) FROM luxora_user WHERE suspended_at IS NOT NULL),
+			(SELECT COUNT(*) FROM luxora_session WHERE expires_at > NOW()),
+			(SELECT COUNT(*) FROM luxora_product WHERE status = 'active' AND NOT COALESCE(sold, false)),
+			(SELECT COUNT(*) FROM luxora_product WHERE status = 'draft'),
+			(SELECT COUNT(*) FROM luxora_product WHERE COALESCE(sold, false)),
+			(SELECT COUNT(*) FROM product_bid),
+			(SELECT COUNT(*) FROM luxora_product_verification WHERE status = 'pending')
+	`).Scan(
+		&stats.Users,
+		&stats.SuspendedUsers,
+		&stats.ActiveSessions,
+		&stats.ActiveListings,
+		&stats.DraftListings,
+		&stats.SoldListings,
+		&stats.Bids,
+		&stats.PendingVerifications,
+	)
+	return
+}
@@ -0,0 +1,290 @@
+package postgres
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// BLOB_UPLOAD_ACTIVE matches claimed uploads that still keep their blobs from being deleted. Uploads
+// take seconds, older claims belong to a server that stopped before releasing them.
+const BLOB_UPLOAD_ACTIVE = "started_at > NOW() - INTERVAL '1 hour'"
+
+// blobLock is taken by ClaimBlobUpload and DeleteBlobDeletion so deleting the blobs of a checksum and
+// starting an upload of it never overlap.
+const blobLock = "SELECT pg_advisory_xact_lock(hashtext($1))"
+
+// ClaimBlobUpload records that blobs with the checksums are about to be put in the blob store.
+// DeleteBlobDeletion leaves them alone until the upload is released, and a deletion that is already
+// underway finishes before the claim is made.
+func (p *Postgres) ClaimBlobUpload(ctx context.Context, checksums []string) (uploadID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// locks are taken in the same order everywhere so two uploads can not deadlock
+	for _, checksum := range slices.Compact(slices.Sorted(slices.Values(checksums))) {
+		_, err = tx.Exec(ctx, blobLock, checksum)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	uploadID = uuid.New()
+	_, err = tx.Exec(ctx, "INSERT INTO luxora_blob_upload (upload_id, checksum) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING", uploadID, checksums)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uploadID, tx.Commit(ctx)
+}
+
+// ReleaseBlobUpload ends a claimed upload. Blobs of images the database did not store meanwhile, as
+// when inserting their listing failed, are queued for deletion.
+func (p *Postgres) ReleaseBlobUpload(ctx context.Context, uploadID uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_blob_deletion (checksum)
+		SELECT u.checksum FROM luxora_blob_upload u
+		WHERE u.upload_id = $1 AND NOT EXISTS (SELECT 1 FROM luxora_image_blob b WHERE b.checksum = u.checksum)
+		ON CONFLICT (checksum) DO NOTHING
+	`, uploadID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM luxora_blob_upload WHERE upload_id = $1", uploadID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetBlobDeletions returns checksums of externally stored blobs that are no longer referenced.
+// Checksums whose blob was stored again since it was queued are dropped from the queue first,
+// checksums that are being uploaded again are skipped.
+func (p *Postgres) GetBlobDeletions(ctx context.Context, limit int) (checksums []string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err = p.Pool.Exec(ctx, "DELETE FROM luxora_blob_deletion d USING luxora_image_blob b WHERE b.checksum = d.checksum")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT checksum FROM luxora_blob_deletion d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM luxora_blob_upload u
+			WHERE u.checksum = d.checksum AND `+BLOB_UPLOAD_ACTIVE+`
+		)
+		ORDER BY queued_at ASC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums = []string{}
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+
+	return checksums, rows.Err()
+}
+
+// DeleteBlobDeletion calls remove to delete the blobs of a queued checksum and drops it from the
+// queue. Whether the blobs can go is decided again under the lock ClaimBlobUpload takes, and remove
+// runs while it is held. Blobs that were stored again are kept, blobs that are being uploaded again
+// stay queued until the upload is released.
+func (p *Postgres) DeleteBlobDeletion(ctx context.Context, checksum string, remove func() error) (deleted bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, blobLock, checksum)
+	if err != nil {
+		return false, err
+	}
+
+	var stored, uploading bool
+	err = tx.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM luxora_image_blob WHERE checksum = $1),
+			EXISTS (SELECT 1 FROM luxora_blob_upload WHERE checksum = $1 AND `+BLOB_UPLOAD_ACTIVE+`)
+	`, checksum).Scan(&stored, &uploading)
+	if err != nil {
+		return false, err
+	}
+
+	if uploading {
+		return false, nil
+	}
+
+	if !stored {
+		if err = remove(); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM luxora_blob_deletion WHERE checksum = $1", checksum)
+	if err != nil {
+		return false, err
+	}
+
+	return !stored, tx.Commit(ctx)
+}
+
+// MoveInlineProductImages moves images stored inline on luxora_product_image, from before blobs
+// existed, into luxora_image_blob so they can be moved out of the database like every other blob.
+// Blobs nothing references anymore are removed once the reference counts are recounted.
+func (p *Postgres) MoveInlineProductImages(ctx context.Context) (moved int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_image_blob (checksum, compressed_image)
+		SELECT DISTINCT ON (1) COALESCE(checksum, encode(sha256(compressed_image), 'hex')), compressed_image
+		FROM luxora_product_image
+		WHERE compressed_image IS NOT NULL
+		ON CONFLICT (checksum) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_product_image SET checksum = encode(sha256(compressed_image), 'hex') WHERE checksum IS NULL AND compressed_image IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+
+	t, err := tx.Exec(ctx, "UPDATE luxora_product_image SET compressed_image = NULL WHERE compressed_image IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_image_blob b
+		SET ref_count = (SELECT COUNT(*) FROM luxora_product_image pi WHERE pi.checksum = b.checksum)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM luxora_image_blob WHERE ref_count <= 0")
+	if err != nil {
+		return 0, err
+	}
+
+	return t.RowsAffected(), tx.Commit(ctx)
+}
+
+// GetInlineImageBlobs returns blobs whose bytes are still stored in the database, together with
+// their renditions. The content type is empty for images stored as compressed base64 text.
+func (p *Postgres) GetInlineImageBlobs(ctx context.Context, limit int) (images []models.ProductImage, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT checksum, compressed_image, COALESCE(content_type, '')
+		FROM luxora_image_blob
+		WHERE compressed_image IS NOT NULL
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images = []models.ProductImage{}
+	index := map[string]int{}
+	checksums := []string{}
+	for rows.Next() {
+		var image models.ProductImage
+		if err := rows.Scan(&image.Checksum, &image.Data, &image.ContentType); err != nil {
+			return nil, err
+		}
+		index[image.Checksum] = len(images)
+		checksums = append(checksums, image.Checksum)
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.Pool.Query(ctx, `
+		SELECT checksum, size, content_type, width, height, data
+		FROM luxora_image_rendition
+		WHERE checksum = ANY($1) AND data IS NOT NULL
+	`, checksums)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var checksum string
+		var r models.ImageRendition
+		if err := rows.Scan(&checksum, &r.Size, &r.ContentType, &r.Width, &r.Height, &r.Data); err != nil {
+			return nil, err
+		}
+		images[index[checksum]].Renditions = append(images[index[checksum]].Renditions, r)
+	}
+
+	return images, rows.Err()
+}
+
+// UpdateImageBlobExternal drops the bytes of a blob and its renditions from the database once they
+// have been written to the blob store.
+func (p *Postgres) UpdateImageBlobExternal(ctx context.Context, checksum, contentType string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_image_blob SET compressed_image = NULL, content_type = $2 WHERE checksum = $1", checksum, contentType)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_image_rendition SET data = NULL WHERE checksum = $1", checksum)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+func (p *Postgres) InsertCategory(ctx context.Context, category *models.Category) (categoryID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_category (parent_id, slug, display_name) VALUES ($1, $2, $3) RETURNING category_id", category.ParentID, category.Slug, category.DisplayName).Scan(&categoryID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	for _, a := range category.Attributes {
+		_, err = tx.Exec(ctx, "INSERT INTO luxora_category_attribute (category_id, key, display_name, value_type, required) VALUES ($1, $2, $3, $4, $5)", categoryID, a.Key, a.DisplayName, a.Type, a.Required)
+		if err != nil {
+			tx.Rollback(ctx)
+			return uuid.Nil, err
+		}
+	}
+
+	return categoryID, tx.Commit(ctx)
+}
+
+// GetCategories returns every category as a flat list. ListingCount only covers
+// active, unsold listings filed directly under the category, not its children.
+func (p *Postgres) GetCategories(ctx context.Context) (categories []models.Category, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT c.category_id, c.parent_id, c.slug, c.display_name, COUNT(lp.item_id)
+		FROM luxora_category c
+		LEFT JOIN luxora_product lp ON lower(lp.category) = c.slug AND lp.status = 'active' AND lp.sold IS NOT TRUE
+		GROUP BY c.category_id
+		ORDER BY c.display_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		var c models.Category
+		err = rows.Scan(&c.ID, &c.ParentID, &c.Slug, &c.DisplayName, &c.ListingCount)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Attributes = []models.CategoryAttribute{}
+		index[c.ID] = len(categories)
+		categories = append(categories, c)
+	}
+	rows.Close()
+
+	rows, err = p.Pool.Query(ctx, "SELECT category_id, key, display_name, value_type, required FROM luxora_category_attribute ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			categoryID uuid.UUID
+			a          models.CategoryAttribute
+		)
+
+		err = rows.Scan(&categoryID, &a.Key, &a.DisplayName, &a.Type, &a.Required)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[categoryID]; ok {
+			categories[i].Attributes = append(categories[i].Attributes, a)
+		}
+	}
+
+	return categories, nil
+}
+
+// GetCategorySchema returns the attributes a category defines, including the ones it
+// inherits from its parents. When a child redefines a key its definition wins.
+// exists is false when the slug is not a managed category.
+func (p *Postgres) GetCategorySchema(ctx context.Context, slug string) (attributes []models.CategoryAttribute, exists bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	err = p.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM luxora_category WHERE slug = $1)", slug).Scan(&exists)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	rows, err := p.Pool.Query(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT category_id, parent_id, 0 AS depth FROM luxora_category WHERE slug = $1
+			UNION ALL
+			SELECT c.category_id, c.parent_id, a.depth + 1 FROM luxora_category c JOIN ancestors a ON c.category_id = a.parent_id
+		)
+		SELECT DISTINCT ON (ca.key) ca.key, ca.display_name, ca.value_type, ca.required
+		FROM luxora_category_attribute ca
+		JOIN ancestors a ON a.category_id = ca.category_id
+		ORDER BY ca.key, a.depth
+	`, slug)
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	attributes = []models.CategoryAttribute{}
+	for rows.Next() {
+		var a models.CategoryAttribute
+		err = rows.Scan(&a.Key, &a.DisplayName, &a.Type, &a.Required)
+		if err != nil {
+			return nil, true, err
+		}
+		attributes = append(attributes, a)
+	}
+
+	return attributes, true, nil
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/shopspring/decimal"
+)
+
+func TestInsertCategory(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	parent, err := db.InsertCategory(t.Context(), &models.Category{Slug: "vehicles", DisplayName: "Vehicles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.InsertCategory(t.Context(), &models.Category{
+		ParentID:    &parent,
+		Slug:        "cars",
+		DisplayName: "Cars",
+		Attributes: []models.CategoryAttribute{
+			{Key: "mileage", DisplayName: "Mileage", Type: models.ATTRIBUTE_TYPE_NUMBER, Required: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := db.GetCategories(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range categories {
+		if c.Slug != "cars" {
+			continue
+		}
+
+		if c.ParentID == nil || *c.ParentID != parent {
+			t.Fatal("category has the wrong parent")
+		}
+
+		if len(c.Attributes) != 1 || c.Attributes[0].Key != "mileage" {
+			t.Fatalf("unexpected attributes: %+v", c.Attributes)
+		}
+		return
+	}
+
+	t.Fatal("inserted category not returned")
+}
+
+func TestGetProductsByParentCategory(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, category := range []string{"watches", "jewellery", "bags"} {
+		_, err := db.InsertListing(t.Context(), id, &models.Product{ItemName: "rizz", Category: category, Price: decimal.NewFromInt(10)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	category := "accessories"
+	prods, err := db.GetProducts(t.Context(), id, uuid.Nil, &category, nil, nil, nil, nil, false, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 2 {
+		t.Fatalf("got %d products for parent category, want 2", len(prods))
+	}
+
+	category = "bags"
+	prods, err = db.GetProducts(t.Context(), id, uuid.Nil, &category, nil, nil, nil, nil, false, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 1 || prods[0].Category != "bags" {
+		t.Fatalf("got %+v for leaf category", prods)
+	}
+}
+
+func TestGetCategorySchema(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	attributes, exists, err := db.GetCategorySchema(t.Context(), "shoes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists {
+		t.Fatal("expected shoes to be a managed category")
+	}
+
+	got := map[string]models.CategoryAttribute{}
+	for _, a := range attributes {
+		got[a.Key] = a
+	}
+
+	if len(got) != 3 || !got["brand"].Required || got["size"].Type != models.ATTRIBUTE_TYPE_NUMBER {
+		t.Fatalf("unexpected schema for shoes: %+v", attributes)
+	}
+
+	_, exists, err = db.GetCategorySchema(t.Context(), "rizz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		t.Fatal("expected rizz to be an unmanaged category")
+	}
+}
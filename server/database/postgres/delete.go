@@ -28,5 +28,58 @@ func (p *Postgres) DeleteListing(ctx context.Context, userID uuid.UUID, productI
 		return fmt.Errorf("failed to delete listing")
 	}
 
+	// the images are removed by the cascade, the luxora_product_image_ref_count trigger then drops
+	// every blob that is no longer referenced by any listing
+	return tx.Commit(ctx)
+}
+
+// DeleteProductImage removes an image from a listing owned by userID and closes the gap it leaves in the sort order.
+func (p *Postgres) DeleteProductImage(ctx context.Context, userID, productID, imageID uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = lockListingImages(ctx, tx, userID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	t, err := tx.Exec(ctx, "DELETE FROM luxora_product_image WHERE image_id=$1 AND product_id=$2", imageID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		tx.Rollback(ctx)
+		return fmt.Errorf("image not found on listing")
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_product_image pi
+		SET sort_order = o.position
+		FROM (
+			SELECT image_id, ROW_NUMBER() OVER (ORDER BY sort_order ASC, uploaded_at ASC) - 1 AS position
+			FROM luxora_product_image
+			WHERE product_id = $1
+		) o
+		WHERE pi.image_id = o.image_id AND pi.sort_order <> o.position
+	`, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	err = resetVerification(ctx, tx, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
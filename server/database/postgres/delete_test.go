@@ -3,6 +3,7 @@ package postgres
 import (
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/testutils"
 	"github.com/shopspring/decimal"
@@ -33,16 +34,16 @@ func TestDeleteListing(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -57,3 +58,137 @@ func TestDeleteListing(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDeleteListingKeepsSharedImages(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertUser(t.Context(), "diddy", "email@gmail.diddy.com", "github", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName: "rizz",
+		Category: "products",
+		Price:    decimal.NewFromInt(10),
+		Images:   []models.ProductImage{{Order: 0, Checksum: "slkdfkljsfd", Data: make([]byte, 10)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyID, err := db.InsertDuplicatedListing(t.Context(), id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blobs int
+	if err := db.DeleteListing(t.Context(), id, pid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_blob").Scan(&blobs); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs != 1 {
+		t.Fatal("shared image was removed while still in use")
+	}
+
+	if err := db.DeleteListing(t.Context(), id, copyID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_blob").Scan(&blobs); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs != 0 {
+		t.Fatal("orphaned image was not removed")
+	}
+}
+
+func TestImageBlobRefCount(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertUser(t.Context(), "diddy", "email@gmail.diddy.com", "github", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := models.ProductImage{
+		Checksum:    "slkdfkljsfd",
+		ContentType: "image/png",
+		Data:        make([]byte, 10),
+		Renditions:  []models.ImageRendition{{Size: "thumb", ContentType: "image/png", Width: 1, Height: 1, Data: make([]byte, 5)}},
+	}
+
+	refCount := func() (count int) {
+		err := pool.QueryRow(t.Context(), "SELECT COALESCE(SUM(ref_count), 0) FROM luxora_image_blob WHERE checksum=$1", image.Checksum).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// uploading the same image twice, to two listings, stores it once
+	var pids []uuid.UUID
+	for range 2 {
+		pid, err := db.InsertListing(t.Context(), id, &models.Product{
+			ItemName: "rizz",
+			Category: "products",
+			Price:    decimal.NewFromInt(10),
+			Images:   []models.ProductImage{image},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids = append(pids, pid)
+	}
+
+	_, _, err = db.InsertProductImage(t.Context(), id, pids[0], &image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blobs int
+	if err := pool.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_blob").Scan(&blobs); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs != 1 || refCount() != 3 {
+		t.Fatalf("got %d blobs with %d references, want 1 blob with 3 references", blobs, refCount())
+	}
+
+	if err := db.DeleteListing(t.Context(), id, pids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if refCount() != 1 {
+		t.Fatalf("got %d references after deleting a listing, want 1", refCount())
+	}
+
+	// deleting the user cascades to its listings and their images
+	if _, err := pool.Exec(t.Context(), "DELETE FROM luxora_user WHERE id=$1", id); err != nil {
+		t.Fatal(err)
+	}
+
+	var renditions int
+	if err := pool.QueryRow(t.Context(), "SELECT (SELECT COUNT(*) FROM luxora_image_blob) + (SELECT COUNT(*) FROM luxora_image_rendition)").Scan(&renditions); err != nil {
+		t.Fatal(err)
+	}
+
+	if renditions != 0 {
+		t.Fatal("orphaned image and renditions were not removed")
+	}
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PASSWORD_LOGIN matches the users that can log in with a password, unlinking a provider counts
+// on the same users that GetPasswordHash lets in.
+const PASSWORD_LOGIN = "signup_type = 'plain' AND COALESCE(password_hash, '') <> ''"
+
+// GetUserIdByIdentity finds the user a provider account is linked to, failing with
+// ErrIdentityNotFound when it is not linked to anyone.
+func (p *Postgres) GetUserIdByIdentity(ctx context.Context, provider, providerID string) (userID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	err = p.Pool.QueryRow(ctx, "SELECT user_id FROM luxora_user_identity WHERE provider = $1 AND provider_user_id = $2", provider, providerID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, database.ErrIdentityNotFound
+	}
+	return
+}
+
+// InsertIdentity links a provider account to an existing user. A provider account can only be
+// linked to one user, and a user can only link one account of each provider.
+func (p *Postgres) InsertIdentity(ctx context.Context, userID uuid.UUID, provider, providerID string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err = p.Pool.Exec(ctx, "INSERT INTO luxora_user_identity (user_id, provider, provider_user_id) VALUES ($1, $2, $3)", userID, provider, providerID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == UNIQUE_VIOLATION {
+		return database.ErrIdentityLinked
+	}
+
+	return err
+}
+
+// DeleteIdentity unlinks the account of a provider from a user, unless it is the only way left for
+// the user to log in.
+func (p *Postgres) DeleteIdentity(ctx context.Context, userID uuid.UUID, provider string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	// the user row is locked so two unlinks at once can not both see another login method left
+	var hasPassword bool
+	err = tx.QueryRow(ctx, "SELECT "+PASSWORD_LOGIN+" FROM luxora_user WHERE id = $1 FOR UPDATE", userID).Scan(&hasPassword)
+	if err != nil {
+		return err
+	}
+
+	var identities int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM luxora_user_identity WHERE user_id = $1", userID).Scan(&identities)
+	if err != nil {
+		return err
+	}
+
+	t, err := tx.Exec(ctx, "DELETE FROM luxora_user_identity WHERE user_id = $1 AND provider = $2", userID, provider)
+	if err != nil {
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		return database.ErrIdentityNotFound
+	}
+
+	if !hasPassword && identities <= 1 {
+		return database.ErrLastLoginMethod
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+)
+
+func TestIdentities(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := db.InsertOauthUser(t.Context(), "jack", "github", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), id, "github"); !errors.Is(err, database.ErrLastLoginMethod) {
+		t.Fatalf("got %v, want %v", err, database.ErrLastLoginMethod)
+	}
+
+	if err := db.InsertIdentity(t.Context(), id, "github", "another"); !errors.Is(err, database.ErrIdentityLinked) {
+		t.Fatalf("second github account: got %v, want %v", err, database.ErrIdentityLinked)
+	}
+
+	if err := db.InsertIdentity(t.Context(), other, "google", "gkfjd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertIdentity(t.Context(), id, "google", "gkfjd"); !errors.Is(err, database.ErrIdentityLinked) {
+		t.Fatalf("account of another user: got %v, want %v", err, database.ErrIdentityLinked)
+	}
+
+	if err := db.InsertIdentity(t.Context(), id, "google", "gsdfs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), id, "github"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), id, "github"); !errors.Is(err, database.ErrIdentityNotFound) {
+		t.Fatalf("got %v, want %v", err, database.ErrIdentityNotFound)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), id, "google"); !errors.Is(err, database.ErrLastLoginMethod) {
+		t.Fatalf("got %v, want %v", err, database.ErrLastLoginMethod)
+	}
+
+	uid, err := db.GetUserIdByIdentity(t.Context(), "google", "gsdfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != id {
+		t.Fatal("user id mismatch")
+	}
+
+	// a password counts as a way to log in
+	plain, err := db.InsertUser(t.Context(), "jill", "jill@example.com", "plain", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertIdentity(t.Context(), plain, "github", "jill"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), plain, "github"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a password hash alone does not let a user who signed up with a provider log in
+	_, err = pool.Exec(t.Context(), "UPDATE luxora_user SET password_hash='hash' WHERE id=$1", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), other, "google"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteIdentity(t.Context(), other, "github"); !errors.Is(err, database.ErrLastLoginMethod) {
+		t.Fatalf("got %v, want %v", err, database.ErrLastLoginMethod)
+	}
+}
+
+func TestLegacyIdentitiesBackfilled(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	// a user stored the way accounts were before identities had their own table
+	_, err = pool.Exec(t.Context(), "ALTER TABLE luxora_user ADD COLUMN provider VARCHAR(50), ADD COLUMN provider_user_id TEXT UNIQUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id uuid.UUID
+	err = pool.QueryRow(t.Context(), "INSERT INTO luxora_user (username, email, signup_type, provider, provider_user_id) VALUES ('legacy', 'legacy@example.com', 'google', 'google', 'g-123') RETURNING id").Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testutils.ApplySchema(t.Context(), pool); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetUserIdByIdentity(t.Context(), "google", "g-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != id {
+		t.Fatalf("got user %v, want %v", got, id)
+	}
+
+	// running the schema again on an up to date database changes nothing
+	if err := testutils.ApplySchema(t.Context(), pool); err != nil {
+		t.Fatal(err)
+	}
+}
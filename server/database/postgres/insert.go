@@ -2,11 +2,16 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
 	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func (p *Postgres) InsertUser(ctx context.Context, username, email, signupType, passwordHash string) (userID uuid.UUID, err error) {
@@ -22,6 +27,11 @@ func (p *Postgres) InsertUser(ctx context.Context, username, email, signupType,
 	err = tx.QueryRow(ctx, "INSERT INTO luxora_user (username, email, signup_type, password_hash)  VALUES ($1, $2, $3, $4) RETURNING id", username, strings.ToLower(email), signupType, passwordHash).Scan(&id)
 	if err != nil {
 		tx.Rollback(ctx)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == UNIQUE_VIOLATION {
+			return uuid.Nil, database.ErrUserExists
+		}
 		return uuid.Nil, err
 	}
 
@@ -41,7 +51,13 @@ func (p *Postgres) InsertOauthUser(ctx context.Context, username, provider, prov
 	}
 	var id uuid.UUID
 
-	err = tx.QueryRow(ctx, "INSERT INTO luxora_user (username, provider, provider_user_id, profile_picture_link)  VALUES ($1, $2, $3, $4) RETURNING id", username, provider, providerId, profileImageLink).Scan(&id)
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_user (username, signup_type, profile_picture_link)  VALUES ($1, $2, $3) RETURNING id", username, provider, profileImageLink).Scan(&id)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO luxora_user_identity (user_id, provider, provider_user_id) VALUES ($1, $2, $3)", id, provider, providerId)
 	if err != nil {
 		tx.Rollback(ctx)
 		return uuid.Nil, err
@@ -62,7 +78,7 @@ func (p *Postgres) InsertListing(ctx context.Context, userId uuid.UUID, product
 		return uuid.Nil, err
 	}
 
-	err = tx.QueryRow(ctx, "INSERT INTO luxora_product (user_id, name, category, description) VALUES ($1, $2, $3, $4) RETURNING item_id", userId, product.ItemName, product.Category, product.Description).Scan(&productId)
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_product (user_id, name, category, description, status, publish_at, condition) VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'active'), $6, NULLIF($7, '')) RETURNING item_id", userId, product.ItemName, product.Category, product.Description, product.Status, product.PublishAt, product.Condition).Scan(&productId)
 	if err != nil {
 		tx.Rollback(ctx)
 		return uuid.Nil, err
@@ -74,8 +90,22 @@ func (p *Postgres) InsertListing(ctx context.Context, userId uuid.UUID, product
 		return uuid.Nil, err
 	}
 
+	for _, a := range product.AttributeValues {
+		_, err = tx.Exec(ctx, "INSERT INTO luxora_product_attribute (product_id, key, value_type, value_text, value_number) VALUES ($1, $2, $3, $4, $5)", productId, a.Key, a.Type, a.Text, a.Number)
+		if err != nil {
+			tx.Rollback(ctx)
+			return uuid.Nil, err
+		}
+	}
+
 	for _, p := range product.Images {
-		_, err = tx.Exec(ctx, "INSERT INTO luxora_product_image (product_id, compressed_image, checksum, sort_order) VALUES ($1, $2, $3, $4)", productId, p.CompressedImage, p.Checksum, p.Order)
+		err = insertImageBlob(ctx, tx, &p)
+		if err != nil {
+			tx.Rollback(ctx)
+			return uuid.Nil, err
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO luxora_product_image (product_id, checksum, sort_order) VALUES ($1, $2, $3)", productId, p.Checksum, p.Order)
 		if err != nil {
 			tx.Rollback(ctx)
 			return uuid.Nil, err
@@ -85,9 +115,247 @@ func (p *Postgres) InsertListing(ctx context.Context, userId uuid.UUID, product
 	return productId, tx.Commit(ctx)
 }
 
+// insertImageBlob stores the bytes and renditions of an image under its checksum, unless an identical image is already stored.
+func insertImageBlob(ctx context.Context, tx pgx.Tx, image *models.ProductImage) (err error) {
+	// an existing blob is updated rather than skipped so its row stays locked until the transaction
+	// ends, a concurrent delete of its last reference can not drop it before the new image row
+	// references it. xmax is only 0 for a row the insert created.
+	var inserted bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO luxora_image_blob (checksum, compressed_image, content_type) VALUES ($1, $2, $3)
+		ON CONFLICT (checksum) DO UPDATE SET checksum = EXCLUDED.checksum
+		RETURNING xmax = 0
+	`, image.Checksum, image.Data, image.ContentType).Scan(&inserted)
+	if err != nil || !inserted {
+		return err
+	}
+
+	for _, r := range image.Renditions {
+		_, err = tx.Exec(ctx, "INSERT INTO luxora_image_rendition (checksum, size, content_type, width, height, data) VALUES ($1, $2, $3, $4, $5, $6)", image.Checksum, r.Size, r.ContentType, r.Width, r.Height, r.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockListingImages locks a listing owned by userID, so concurrent changes to its images are serialized.
+func lockListingImages(ctx context.Context, tx pgx.Tx, userID, productID uuid.UUID) error {
+	var owned bool
+	err := tx.QueryRow(ctx, "SELECT true FROM luxora_product WHERE item_id=$1 AND user_id=$2 FOR UPDATE", productID, userID).Scan(&owned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("no listing found to change images of")
+	}
+	return err
+}
+
+// InsertProductImage appends an image to a listing owned by userID, after the images it already has.
+func (p *Postgres) InsertProductImage(ctx context.Context, userID, productID uuid.UUID, image *models.ProductImage) (imageID uuid.UUID, order int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	err = lockListingImages(ctx, tx, userID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*), COALESCE(MAX(sort_order) + 1, 0) FROM luxora_product_image WHERE product_id=$1", productID).Scan(&count, &order)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	if count >= models.MAX_LISTING_IMAGES {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, fmt.Errorf("a listing can have at most %d images", models.MAX_LISTING_IMAGES)
+	}
+
+	err = insertImageBlob(ctx, tx, image)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_product_image (product_id, checksum, sort_order) VALUES ($1, $2, $3) RETURNING image_id", productID, image.Checksum, order).Scan(&imageID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	err = resetVerification(ctx, tx, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	return imageID, order, tx.Commit(ctx)
+}
+
 func (p *Postgres) InsertBid(ctx context.Context, userID uuid.UUID, bid *models.Bid) (bidID uuid.UUID, err error) {
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
-	err = p.Pool.QueryRow(ctx, "INSERT INTO product_bid (item_id, user_id, bid_amount, message) VALUES ($1, $2, $3, $4) RETURNING bid_id", bid.ProductID, userID, bid.BidAmount, bid.Message).Scan(&bidID)
+	// drafts and sold listings are not for sale, even to someone who knows their id
+	err = p.Pool.QueryRow(ctx, `
+		INSERT INTO product_bid (item_id, user_id, bid_amount, message)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM luxora_product WHERE item_id = $1 AND status = 'active' AND sold IS NOT TRUE)
+		RETURNING bid_id
+	`, bid.ProductID, userID, bid.BidAmount, bid.Message).Scan(&bidID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("no active listing found to bid on")
+	}
 	return
 }
+
+// cloneListing copies a listing owned by userID into a new listing with the given status.
+// The latest price, attributes and condition are carried over and images are shared by checksum, so no image bytes are copied.
+// Verification is not carried over, the new listing has to be verified on its own.
+func cloneListing(ctx context.Context, tx pgx.Tx, userID, productID uuid.UUID, status string) (newID uuid.UUID, err error) {
+	err = tx.QueryRow(ctx, `
+		INSERT INTO luxora_product (user_id, name, category, description, status, condition)
+		SELECT user_id, name, category, description, $3, condition
+		FROM luxora_product
+		WHERE item_id = $1 AND user_id = $2
+		RETURNING item_id
+	`, productID, userID, status).Scan(&newID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_product_price_history (product_id, price, currency)
+		SELECT $1, price, currency
+		FROM luxora_product_price_history
+		WHERE product_id = $2
+		ORDER BY created DESC
+		LIMIT 1
+	`, newID, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_product_attribute (product_id, key, value_type, value_text, value_number)
+		SELECT $1, key, value_type, value_text, value_number
+		FROM luxora_product_attribute
+		WHERE product_id = $2
+	`, newID, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// images stored before blobs existed still carry their bytes inline, move them over so they can
+	// be shared, the way MoveInlineProductImages does
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_image_blob (checksum, compressed_image)
+		SELECT DISTINCT ON (1) COALESCE(checksum, encode(sha256(compressed_image), 'hex')), compressed_image
+		FROM luxora_product_image
+		WHERE product_id = $1 AND compressed_image IS NOT NULL
+		ON CONFLICT (checksum) DO NOTHING
+	`, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_product_image SET checksum = encode(sha256(compressed_image), 'hex')
+		WHERE product_id = $1 AND checksum IS NULL AND compressed_image IS NOT NULL
+	`, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// rows that were inline when they were inserted were never counted. Recounting also locks the
+	// shared blobs until the copies reference them, so deleting the last other reference meanwhile
+	// can not drop them
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_image_blob b
+		SET ref_count = (SELECT COUNT(*) FROM luxora_product_image pi WHERE pi.checksum = b.checksum)
+		WHERE checksum IN (SELECT checksum FROM luxora_product_image WHERE product_id = $1)
+	`, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_product_image SET compressed_image = NULL WHERE product_id = $1 AND compressed_image IS NOT NULL", productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO luxora_product_image (product_id, checksum, sort_order)
+		SELECT $1, checksum, sort_order
+		FROM luxora_product_image
+		WHERE product_id = $2
+	`, newID, productID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return newID, nil
+}
+
+func (p *Postgres) InsertRelistedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// the row stays locked until the original is closed, so two relists can not both copy it
+	var found bool
+	err = tx.QueryRow(ctx, `
+		SELECT true FROM luxora_product
+		WHERE item_id = $1 AND user_id = $2 AND sold IS NOT TRUE AND status IN ('active', 'closed') AND relisted_as IS NULL
+		FOR UPDATE
+	`, productID, userID).Scan(&found)
+	if err != nil {
+		tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("no unsold listing found to relist")
+		}
+		return uuid.Nil, err
+	}
+
+	newProductID, err = cloneListing(ctx, tx, userID, productID, models.LISTING_STATUS_ACTIVE)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_product SET status=$1, relisted_as=$2 WHERE item_id=$3", models.LISTING_STATUS_CLOSED, newProductID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	return newProductID, tx.Commit(ctx)
+}
+
+func (p *Postgres) InsertDuplicatedListing(ctx context.Context, userID, productID uuid.UUID) (newProductID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	newProductID, err = cloneListing(ctx, tx, userID, productID, models.LISTING_STATUS_DRAFT)
+	if err != nil {
+		tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("no listing found to duplicate")
+		}
+		return uuid.Nil, err
+	}
+
+	return newProductID, tx.Commit(ctx)
+}
@@ -4,8 +4,10 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 )
 
@@ -81,16 +83,16 @@ func TestInsertListing(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: []byte("khwbvlifblvlejljv"),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     []byte("khwbvlifblvlejljv"),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: []byte("khwbvlifblvlejljv"),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     []byte("khwbvlifblvlejljv"),
 			},
 		},
 	}
@@ -126,16 +128,16 @@ func TestInsertBid(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -165,4 +167,227 @@ func TestInsertBid(t *testing.T) {
 	if message != inmsg {
 		t.Fatalf("messages dont match, got: %v, want: %v", message, inmsg)
 	}
+
+	draft, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName: "unreleased rizz",
+		Category: "products",
+		Price:    price,
+		Status:   models.LISTING_STATUS_DRAFT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.InsertBid(t.Context(), id, &models.Bid{ProductID: draft, BidAmount: bid}); err == nil {
+		t.Fatal("placed a bid on a draft listing")
+	}
+}
+
+func TestInsertRelistedListing(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName:    "rizz hat",
+		Category:    "fashion",
+		Description: "A stylish rizz hat",
+		Price:       decimal.NewFromInt(100),
+		Images:      []models.ProductImage{{Order: 0, Checksum: "chk1", Data: make([]byte, 10)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newID, err := db.InsertRelistedListing(t.Context(), id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := db.GetProductById(t.Context(), id, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prod.Name != "rizz hat" || prod.Status != models.LISTING_STATUS_ACTIVE || !prod.Price.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("relisted product does not match original: %+v", prod)
+	}
+
+	if len(prod.Images) != 1 {
+		t.Fatalf("got %d images, want 1", len(prod.Images))
+	}
+
+	var blobs int
+	err = pool.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_image_blob WHERE checksum='chk1'").Scan(&blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs != 1 {
+		t.Fatalf("got %d blobs for shared image, want 1", blobs)
+	}
+
+	original, err := db.GetProductById(t.Context(), id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.Status != models.LISTING_STATUS_CLOSED {
+		t.Fatalf("got status %s for the original, want %s", original.Status, models.LISTING_STATUS_CLOSED)
+	}
+
+	if _, err := db.InsertRelistedListing(t.Context(), id, pid); err == nil {
+		t.Fatal("relisted a listing that was already relisted")
+	}
+
+	var active int
+	err = pool.QueryRow(t.Context(), "SELECT COUNT(*) FROM luxora_product WHERE user_id=$1 AND status='active'", id).Scan(&active)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if active != 1 {
+		t.Fatalf("got %d active listings after relisting, want 1", active)
+	}
+
+	// a closed listing that was never relisted can be
+	_, err = pool.Exec(t.Context(), "UPDATE luxora_product SET status='closed' WHERE item_id=$1", newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastID, err := db.InsertRelistedListing(t.Context(), id, newID)
+	if err != nil {
+		t.Fatalf("expected closed listing to be relisted: %v", err)
+	}
+
+	_, err = pool.Exec(t.Context(), "UPDATE luxora_product SET sold=true WHERE item_id=$1", lastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.InsertRelistedListing(t.Context(), id, lastID); err == nil {
+		t.Fatal("relisted a sold listing")
+	}
+}
+
+func TestInsertDuplicatedListing(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := db.InsertOauthUser(t.Context(), "jack", "github", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName: "rizz hat",
+		Category: "fashion",
+		Price:    decimal.NewFromInt(100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.InsertDuplicatedListing(t.Context(), other, pid); err == nil {
+		t.Fatal("duplicated a listing owned by another user")
+	}
+
+	newID, err := db.InsertDuplicatedListing(t.Context(), id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := db.GetProductById(t.Context(), id, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prod.Status != models.LISTING_STATUS_DRAFT {
+		t.Fatalf("got status %s, want %s", prod.Status, models.LISTING_STATUS_DRAFT)
+	}
+}
+
+func TestInsertDuplicatedListingLegacyImages(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName: "rizz hat",
+		Category: "fashion",
+		Price:    decimal.NewFromInt(100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// images stored before blobs existed, with and without a checksum
+	_, err = pool.Exec(t.Context(), `
+		INSERT INTO luxora_product_image (product_id, compressed_image, checksum, sort_order) VALUES
+		($1, 'first', encode(sha256('first'), 'hex'), 0),
+		($1, 'second', NULL, 1)
+	`, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newID, err := db.InsertDuplicatedListing(t.Context(), id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteListing(t.Context(), id, pid); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := pool.Query(t.Context(), "SELECT image_id FROM luxora_product_image WHERE product_id=$1 ORDER BY sort_order", newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 2 {
+		t.Fatalf("got %d images, want 2", len(images))
+	}
+
+	for i, want := range []string{"first", "second"} {
+		image, err := db.GetImage(t.Context(), images[i], imaging.SIZE_FULL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(image.Data) != want {
+			t.Fatalf("image %d: got %q, want %q", i, image.Data, want)
+		}
+	}
 }
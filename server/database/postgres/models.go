@@ -7,6 +7,9 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// UNIQUE_VIOLATION is the SQLSTATE of an insert that conflicts with a unique constraint.
+const UNIQUE_VIOLATION = "23505"
+
 type Postgres struct {
 	Pool *pgxpool.Pool
 }
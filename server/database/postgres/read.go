@@ -3,20 +3,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
 	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/shopspring/decimal"
 )
 
-func (p *Postgres) GetOauthUserIdByProviderID(ctx context.Context, pid string) (id uuid.UUID, err error) {
+func (p *Postgres) HasRole(ctx context.Context, userID uuid.UUID, role string) (ok bool, err error) {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
-	err = p.Pool.QueryRow(ctx, "SELECT id FROM luxora_user WHERE provider_user_id = $1", pid).Scan(&id)
+	err = p.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM luxora_user_role WHERE user_id = $1 AND role = $2)", userID, role).Scan(&ok)
 	return
 }
 
@@ -27,17 +29,11 @@ func (p *Postgres) GetLastLogin(ctx context.Context, userID uuid.UUID) (LastLogi
 	return
 }
 
-func (p *Postgres) GetRefreshToken(ctx context.Context, userId uuid.UUID) (refreshToken string, err error) {
+// GetPasswordHash looks up a user who signed up with a password by their email.
+func (p *Postgres) GetPasswordHash(ctx context.Context, email string) (userID uuid.UUID, passwordHash string, err error) {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
-	err = p.Pool.QueryRow(ctx, "SELECT refresh_token FROM luxora_user WHERE id=$1", userId).Scan(&refreshToken)
-	return
-}
-
-func (p *Postgres) GetIsUsernameAndIDByProviderID(ctx context.Context, providerID string) (username string, userID uuid.UUID, err error) {
-	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
-	defer cancel()
-	err = p.Pool.QueryRow(ctx, "SELECT username, id FROM luxora_user WHERE provider_user_id=$1", providerID).Scan(&username, &userID)
+	err = p.Pool.QueryRow(ctx, "SELECT id, password_hash FROM luxora_user WHERE email = $1 AND "+PASSWORD_LOGIN, strings.ToLower(email)).Scan(&userID, &passwordHash)
 	return
 }
 
@@ -79,7 +75,75 @@ func (p *Postgres) GetBids(ctx context.Context, userID uuid.UUID, productID uuid
 	return
 }
 
-func craftGetQuery(createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, limit, offset int) (query string, params []any) {
+// imageQuery selects the images of a product without their bytes, those are served separately by GetImage.
+const imageQuery = `
+	SELECT image_id, sort_order, COALESCE(checksum, '')
+	FROM luxora_product_image
+	WHERE product_id = $1
+	ORDER BY sort_order ASC
+`
+
+// GetImage reads the bytes of an image in the given rendition size, falling back to the full size
+// image when there is no such rendition. Full size images are read from the shared blob, or the
+// inline column for images stored before blobs existed. The content type is empty for images that
+// were stored as compressed base64 text, the data is nil for images kept in a blob store.
+func (p *Postgres) GetImage(ctx context.Context, imageID uuid.UUID, size string) (image models.ProductImage, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	image.ID = imageID
+	err = p.Pool.QueryRow(ctx, `
+		SELECT
+			COALESCE(r.data, b.compressed_image, pi.compressed_image),
+			COALESCE(r.content_type, b.content_type, ''),
+			COALESCE(pi.checksum, ''),
+			pi.sort_order,
+			COALESCE(r.size, $3)
+		FROM luxora_product_image pi
+		LEFT JOIN luxora_image_blob b ON b.checksum = pi.checksum
+		LEFT JOIN luxora_image_rendition r ON r.checksum = pi.checksum AND r.size = $2
+		WHERE pi.image_id = $1
+	`, imageID, size, imaging.SIZE_FULL).Scan(&image.Data, &image.ContentType, &image.Checksum, &image.Order, &image.Size)
+	return
+}
+
+// productImagesQuery and primaryImagesQuery select the images of a page of products, in the same
+// shape as imageQuery. primaryImagesQuery only selects the first image of every product.
+const (
+	productImagesQuery = `
+	SELECT product_id, image_id, sort_order, COALESCE(checksum, '')
+	FROM luxora_product_image
+	WHERE product_id = ANY($1)
+	ORDER BY product_id, sort_order ASC
+`
+	primaryImagesQuery = `
+	SELECT DISTINCT ON (product_id) product_id, image_id, sort_order, COALESCE(checksum, '')
+	FROM luxora_product_image
+	WHERE product_id = ANY($1)
+	ORDER BY product_id, sort_order ASC
+`
+)
+
+var rangeOperators = map[string]string{
+	models.FILTER_GT:  ">",
+	models.FILTER_GTE: ">=",
+	models.FILTER_LT:  "<",
+	models.FILTER_LTE: "<=",
+}
+
+// attributeValue converts a stored attribute back into the JSON type it was created with.
+func attributeValue(valueType, text string) any {
+	switch valueType {
+	case models.ATTRIBUTE_TYPE_NUMBER:
+		return json.Number(text)
+	case models.ATTRIBUTE_TYPE_BOOLEAN:
+		return text == "true"
+	default:
+		return text
+	}
+}
+
+func craftGetQuery(userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, limit, offset int) (query string, params []any) {
 	var builder = strings.Builder{}
 
 	builder.WriteString(`
@@ -95,21 +159,44 @@ func craftGetQuery(createdBy uuid.UUID, category, searchQuery *string, startPric
 	SELECT 
 		lp.item_id,
 		lp.name,
-		lp.user_id,
+		lu.username,
 		lp.created_at,
+		lp.category,
 		lp.description,
+		lp.status,
+		lp.publish_at,
+		COALESCE(lp.condition, ''),
+		lp.verification_status,
+		lp.updated_at,
 		lpp.price,
-		lpp.currency
+		lpp.currency,
+		lpp.created
 		FROM luxora_product lp
 		JOIN latest_prices lpp ON lp.item_id = lpp.product_id
+		JOIN luxora_user lu ON lu.id = lp.user_id
 	`)
 
 	var filters []string
 	params = []any{}
 
+	// drafts are only visible to the user who created them, when they list their own listings. Every
+	// other page is the same for every user, so it can be cached once
+	if createdBy == uuid.Nil || createdBy != userID {
+		filters = append(filters, " lp.status = 'active' ")
+	}
+
 	if category != nil {
+		// a category also matches every category below it in the tree
 		params = append(params, *category)
-		filters = append(filters, fmt.Sprintf(" lp.category = $%d ", len(params)))
+		filters = append(filters, fmt.Sprintf(` lower(lp.category) IN (
+			WITH RECURSIVE subtree AS (
+				SELECT category_id, slug FROM luxora_category WHERE slug = $%[1]d::text
+				UNION ALL
+				SELECT c.category_id, c.slug FROM luxora_category c JOIN subtree s ON c.parent_id = s.category_id
+			)
+			SELECT slug FROM subtree
+			UNION SELECT $%[1]d::text
+		) `, len(params)))
 	}
 
 	if startPrice != nil {
@@ -127,19 +214,37 @@ func craftGetQuery(createdBy uuid.UUID, category, searchQuery *string, startPric
 		filters = append(filters, fmt.Sprintf(" lp.user_id = $%d ", len(params)))
 	}
 
-	if searchQuery != nil {
-		filters = append(filters, fmt.Sprintf(" similarity(lp.name, '%v') > 0.01 ORDER BY similarity(lp.name, '%v') DESC ", *searchQuery, *searchQuery))
-	}
+	for _, a := range attributes {
+		params = append(params, a.Key)
+		keyParam := len(params)
+
+		var condition string
+		if operator, ok := rangeOperators[a.Op]; ok {
+			params = append(params, a.Values[0])
+			condition = fmt.Sprintf("pa.value_number %s $%d::text::numeric", operator, len(params))
+		} else {
+			values := make([]string, len(a.Values))
+			for i, v := range a.Values {
+				values[i] = strings.ToLower(v)
+			}
+			params = append(params, values)
+			condition = fmt.Sprintf("lower(pa.value_text) = ANY($%d::text[])", len(params))
+		}
 
-	if len(filters) > 0 {
-		builder.WriteString(" WHERE ")
-		builder.WriteString(strings.Join(filters, " AND "))
+		filters = append(filters, fmt.Sprintf(" EXISTS (SELECT 1 FROM luxora_product_attribute pa WHERE pa.product_id = lp.item_id AND pa.key = $%d AND %s) ", keyParam, condition))
 	}
 
-	if searchQuery == nil {
-		builder.WriteString(" ORDER BY lp.created_at DESC ")
+	orderBy := " ORDER BY lp.created_at DESC "
+	if searchQuery != nil {
+		params = append(params, *searchQuery)
+		filters = append(filters, fmt.Sprintf(" similarity(lp.name, $%d) > 0.01 ", len(params)))
+		orderBy = fmt.Sprintf(" ORDER BY similarity(lp.name, $%d) DESC ", len(params))
 	}
 
+	builder.WriteString(" WHERE ")
+	builder.WriteString(strings.Join(filters, " AND "))
+	builder.WriteString(orderBy)
+
 	params = append(params, limit)
 	builder.WriteString(fmt.Sprintf(" LIMIT $%d ", len(params)))
 
@@ -149,7 +254,7 @@ func craftGetQuery(createdBy uuid.UUID, category, searchQuery *string, startPric
 	return builder.String(), params
 }
 
-func (p *Postgres) GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, limit, offset int) (products []models.ProductInfo, err error) {
+func (p *Postgres) GetProducts(ctx context.Context, userID, createdBy uuid.UUID, category, searchQuery *string, startPrice, endPrice *decimal.Decimal, attributes []models.AttributeFilter, primaryImageOnly bool, limit, offset int) (products []models.ProductInfo, err error) {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	tx, err := p.Pool.Begin(ctx)
@@ -167,55 +272,88 @@ func (p *Postgres) GetProducts(ctx context.Context, userID, createdBy uuid.UUID,
 
 	products = make([]models.ProductInfo, 0, limit)
 
-	query, params := craftGetQuery(createdBy, category, searchQuery, startPrice, endPrice, limit, offset)
+	query, params := craftGetQuery(userID, createdBy, category, searchQuery, startPrice, endPrice, attributes, limit, offset)
 
 	rows, err := tx.Query(ctx, query, params...)
 	if err != nil {
 		return nil, err
 	}
-	var (
-		createdByID uuid.UUID
-		product     models.ProductInfo
-	)
-	
+	var product models.ProductInfo
 	for rows.Next() {
-
-		if category != nil {
-			product.Category = *category
-		}
-
-		err = rows.Scan(&product.ItemID, &product.Name, &createdByID, &product.CreatedAt, &product.Description, &product.Price, &product.Currency)
+		err = rows.Scan(&product.ItemID, &product.Name, &product.CreatedBy, &product.CreatedAt, &product.Category, &product.Description, &product.Status, &product.PublishAt, &product.Condition, &product.VerificationStatus, &product.UpdatedAt, &product.Price, &product.Currency, &product.PriceUpdatedAt)
 		if err != nil {
+			rows.Close()
 			return nil, err
 		}
+		product.Verified = product.VerificationStatus == models.VERIFICATION_STATUS_VERIFIED
 
-		err = p.Pool.QueryRow(ctx, "SELECT username FROM luxora_user WHERE id=$1", createdByID).Scan(&product.CreatedBy)
+		products = append(products, product)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(products))
+	index := make(map[uuid.UUID]int, len(products))
+	for i := range products {
+		ids[i] = products[i].ItemID
+		index[products[i].ItemID] = i
+		products[i].Attributes = map[string]any{}
+	}
+
+	attrRows, err := tx.Query(ctx, "SELECT product_id, key, value_type, value_text FROM luxora_product_attribute WHERE product_id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for attrRows.Next() {
+		var (
+			productID             uuid.UUID
+			key, valueType, value string
+		)
+
+		err = attrRows.Scan(&productID, &key, &valueType, &value)
 		if err != nil {
+			attrRows.Close()
 			return nil, err
 		}
+		products[index[productID]].Attributes[key] = attributeValue(valueType, value)
+	}
+	attrRows.Close()
 
-		products = append(products, product)
+	// images of the whole page come from one query instead of one per product
+	query = productImagesQuery
+	if primaryImageOnly {
+		query = primaryImagesQuery
 	}
-	rows.Close()
 
-	var image = models.ProductImage{}
 	for i := range products {
 		products[i].Images = make([]models.ProductImage, 0, 3)
+	}
 
-		rows, err := tx.Query(ctx, "SELECT compressed_image, sort_order FROM luxora_product_image WHERE product_id=$1 ORDER BY sort_order ASC", products[i].ItemID)
+	imageRows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer imageRows.Close()
+
+	for imageRows.Next() {
+		var (
+			productID uuid.UUID
+			image     models.ProductImage
+		)
+
+		err = imageRows.Scan(&productID, &image.ID, &image.Order, &image.Checksum)
 		if err != nil {
-			continue
+			return nil, err
 		}
 
-		for rows.Next() {
-			err = rows.Scan(&image.CompressedImage, &image.Order)
-			if err != nil {
-				continue
-			}
+		products[index[productID]].Images = append(products[index[productID]].Images, image)
+	}
 
-			products[i].Images = append(products[i].Images, image)
-		}
-		rows.Close()
+	if err = imageRows.Err(); err != nil {
+		return nil, err
 	}
 
 	return products, nil
@@ -225,12 +363,12 @@ func (p *Postgres) GetUserDetails(ctx context.Context, userID uuid.UUID) (detail
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 	details = models.UserDetails{}
-	err = p.Pool.QueryRow(ctx, "SELECT email, username, profile_picture_link FROM luxora_user WHERE id=$1", userID).Scan(&details.Email, &details.Username, &details.ProfileImageLink)
+	err = p.Pool.QueryRow(ctx, "SELECT email, email_verified, username, COALESCE(profile_picture_link, '') FROM luxora_user WHERE id=$1", userID).Scan(&details.Email, &details.EmailVerified, &details.Username, &details.ProfileImageLink)
 	details.UserID = userID
 	return
 }
 
-func (p *Postgres) GetProductById(ctx context.Context, productID uuid.UUID) (product models.ProductInfo, err error) {
+func (p *Postgres) GetProductById(ctx context.Context, userID, productID uuid.UUID) (product models.ProductInfo, err error) {
 	if productID == uuid.Nil {
 		return product, fmt.Errorf("invalid productID")
 	}
@@ -264,18 +402,25 @@ func (p *Postgres) GetProductById(ctx context.Context, productID uuid.UUID) (pro
 		lp.category,
 		lp.created_at,
 		lp.description,
+		lp.status,
+		lp.publish_at,
+		COALESCE(lp.condition, ''),
+		lp.verification_status,
+		lp.updated_at,
 		lpp.price,
-		lpp.currency
+		lpp.currency,
+		lpp.created
 		FROM luxora_product lp
-		JOIN latest_prices lpp ON lp.item_id = lpp.product_id WHERE lp.item_id = $1
+		JOIN latest_prices lpp ON lp.item_id = lpp.product_id
+		WHERE lp.item_id = $1 AND (lp.status = 'active' OR lp.user_id = $2)
 	`
 
 	product = models.ProductInfo{}
 	var createdbyID uuid.UUID
 	product.ItemID = productID
-	productRow := tx.QueryRow(ctx, query, productID)
+	productRow := tx.QueryRow(ctx, query, productID, userID)
 
-	err = productRow.Scan(&product.Name, &createdbyID, &product.Category, &product.CreatedAt, &product.Description, &product.Price, &product.Currency)
+	err = productRow.Scan(&product.Name, &createdbyID, &product.Category, &product.CreatedAt, &product.Description, &product.Status, &product.PublishAt, &product.Condition, &product.VerificationStatus, &product.UpdatedAt, &product.Price, &product.Currency, &product.PriceUpdatedAt)
 	if err != nil {
 		return product, err
 	}
@@ -285,16 +430,41 @@ func (p *Postgres) GetProductById(ctx context.Context, productID uuid.UUID) (pro
 		return product, err
 	}
 
+	product.Verified = product.VerificationStatus == models.VERIFICATION_STATUS_VERIFIED
+	if product.VerificationStatus != models.VERIFICATION_STATUS_UNVERIFIED {
+		product.Verification, err = latestVerification(ctx, tx, product.ItemID)
+		if err != nil {
+			return product, err
+		}
+	}
+
+	product.Attributes = map[string]any{}
+	attrRows, err := tx.Query(ctx, "SELECT key, value_type, value_text FROM luxora_product_attribute WHERE product_id=$1", product.ItemID)
+	if err != nil {
+		return product, err
+	}
+
+	for attrRows.Next() {
+		var key, valueType, value string
+		err = attrRows.Scan(&key, &valueType, &value)
+		if err != nil {
+			attrRows.Close()
+			return product, err
+		}
+		product.Attributes[key] = attributeValue(valueType, value)
+	}
+	attrRows.Close()
+
 	product.Images = []models.ProductImage{}
 
-	rows, err := tx.Query(ctx, "SELECT compressed_image, sort_order FROM luxora_product_image WHERE product_id=$1 ORDER BY sort_order ASC", product.ItemID)
+	rows, err := tx.Query(ctx, imageQuery, product.ItemID)
 	if err != nil {
 		return product, err
 	}
 
 	for rows.Next() {
 		var image = models.ProductImage{}
-		err = rows.Scan(&image.CompressedImage, &image.Order)
+		err = rows.Scan(&image.ID, &image.Order, &image.Checksum)
 		if err != nil {
 			continue
 		}
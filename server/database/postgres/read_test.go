@@ -27,7 +27,7 @@ func TestGetUserIdByUsername(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	uid, err := db.GetOauthUserIdByProviderID(t.Context(), "hello")
+	uid, err := db.GetUserIdByIdentity(t.Context(), "github", "hello")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,7 +87,7 @@ func TestGetLastLogin(t *testing.T) {
 		t.Fatal(err)
 	}
 }
-func TestGetIsUsernameAndIDByProviderID(t *testing.T) {
+func TestGetUserIdByIdentity(t *testing.T) {
 	pool, clean, err := testutils.SetupTestPostgresDB("")
 	if err != nil {
 		t.Fatal(err)
@@ -101,18 +101,29 @@ func TestGetIsUsernameAndIDByProviderID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	username, id, err := db.GetIsUsernameAndIDByProviderID(t.Context(), "hello")
+	// provider ids are only unique per provider
+	other, err := db.InsertOauthUser(t.Context(), "Anonymous", "google", "hello", "")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if username != "diddy" {
-		t.Fatal("username mismatch")
+	id, err := db.GetUserIdByIdentity(t.Context(), "github", "hello")
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	if id != uzid {
 		t.Fatal("user id mismatch")
 	}
+
+	id, err = db.GetUserIdByIdentity(t.Context(), "google", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != other {
+		t.Fatal("user id mismatch")
+	}
 }
 
 func TestGetHighestBid(t *testing.T) {
@@ -140,16 +151,16 @@ func TestGetHighestBid(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -214,16 +225,16 @@ func TestGetBids(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -280,8 +291,8 @@ func TestGetProducts(t *testing.T) {
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
-			{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)},
-			{Image: "img2", Order: 1, Checksum: "chk2", CompressedImage: make([]byte, 10)},
+			{Image: "img1", Order: 0, Checksum: "chk1", Data: make([]byte, 10)},
+			{Image: "img2", Order: 1, Checksum: "chk2", Data: make([]byte, 10)},
 		},
 	}
 
@@ -290,7 +301,7 @@ func TestGetProducts(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	prods, err := db.GetProducts(ctx, id, uuid.Nil, nil, nil, nil, nil, 40, 0)
+	prods, err := db.GetProducts(ctx, id, uuid.Nil, nil, nil, nil, nil, nil, false, 40, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -301,46 +312,125 @@ func TestGetProducts(t *testing.T) {
 }
 
 
-func BenchmarkGetProducts(b *testing.B) {
-	ctx, cancel := context.WithTimeout(b.Context(), 10*time.Second)
+func TestGetProductsImages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
 	defer cancel()
 
-	pool, _, err := testutils.SetupTestPostgresDB("")
+	pool, clean, err := testutils.SetupTestPostgresDB("")
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
+	defer clean()
 
 	db := Postgres{Pool: pool}
 
-	id, err := db.InsertOauthUser(ctx, "diddy", "github", "hwllo", "")
+	for i, name := range []string{"diddy", "drake"} {
+		id, err := db.InsertOauthUser(ctx, name, "github", name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		images := []models.ProductImage{}
+		for order := range 3 + i {
+			images = append(images, models.ProductImage{Order: order, Checksum: fmt.Sprintf("%s-%d", name, order), Data: make([]byte, 10)})
+		}
+
+		_, err = db.InsertListing(ctx, id, &models.Product{ItemName: "rizz", Category: "rozz", Price: decimal.NewFromInt(10), Images: images})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, primaryImageOnly := range []bool{false, true} {
+		prods, err := db.GetProducts(ctx, uuid.Nil, uuid.Nil, nil, nil, nil, nil, nil, primaryImageOnly, 40, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(prods) != 2 {
+			t.Fatalf("got %d products, want 2", len(prods))
+		}
+
+		for _, p := range prods {
+			want := 3
+			if p.CreatedBy == "drake" {
+				want = 4
+			} else if p.CreatedBy != "diddy" {
+				t.Fatalf("unexpected creator %q", p.CreatedBy)
+			}
+			if primaryImageOnly {
+				want = 1
+			}
+
+			if len(p.Images) != want {
+				t.Fatalf("%s has %d images, want %d (primary only %v)", p.CreatedBy, len(p.Images), want, primaryImageOnly)
+			}
+
+			for i, image := range p.Images {
+				if image.Order != i {
+					t.Fatalf("image %d of %s has order %d", i, p.CreatedBy, image.Order)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkGetProducts lists pages of products that each have several images, from a handful of sellers.
+func BenchmarkGetProducts(b *testing.B) {
+	ctx, cancel := context.WithTimeout(b.Context(), 5*time.Minute)
+	defer cancel()
+
+	pool, clean, err := testutils.SetupTestPostgresDB("")
 	if err != nil {
 		b.Fatal(err)
 	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	users := []uuid.UUID{}
+	for i := range 10 {
+		id, err := db.InsertOauthUser(ctx, fmt.Sprintf("seller%d", i), "github", fmt.Sprintf("seller%d", i), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		users = append(users, id)
+	}
+
+	for i := range 200 {
+		images := []models.ProductImage{}
+		for order := range 5 {
+			images = append(images, models.ProductImage{Order: order, Checksum: fmt.Sprintf("chk%d-%d", i, order), Data: make([]byte, 10)})
+		}
 
-	for range 100 {
-		price := decimal.NewFromInt(0)
 		product := &models.Product{
 			ItemName:    "rizz",
 			Category:    "rozz",
 			Description: "knaye the goat",
-			Price:       price,
-			Images: []models.ProductImage{
-				{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)},
-				{Image: "img2", Order: 1, Checksum: "chk2", CompressedImage: make([]byte, 10)},
-			},
+			Price:       decimal.NewFromInt(int64(i)),
+			Images:      images,
 		}
 
-		_, err := db.InsertListing(ctx, id, product)
+		_, err := db.InsertListing(ctx, users[i%len(users)], product)
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 
-	b.ResetTimer()
-	for b.Loop() {
-		_, err := db.GetProducts(ctx, id, uuid.Nil, nil, nil, nil, nil, 40, 0)
-		if err != nil {
-			b.Fatal(err)
+	for _, limit := range []int{12, 40} {
+		for _, primaryImageOnly := range []bool{false, true} {
+			b.Run(fmt.Sprintf("limit=%d/primary=%v", limit, primaryImageOnly), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					prods, err := db.GetProducts(ctx, users[0], uuid.Nil, nil, nil, nil, nil, nil, primaryImageOnly, limit, 0)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(prods) != limit {
+						b.Fatalf("got %d products, want %d", len(prods), limit)
+					}
+				}
+			})
 		}
 	}
 }
@@ -369,28 +459,28 @@ func TestGetSimiliarProductsWith(t *testing.T) {
 			Category:    "fashion",
 			Description: "A stylish rizz hat",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "rizz shirt",
 			Category:    "fashion",
 			Description: "A fashionable shirt",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "charizma shirt",
 			Category:    "fashion",
 			Description: "A fashionable shirt",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "basketball",
 			Category:    "sports",
 			Description: "Standard basketball",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img3", Order: 0, Checksum: "chk3", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img3", Order: 0, Checksum: "chk3", Data: make([]byte, 10)}},
 		},
 	}
 
@@ -403,7 +493,7 @@ func TestGetSimiliarProductsWith(t *testing.T) {
 
 	t.Run("search matching term", func(t *testing.T) {
 		searchQ := "rozz"
-		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, 40, 0)
+		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, nil, false, 40, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -421,7 +511,7 @@ func TestGetSimiliarProductsWith(t *testing.T) {
 
 	t.Run("ball", func(t *testing.T) {
 		searchQ := "ball"
-		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, 40, 0)
+		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, nil, false, 40, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -439,7 +529,7 @@ func TestGetSimiliarProductsWith(t *testing.T) {
 
 	t.Run("search non-matching term", func(t *testing.T) {
 		searchQ := "nonexistent"
-		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, 40, 0)
+		results, err := db.GetProducts(ctx, id, uuid.Nil, nil, &searchQ, nil, nil, nil, false, 40, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -477,8 +567,8 @@ func TestGetProductsById(t *testing.T) {
 		Description: "knaye the goat",
 		Price:       price,
 		Images: []models.ProductImage{
-			{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)},
-			{Image: "img2", Order: 1, Checksum: "chk2", CompressedImage: make([]byte, 10)},
+			{Image: "img1", Order: 0, Checksum: "chk1", Data: make([]byte, 10)},
+			{Image: "img2", Order: 1, Checksum: "chk2", Data: make([]byte, 10)},
 		},
 	}
 
@@ -488,10 +578,79 @@ func TestGetProductsById(t *testing.T) {
 	}
 
 	t.Log("Fetching products")
-	prod, err := db.GetProductById(ctx, pid)
+	prod, err := db.GetProductById(ctx, id, pid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	fmt.Println(prod)
 }
+
+func TestGetProductsHidesDrafts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	owner, err := db.InsertOauthUser(ctx, "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := db.InsertOauthUser(ctx, "jack", "github", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(ctx, owner, &models.Product{
+		ItemName: "rizz",
+		Category: "rozz",
+		Price:    decimal.NewFromInt(0),
+		Status:   models.LISTING_STATUS_DRAFT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prods, err := db.GetProducts(ctx, other, uuid.Nil, nil, nil, nil, nil, nil, false, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 0 {
+		t.Fatal("draft listing visible to another user")
+	}
+
+	if _, err := db.GetProductById(ctx, other, pid); err == nil {
+		t.Fatal("draft listing fetched by another user")
+	}
+
+	prods, err = db.GetProducts(ctx, owner, owner, nil, nil, nil, nil, nil, false, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 1 || prods[0].Status != models.LISTING_STATUS_DRAFT {
+		t.Fatal("draft listing not visible to its owner")
+	}
+
+	// pages other than the owner's own listings are the same for everyone
+	prods, err = db.GetProducts(ctx, owner, uuid.Nil, nil, nil, nil, nil, nil, false, 40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prods) != 0 {
+		t.Fatal("draft listing visible outside its owner's own listings")
+	}
+
+	if _, err := db.GetProductById(ctx, owner, pid); err != nil {
+		t.Fatal(err)
+	}
+}
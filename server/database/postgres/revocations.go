@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// InsertRevocation revokes a token, session or user for ttl, after which the tokens it covers have
+// expired anyway. Revoking the same subject again starts over.
+func (p *Postgres) InsertRevocation(ctx context.Context, kind, subject string, ttl time.Duration) (revocation models.Revocation, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	err = p.Pool.QueryRow(ctx, `
+		INSERT INTO luxora_revocation (kind, subject, revoked_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (kind, subject) DO UPDATE SET revoked_at = EXCLUDED.revoked_at, expires_at = EXCLUDED.expires_at
+		RETURNING kind, subject, revoked_at, expires_at
+	`, kind, subject, ttl.Seconds()).Scan(&revocation.Kind, &revocation.Subject, &revocation.RevokedAt, &revocation.ExpiresAt)
+	return revocation, err
+}
+
+// GetRevocations returns the revocations made after since that have not expired.
+func (p *Postgres) GetRevocations(ctx context.Context, since time.Time) (revocations []models.Revocation, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, "SELECT kind, subject, revoked_at, expires_at FROM luxora_revocation WHERE revoked_at > $1 AND expires_at > NOW()", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revocation models.Revocation
+		if err := rows.Scan(&revocation.Kind, &revocation.Subject, &revocation.RevokedAt, &revocation.ExpiresAt); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+
+	return revocations, rows.Err()
+}
+
+func (p *Postgres) DeleteExpiredRevocations(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err = p.Pool.Exec(ctx, "DELETE FROM luxora_revocation WHERE expires_at <= NOW()")
+	return err
+}
+
+func (p *Postgres) IsSuspended(ctx context.Context, userID uuid.UUID) (suspended bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	err = p.Pool.QueryRow(ctx, "SELECT suspended_at IS NOT NULL FROM luxora_user WHERE id = $1", userID).Scan(&suspended)
+	return
+}
+
+// SetSuspended suspends a user or lifts the suspension, a suspended user can not log in or refresh
+// tokens.
+func (p *Postgres) SetSuspended(ctx context.Context, userID uuid.UUID, suspended bool) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	t, err := p.Pool.Exec(ctx, "UPDATE luxora_user SET suspended_at = CASE WHEN $1 THEN COALESCE(suspended_at, NOW()) ELSE NULL END WHERE id = $2", suspended, userID)
+	if err != nil {
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		return database.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// FOREIGN_KEY_VIOLATION is the SQLSTATE of a row that references a row that does not exist.
+const FOREIGN_KEY_VIOLATION = "23503"
+
+func (p *Postgres) GetRoles(ctx context.Context, userID uuid.UUID) (roles []string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, "SELECT role FROM luxora_user_role WHERE user_id = $1 ORDER BY role", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// updateRole grants or revokes a role and records it in the audit log, changed is false when the
+// user already had or lacked the role. An actorID of uuid.Nil records no actor.
+func (p *Postgres) updateRole(ctx context.Context, actorID, userID uuid.UUID, role, action string) (changed bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	query := "INSERT INTO luxora_user_role (user_id, role) VALUES ($1, $2) ON CONFLICT (user_id, role) DO NOTHING"
+	if action == models.ROLE_ACTION_REVOKE {
+		query = "DELETE FROM luxora_user_role WHERE user_id = $1 AND role = $2"
+	}
+
+	t, err := tx.Exec(ctx, query, userID, role)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == FOREIGN_KEY_VIOLATION {
+		return false, database.ErrUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if t.RowsAffected() == 0 {
+		return false, tx.Commit(ctx)
+	}
+
+	var actor *uuid.UUID
+	if actorID != uuid.Nil {
+		actor = &actorID
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO luxora_role_audit (user_id, role, action, actor_id) VALUES ($1, $2, $3, $4)", userID, role, action, actor)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (p *Postgres) GrantRole(ctx context.Context, actorID, userID uuid.UUID, role string) (changed bool, err error) {
+	return p.updateRole(ctx, actorID, userID, role, models.ROLE_ACTION_GRANT)
+}
+
+func (p *Postgres) RevokeRole(ctx context.Context, actorID, userID uuid.UUID, role string) (changed bool, err error) {
+	return p.updateRole(ctx, actorID, userID, role, models.ROLE_ACTION_REVOKE)
+}
+
+// GetRoleChanges returns the role audit log newest first, only of userID unless it is uuid.Nil.
+func (p *Postgres) GetRoleChanges(ctx context.Context, userID uuid.UUID, limit, offset int) (changes []models.RoleChange, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT audit_id, user_id, role, action, actor_id, changed_at
+		FROM luxora_role_audit
+		WHERE $1 = '00000000-0000-0000-0000-000000000000'::uuid OR user_id = $1
+		ORDER BY changed_at DESC, audit_id
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes = []models.RoleChange{}
+	for rows.Next() {
+		var c models.RoleChange
+		if err := rows.Scan(&c.AuditID, &c.UserID, &c.Role, &c.Action, &c.ActorID, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertSession starts a session on a new device, the caller picks the session id so it can be put
+// in the tokens before they are stored. Expired sessions of the user are cleaned up on the way.
+func (p *Postgres) InsertSession(ctx context.Context, session *models.Session) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Pool.Exec(ctx, "DELETE FROM luxora_session WHERE user_id = $1 AND expires_at <= NOW()", session.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Pool.Exec(ctx, `
+		INSERT INTO luxora_session (session_id, user_id, token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, session.SessionID, session.UserID, session.TokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt)
+	return err
+}
+
+// RotateSession replaces the refresh token of a session, which only works with the token it holds
+// now. The device the session was last used from is updated with it.
+//
+// The tokens a session had before are remembered. When one of them is presented again, either it
+// was stolen or the thief already used it, so the whole session is revoked and ErrTokenReused is
+// returned.
+func (p *Postgres) RotateSession(ctx context.Context, userID, sessionID uuid.UUID, oldTokenHash string, session *models.Session) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	// the row is locked so two refreshes with the same token can not both rotate it
+	var current string
+	var expired bool
+	err = tx.QueryRow(ctx, "SELECT token_hash, expires_at <= NOW() FROM luxora_session WHERE session_id = $1 AND user_id = $2 FOR UPDATE", sessionID, userID).Scan(&current, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if current != oldTokenHash {
+		var reused bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM luxora_session_rotated_token WHERE session_id = $1 AND token_hash = $2)", sessionID, oldTokenHash).Scan(&reused)
+		if err != nil {
+			return err
+		}
+
+		if !reused {
+			return database.ErrSessionNotFound
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM luxora_session WHERE session_id = $1", sessionID)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			return err
+		}
+
+		return database.ErrTokenReused
+	}
+
+	if expired {
+		return database.ErrSessionNotFound
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO luxora_session_rotated_token (token_hash, session_id) VALUES ($1, $2)", oldTokenHash, sessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_session
+		SET token_hash = $1, user_agent = $2, ip_address = $3, expires_at = $4, last_used_at = NOW()
+		WHERE session_id = $5
+	`, session.TokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetSessions lists the devices a user is logged in on, most recently used first.
+func (p *Postgres) GetSessions(ctx context.Context, userID uuid.UUID) (sessions []models.Session, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT session_id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM luxora_session
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions = []models.Session{}
+	for rows.Next() {
+		session := models.Session{UserID: userID}
+		if err := rows.Scan(&session.SessionID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession logs a single device out.
+func (p *Postgres) DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	t, err := p.Pool.Exec(ctx, "DELETE FROM luxora_session WHERE session_id = $1 AND user_id = $2", sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		return database.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteSessions logs a user out on every device.
+func (p *Postgres) DeleteSessions(ctx context.Context, userID uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Pool.Exec(ctx, "DELETE FROM luxora_session WHERE user_id = $1", userID)
+	return err
+}
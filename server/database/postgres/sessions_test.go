@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+)
+
+func TestRotateSession(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(1 * time.Hour)
+	sessionID := uuid.New()
+	err = db.InsertSession(t.Context(), &models.Session{SessionID: sessionID, UserID: id, TokenHash: "first", UserAgent: "laptop", ExpiresAt: exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RotateSession(t.Context(), id, sessionID, "second", &models.Session{TokenHash: "third", ExpiresAt: exp}); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("unknown token: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+
+	if err := db.RotateSession(t.Context(), uuid.New(), sessionID, "first", &models.Session{TokenHash: "second", ExpiresAt: exp}); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("session of another user: got %v, want %v", err, database.ErrSessionNotFound)
+	}
+
+	if err := db.RotateSession(t.Context(), id, sessionID, "first", &models.Session{TokenHash: "second", UserAgent: "phone", ExpiresAt: exp}); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := db.GetSessions(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].UserAgent != "phone" {
+		t.Fatalf("got %+v", sessions)
+	}
+
+	if err := db.RotateSession(t.Context(), id, sessionID, "first", &models.Session{TokenHash: "third", ExpiresAt: exp}); !errors.Is(err, database.ErrTokenReused) {
+		t.Fatalf("reused token: got %v, want %v", err, database.ErrTokenReused)
+	}
+
+	sessions, err = db.GetSessions(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expected the session to be revoked, got %+v", sessions)
+	}
+}
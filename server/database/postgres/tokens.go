@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// InsertUserToken records a single-use token sent to a user. Tokens of the same type sent to the
+// user earlier can no longer be used, only the most recent email works.
+func (p *Postgres) InsertUserToken(ctx context.Context, userID uuid.UUID, tokenType uint8, tokenHash string, expiresAt time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_user_token SET used_at = NOW() WHERE user_id = $1 AND token_type = $2 AND used_at IS NULL", userID, tokenType)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO luxora_user_token (token_hash, user_id, token_type, expires_at) VALUES ($1, $2, $3, $4)", tokenHash, userID, tokenType, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// useUserToken marks a token as used, failing with ErrTokenInvalid when it can not be used.
+func useUserToken(ctx context.Context, tx pgx.Tx, userID uuid.UUID, tokenType uint8, tokenHash string) error {
+	t, err := tx.Exec(ctx, `
+		UPDATE luxora_user_token SET used_at = NOW()
+		WHERE token_hash = $1 AND user_id = $2 AND token_type = $3 AND used_at IS NULL AND expires_at > NOW()
+	`, tokenHash, userID, tokenType)
+	if err != nil {
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		return database.ErrTokenInvalid
+	}
+
+	return nil
+}
+
+// withUserToken uses a token and runs fn in the same transaction, so the token is only used up
+// when fn succeeds.
+func (p *Postgres) withUserToken(ctx context.Context, userID uuid.UUID, tokenType uint8, tokenHash string, fn func(ctx context.Context, tx pgx.Tx) error) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	err = useUserToken(ctx, tx, userID, tokenType, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// VerifyEmail marks the email of a user as verified, as long as it is still the email the token was
+// sent to.
+func (p *Postgres) VerifyEmail(ctx context.Context, userID uuid.UUID, tokenHash, email string) (err error) {
+	return p.withUserToken(ctx, userID, token.EMAIL_VERIFICATION_TOKEN, tokenHash, func(ctx context.Context, tx pgx.Tx) error {
+		t, err := tx.Exec(ctx, "UPDATE luxora_user SET email_verified = true WHERE id = $1 AND email = $2", userID, email)
+		if err != nil {
+			return err
+		}
+
+		if t.RowsAffected() != 1 {
+			return database.ErrTokenInvalid
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword sets a new password and logs the user out everywhere, anyone who knew the old
+// password should not stay logged in.
+func (p *Postgres) ResetPassword(ctx context.Context, userID uuid.UUID, tokenHash, passwordHash string) (err error) {
+	return p.withUserToken(ctx, userID, token.PASSWORD_RECOVERY_TOKEN, tokenHash, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE luxora_user SET password_hash = $1 WHERE id = $2", passwordHash, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM luxora_session WHERE user_id = $1", userID)
+		return err
+	})
+}
+
+// ChangeEmail replaces the email of a user with the new address the token was sent to, which is
+// verified by the user opening the link.
+func (p *Postgres) ChangeEmail(ctx context.Context, userID uuid.UUID, tokenHash, email string) (err error) {
+	return p.withUserToken(ctx, userID, token.UPDATE_EMAIL_TOKEN, tokenHash, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE luxora_user SET email = $1, email_verified = true WHERE id = $2", email, userID)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == UNIQUE_VIOLATION {
+			return database.ErrUserExists
+		}
+		return err
+	})
+}
@@ -2,19 +2,28 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 )
 
-func (p *Postgres) UpdateRefreshToken(ctx context.Context, userId uuid.UUID, refreshToken string) (err error) {
+func (p *Postgres) UpdateLastLogin(ctx context.Context, userID uuid.UUID) (err error) {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
-	_, err = p.Pool.Exec(ctx, "UPDATE luxora_user SET refresh_token=$1 WHERE id=$2", refreshToken, userId)
+	_, err = p.Pool.Exec(ctx, "UPDATE luxora_user SET last_login=NOW() WHERE id=$1", userID)
+	return
+}
+
+func (p *Postgres) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	_, err = p.Pool.Exec(ctx, "UPDATE luxora_user SET password_hash=$1 WHERE id=$2", passwordHash, userID)
 	return
 }
 
@@ -59,12 +68,18 @@ func (p *Postgres) UpdateItemSoldViaCheckout(ctx context.Context, buyerID uuid.U
 		return err
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE luxora_product SET sold=$1, sold_to_user_id=$2 WHERE item_id=ANY($3)", true, buyerID, cart.Products)
+	t, err := tx.Exec(ctx, "UPDATE luxora_product SET sold=$1, sold_to_user_id=$2 WHERE item_id=ANY($3) AND status='active' AND sold IS NOT TRUE", true, buyerID, cart.Products)
 	if err != nil {
 		tx.Rollback(ctx)
 		return err
 	}
 
+	// the whole cart is bought or nothing is
+	if t.RowsAffected() != int64(len(cart.Products)) {
+		tx.Rollback(ctx)
+		return fmt.Errorf("some items in the cart are not for sale")
+	}
+
 	return tx.Commit(ctx)
 }
 
@@ -91,14 +106,196 @@ func (p *Postgres) UpdateItemListing(ctx context.Context, userID uuid.UUID, upda
 		args = append(args, update.Name)
 		queries = append(queries, fmt.Sprintf(" name=$%v", len(args)))
 	}
+	if update.Condition != "" {
+		args = append(args, update.Condition)
+		queries = append(queries, fmt.Sprintf(" condition=$%v", len(args)))
+	}
+
+	if len(queries) == 0 {
+		if update.AttributeValues == nil {
+			return fmt.Errorf("no fields to update")
+		}
+		// only the attributes change, the listing is still touched so its ETag changes
+		queries = append(queries, " updated_at=NOW()")
+	}
 
 	builder.WriteString(strings.Join(queries, ","))
-	args = append(args, userID)
-	builder.WriteString(fmt.Sprintf(" WHERE item_id=$%v", len(args)))
+	args = append(args, update.Id, userID)
+	builder.WriteString(fmt.Sprintf(" WHERE item_id=$%v AND user_id=$%v", len(args)-1, len(args)))
 
-	fmt.Println(builder.String())
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
 
-	_, err = p.Pool.Exec(ctx, builder.String(), args...)
+	t, err := tx.Exec(ctx, builder.String(), args...)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
 
-	return
+	if t.RowsAffected() != 1 {
+		tx.Rollback(ctx)
+		return fmt.Errorf("no listing found to update")
+	}
+
+	err = resetVerification(ctx, tx, update.Id)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	// the attributes were validated against the listing's category, they are replaced as a whole
+	if update.AttributeValues != nil {
+		_, err = tx.Exec(ctx, "DELETE FROM luxora_product_attribute WHERE product_id=$1", update.Id)
+		if err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		for _, a := range update.AttributeValues {
+			_, err = tx.Exec(ctx, "INSERT INTO luxora_product_attribute (product_id, key, value_type, value_text, value_number) VALUES ($1, $2, $3, $4, $5)", update.Id, a.Key, a.Type, a.Text, a.Number)
+			if err != nil {
+				tx.Rollback(ctx)
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) PublishListing(ctx context.Context, userID uuid.UUID, productID uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	t, err := p.Pool.Exec(ctx, "UPDATE luxora_product SET status='active', publish_at=NULL WHERE item_id=$1 AND user_id=$2 AND status='draft'", productID, userID)
+	if err != nil {
+		return err
+	}
+
+	if t.RowsAffected() != 1 {
+		return fmt.Errorf("no draft listing found to publish")
+	}
+
+	return nil
+}
+
+func (p *Postgres) PublishScheduledListings(ctx context.Context, now time.Time) (published int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	t, err := p.Pool.Exec(ctx, "UPDATE luxora_product SET status='active', publish_at=NULL WHERE status='draft' AND publish_at IS NOT NULL AND publish_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.RowsAffected(), nil
+}
+
+// ReplaceProductImage swaps an image of a listing owned by userID for a new one in the same position.
+// The replacement gets a new image ID, images are cached as immutable so the old URL can not change.
+func (p *Postgres) ReplaceProductImage(ctx context.Context, userID, productID, imageID uuid.UUID, image *models.ProductImage) (newID uuid.UUID, order int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	err = lockListingImages(ctx, tx, userID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	err = tx.QueryRow(ctx, "SELECT sort_order FROM luxora_product_image WHERE image_id=$1 AND product_id=$2", imageID, productID).Scan(&order)
+	if err != nil {
+		tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, 0, fmt.Errorf("image not found on listing")
+		}
+		return uuid.Nil, 0, err
+	}
+
+	err = insertImageBlob(ctx, tx, image)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	// inserting before deleting keeps a blob shared by both images referenced throughout
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_product_image (product_id, checksum, sort_order) VALUES ($1, $2, $3) RETURNING image_id", productID, image.Checksum, order).Scan(&newID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM luxora_product_image WHERE image_id=$1", imageID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	err = resetVerification(ctx, tx, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, 0, err
+	}
+
+	return newID, order, tx.Commit(ctx)
+}
+
+// UpdateImageOrder sets the order of the images of a listing owned by userID. imageIDs has to hold
+// every image of the listing exactly once, the first image gets sort order 0.
+func (p *Postgres) UpdateImageOrder(ctx context.Context, userID, productID uuid.UUID, imageIDs []uuid.UUID) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = lockListingImages(ctx, tx, userID, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	var matched, total int
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE image_id = ANY($2)),
+			COUNT(*)
+		FROM luxora_product_image
+		WHERE product_id = $1
+	`, productID, imageIDs).Scan(&matched, &total)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if matched != total || len(imageIDs) != total {
+		tx.Rollback(ctx)
+		return fmt.Errorf("the new order has to list every image of the listing exactly once")
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE luxora_product_image pi
+		SET sort_order = o.position - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(image_id, position)
+		WHERE pi.image_id = o.image_id AND pi.product_id = $1
+	`, productID, imageIDs)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	err = resetVerification(ctx, tx, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/pkg/models"
@@ -10,26 +11,6 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-func TestUpdateRefreshToken(t *testing.T) {
-	pool, clean, err := testutils.SetupTestPostgresDB("")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer clean()
-
-	db := Postgres{Pool: pool}
-	id, err := db.InsertUser(t.Context(), "diddy", "email@gmail.diddy.com", "github", "")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = db.UpdateRefreshToken(t.Context(), id, "higga")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-}
-
 func TestUpdateItemSoldViaBid(t *testing.T) {
 	pool, clean, err := testutils.SetupTestPostgresDB("")
 	if err != nil {
@@ -55,16 +36,16 @@ func TestUpdateItemSoldViaBid(t *testing.T) {
 		Price:       price,
 		Images: []models.ProductImage{
 			{
-				Image:           "wlieblwelkjhe",
-				Order:           0,
-				Checksum:        "slkdfkljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "wlieblwelkjhe",
+				Order:    0,
+				Checksum: "slkdfkljsfd",
+				Data:     make([]byte, 10),
 			},
 			{
-				Image:           "sdvsrtvs",
-				Order:           1,
-				Checksum:        "slkdfksgvsljsfd",
-				CompressedImage: make([]byte, 10),
+				Image:    "sdvsrtvs",
+				Order:    1,
+				Checksum: "slkdfksgvsljsfd",
+				Data:     make([]byte, 10),
 			},
 		},
 	}
@@ -141,28 +122,28 @@ func TestUpdateItemSoldViaCheckout(t *testing.T) {
 			Category:    "fashion",
 			Description: "A stylish rizz hat",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "rizz shirt",
 			Category:    "fashion",
 			Description: "A fashionable shirt",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "charizma shirt",
 			Category:    "fashion",
 			Description: "A fashionable shirt",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img2", Order: 0, Checksum: "chk2", Data: make([]byte, 10)}},
 		},
 		{
 			ItemName:    "basketball",
 			Category:    "sports",
 			Description: "Standard basketball",
 			Price:       price,
-			Images:      []models.ProductImage{{Image: "img3", Order: 0, Checksum: "chk3", CompressedImage: make([]byte, 10)}},
+			Images:      []models.ProductImage{{Image: "img3", Order: 0, Checksum: "chk3", Data: make([]byte, 10)}},
 		},
 	}
 
@@ -203,6 +184,40 @@ func TestUpdateItemSoldViaCheckout(t *testing.T) {
 			t.Fatal("invalid sold to id")
 		}
 	}
+
+	draft, err := db.InsertListing(ctx, id, &models.Product{
+		ItemName: "unreleased hat",
+		Category: "fashion",
+		Price:    price,
+		Status:   models.LISTING_STATUS_DRAFT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := db.InsertListing(ctx, id, &models.Product{
+		ItemName: "plain hat",
+		Category: "fashion",
+		Price:    price,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.UpdateItemSoldViaCheckout(ctx, id, &models.CartItems{Products: []uuid.UUID{active, draft}})
+	if err == nil {
+		t.Fatal("checked out a draft listing")
+	}
+
+	var sold int
+	err = db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM luxora_product WHERE item_id=ANY($1) AND sold", []uuid.UUID{active, draft}).Scan(&sold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sold != 0 {
+		t.Fatalf("got %d items sold from a cart that was rejected, want 0", sold)
+	}
 }
 
 func TestUpdateItemListing(t *testing.T) {
@@ -226,7 +241,7 @@ func TestUpdateItemListing(t *testing.T) {
 		Category:    "fashion",
 		Description: "A stylish rizz hat",
 		Price:       price,
-		Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", CompressedImage: make([]byte, 10)}},
+		Images:      []models.ProductImage{{Image: "img1", Order: 0, Checksum: "chk1", Data: make([]byte, 10)}},
 	}
 
 	pid, err := db.InsertListing(ctx, id, &product)
@@ -234,6 +249,11 @@ func TestUpdateItemListing(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	before, err := db.GetProductById(ctx, id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	err = db.UpdateItemListing(ctx, id, &models.UpdateProduct{
 		Id:          pid,
 		Description: "hai huzz",
@@ -243,4 +263,118 @@ func TestUpdateItemListing(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	after, err := db.GetProductById(ctx, id, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Name != "rizz" || after.Description != "hai huzz" {
+		t.Fatalf("listing was not updated: %+v", after)
+	}
+
+	if !after.UpdatedAt.After(before.UpdatedAt) {
+		t.Fatal("expected updated_at to move forward")
+	}
+
+	other, err := db.InsertOauthUser(t.Context(), "jack", "github", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.UpdateItemListing(ctx, other, &models.UpdateProduct{Id: pid, Name: "stolen"})
+	if err == nil {
+		t.Fatal("expected update of another user's listing to fail")
+	}
+}
+
+func TestPublishListing(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := db.InsertOauthUser(t.Context(), "jack", "github", "skofk", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), id, &models.Product{
+		ItemName: "rizz hat",
+		Category: "fashion",
+		Price:    decimal.NewFromInt(100),
+		Status:   models.LISTING_STATUS_DRAFT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.PublishListing(t.Context(), other, pid); err == nil {
+		t.Fatal("published a draft owned by another user")
+	}
+
+	if err := db.PublishListing(t.Context(), id, pid); err != nil {
+		t.Fatal(err)
+	}
+
+	var status string
+	err = pool.QueryRow(t.Context(), "SELECT status FROM luxora_product WHERE item_id=$1", pid).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != models.LISTING_STATUS_ACTIVE {
+		t.Fatalf("got status %s, want %s", status, models.LISTING_STATUS_ACTIVE)
+	}
+
+	if err := db.PublishListing(t.Context(), id, pid); err == nil {
+		t.Fatal("published an already active listing")
+	}
+}
+
+func TestPublishScheduledListings(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	id, err := db.InsertOauthUser(t.Context(), "diddy", "github", "hwllo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	due := now.Add(-1 * time.Minute)
+	later := now.Add(1 * time.Hour)
+
+	for _, publishAt := range []*time.Time{&due, &later, nil} {
+		_, err := db.InsertListing(t.Context(), id, &models.Product{
+			ItemName:  "rizz hat",
+			Category:  "fashion",
+			Price:     decimal.NewFromInt(100),
+			Status:    models.LISTING_STATUS_DRAFT,
+			PublishAt: publishAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published, err := db.PublishScheduledListings(t.Context(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published != 1 {
+		t.Fatalf("got %d published listings, want 1", published)
+	}
 }
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const verificationColumns = `
+	pv.verification_id,
+	pv.product_id,
+	lp.name,
+	pv.requested_by,
+	pv.reviewer_id,
+	pv.status,
+	COALESCE(pv.notes, ''),
+	pv.requested_at,
+	pv.reviewed_at
+`
+
+func scanVerification(row pgx.Row) (v models.Verification, err error) {
+	err = row.Scan(&v.VerificationID, &v.ProductID, &v.ProductName, &v.RequestedBy, &v.ReviewerID, &v.Status, &v.Notes, &v.RequestedAt, &v.ReviewedAt)
+	return
+}
+
+func collectVerifications(rows pgx.Rows) (verifications []models.Verification, err error) {
+	defer rows.Close()
+
+	verifications = []models.Verification{}
+	for rows.Next() {
+		v, err := scanVerification(rows)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, v)
+	}
+
+	return verifications, rows.Err()
+}
+
+// latestVerification returns the most recent verification request for a product, or nil if there is none.
+func latestVerification(ctx context.Context, tx pgx.Tx, productID uuid.UUID) (*models.Verification, error) {
+	v, err := scanVerification(tx.QueryRow(ctx, `
+		SELECT `+verificationColumns+`
+		FROM luxora_product_verification pv
+		JOIN luxora_product lp ON lp.item_id = pv.product_id
+		WHERE pv.product_id = $1
+		ORDER BY pv.requested_at DESC
+		LIMIT 1
+	`, productID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// resetVerification drops the verification of a listing whose content or images changed, a review
+// of the old content says nothing about the new one. A pending request is superseded so it can no
+// longer be approved, the seller has to submit the listing again.
+func resetVerification(ctx context.Context, tx pgx.Tx, productID uuid.UUID) error {
+	_, err := tx.Exec(ctx, "UPDATE luxora_product_verification SET status = 'superseded', reviewed_at = NOW() WHERE product_id = $1 AND status = 'pending'", productID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_product SET verification_status = 'unverified' WHERE item_id = $1 AND verification_status IN ('pending', 'verified')", productID)
+	return err
+}
+
+// InsertVerificationRequest marks an active listing owned by userID as pending verification.
+// Listings that are already pending or verified can not be submitted again, rejected listings can.
+func (p *Postgres) InsertVerificationRequest(ctx context.Context, userID, productID uuid.UUID) (verificationID uuid.UUID, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	t, err := tx.Exec(ctx, `
+		UPDATE luxora_product SET verification_status = 'pending'
+		WHERE item_id = $1 AND user_id = $2 AND status = 'active' AND verification_status IN ('unverified', 'rejected')
+	`, productID, userID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	if t.RowsAffected() != 1 {
+		tx.Rollback(ctx)
+		return uuid.Nil, fmt.Errorf("no unverified active listing found to verify")
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO luxora_product_verification (product_id, requested_by) VALUES ($1, $2) RETURNING verification_id", productID, userID).Scan(&verificationID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return uuid.Nil, err
+	}
+
+	return verificationID, tx.Commit(ctx)
+}
+
+// UpdateVerification records the outcome of a pending verification and copies it onto the listing.
+// Reviewers can not review their own listings.
+func (p *Postgres) UpdateVerification(ctx context.Context, reviewerID, verificationID uuid.UUID, status, notes string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	var productID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE luxora_product_verification SET status = $1, notes = NULLIF($2, ''), reviewer_id = $3, reviewed_at = NOW()
+		WHERE verification_id = $4 AND status = 'pending' AND requested_by <> $3
+		RETURNING product_id
+	`, status, notes, reviewerID, verificationID).Scan(&productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("no pending verification found to review")
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE luxora_product SET verification_status = $1 WHERE item_id = $2", status, productID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) GetPendingVerifications(ctx context.Context, limit, offset int) (verifications []models.Verification, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT `+verificationColumns+`
+		FROM luxora_product_verification pv
+		JOIN luxora_product lp ON lp.item_id = pv.product_id
+		WHERE pv.status = 'pending'
+		ORDER BY pv.requested_at ASC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectVerifications(rows)
+}
+
+func (p *Postgres) GetVerificationHistory(ctx context.Context, productID uuid.UUID) (verifications []models.Verification, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := p.Pool.Query(ctx, `
+		SELECT `+verificationColumns+`
+		FROM luxora_product_verification pv
+		JOIN luxora_product lp ON lp.item_id = pv.product_id
+		WHERE pv.product_id = $1
+		ORDER BY pv.requested_at DESC
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectVerifications(rows)
+}
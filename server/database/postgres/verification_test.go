@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/testutils"
+	"github.com/shopspring/decimal"
+)
+
+func TestVerificationWorkflow(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	seller, err := db.InsertOauthUser(t.Context(), "seller", "github", "seller", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := db.InsertOauthUser(t.Context(), "verifier", "github", "verifier", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GrantRole(t.Context(), uuid.Nil, verifier, models.ROLE_VERIFIER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := db.HasRole(t.Context(), verifier, models.ROLE_VERIFIER)
+	if err != nil || !ok {
+		t.Fatalf("expected verifier role, got %v (%v)", ok, err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), seller, &models.Product{
+		ItemName:  "submariner",
+		Category:  "watches",
+		Price:     decimal.NewFromInt(9000),
+		Condition: models.CONDITION_EXCELLENT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := db.InsertVerificationRequest(t.Context(), seller, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.InsertVerificationRequest(t.Context(), seller, pid)
+	if err == nil {
+		t.Fatal("expected a pending listing to not be submitted twice")
+	}
+
+	err = db.UpdateVerification(t.Context(), seller, first, models.VERIFICATION_STATUS_VERIFIED, "")
+	if err == nil {
+		t.Fatal("expected the seller to not be able to review their own listing")
+	}
+
+	pending, err := db.GetPendingVerifications(t.Context(), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 1 || pending[0].ProductID != pid || pending[0].ProductName != "submariner" {
+		t.Fatalf("unexpected pending verifications: %+v", pending)
+	}
+
+	err = db.UpdateVerification(t.Context(), verifier, first, models.VERIFICATION_STATUS_REJECTED, "serial number is missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := db.InsertVerificationRequest(t.Context(), seller, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.UpdateVerification(t.Context(), verifier, second, models.VERIFICATION_STATUS_VERIFIED, "papers match")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.UpdateVerification(t.Context(), verifier, second, models.VERIFICATION_STATUS_REJECTED, "")
+	if err == nil {
+		t.Fatal("expected a reviewed verification to not be reviewed again")
+	}
+
+	product, err := db.GetProductById(t.Context(), verifier, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !product.Verified || product.Condition != models.CONDITION_EXCELLENT {
+		t.Fatalf("expected a verified listing in excellent condition, got %+v", product)
+	}
+
+	if product.Verification == nil || product.Verification.VerificationID != second || product.Verification.Notes != "papers match" || *product.Verification.ReviewerID != verifier {
+		t.Fatalf("unexpected verification details: %+v", product.Verification)
+	}
+
+	history, err := db.GetVerificationHistory(t.Context(), pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || history[0].Status != models.VERIFICATION_STATUS_VERIFIED || history[1].Status != models.VERIFICATION_STATUS_REJECTED {
+		t.Fatalf("unexpected verification history: %+v", history)
+	}
+}
+
+func TestVerificationResetOnChange(t *testing.T) {
+	pool, clean, err := testutils.SetupTestPostgresDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+
+	db := Postgres{Pool: pool}
+	seller, err := db.InsertOauthUser(t.Context(), "seller", "github", "seller", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := db.InsertOauthUser(t.Context(), "verifier", "github", "verifier", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := db.InsertListing(t.Context(), seller, &models.Product{
+		ItemName: "submariner",
+		Category: "watches",
+		Price:    decimal.NewFromInt(9000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func() string {
+		product, err := db.GetProductById(t.Context(), seller, pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return product.VerificationStatus
+	}
+
+	verify := func() {
+		vid, err := db.InsertVerificationRequest(t.Context(), seller, pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.UpdateVerification(t.Context(), verifier, vid, models.VERIFICATION_STATUS_VERIFIED, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// changing the content of a verified listing drops the badge
+	verify()
+	err = db.UpdateItemListing(t.Context(), seller, &models.UpdateProduct{Id: pid, Name: "replica"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status(); got != models.VERIFICATION_STATUS_UNVERIFIED {
+		t.Fatalf("after renaming: got %s, want %s", got, models.VERIFICATION_STATUS_UNVERIFIED)
+	}
+
+	// so does changing its images
+	verify()
+	image := models.ProductImage{Checksum: "sdkfjlsdf", ContentType: "image/png", Data: make([]byte, 10)}
+	imageID, _, err := db.InsertProductImage(t.Context(), seller, pid, &image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status(); got != models.VERIFICATION_STATUS_UNVERIFIED {
+		t.Fatalf("after adding an image: got %s, want %s", got, models.VERIFICATION_STATUS_UNVERIFIED)
+	}
+
+	verify()
+	if err := db.DeleteProductImage(t.Context(), seller, pid, imageID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status(); got != models.VERIFICATION_STATUS_UNVERIFIED {
+		t.Fatalf("after deleting an image: got %s, want %s", got, models.VERIFICATION_STATUS_UNVERIFIED)
+	}
+
+	// a pending request for the old content can no longer be approved
+	pending, err := db.InsertVerificationRequest(t.Context(), seller, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.UpdateItemListing(t.Context(), seller, &models.UpdateProduct{Id: pid, Description: "trust me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status(); got != models.VERIFICATION_STATUS_UNVERIFIED {
+		t.Fatalf("after changing a pending listing: got %s, want %s", got, models.VERIFICATION_STATUS_UNVERIFIED)
+	}
+
+	err = db.UpdateVerification(t.Context(), verifier, pending, models.VERIFICATION_STATUS_VERIFIED, "")
+	if err == nil {
+		t.Fatal("approved a request for content that changed since")
+	}
+
+	history, err := db.GetVerificationHistory(t.Context(), pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 4 || history[0].Status != models.VERIFICATION_STATUS_SUPERSEDED {
+		t.Fatalf("unexpected verification history: %+v", history)
+	}
+}
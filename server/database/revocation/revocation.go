@@ -0,0 +1,174 @@
+// Package revocation keeps track of access tokens that must stop working before they expire.
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+// What a revocation applies to.
+const (
+	KIND_TOKEN   = "token"
+	KIND_SESSION = "session"
+	KIND_USER    = "user"
+)
+
+// SYNC_OVERLAP is how far before the newest revocation seen a sync starts reading, so revocations
+// that another server commits slightly out of order are not skipped.
+const SYNC_OVERLAP = 1 * time.Minute
+
+type entry struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// Store keeps every revocation in memory in front of Postgres, so checking a token on each request
+// never waits on the database. A revocation only has to outlive the access tokens it covers, which
+// keeps the set small enough to hold in full.
+//
+// Revocations made through the Store apply on this server at once, revocations made by other
+// servers apply from their next Sync.
+type Store struct {
+	db  database.Database
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]entry
+	cursor  time.Time
+}
+
+// New creates a Store whose revocations last ttl, which must be at least the access token expiry.
+func New(db database.Database, ttl time.Duration) *Store {
+	return &Store{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[string]entry),
+	}
+}
+
+func key(kind, subject string) string {
+	return kind + ":" + subject
+}
+
+func (s *Store) add(r models.Revocation) {
+	k := key(r.Kind, r.Subject)
+	if e, ok := s.entries[k]; ok && e.revokedAt.After(r.RevokedAt) {
+		return
+	}
+
+	s.entries[k] = entry{revokedAt: r.RevokedAt, expiresAt: r.ExpiresAt}
+	if r.RevokedAt.After(s.cursor) {
+		s.cursor = r.RevokedAt
+	}
+}
+
+// Revoke makes the access tokens of a token id, session or user stop working. Revoking a user
+// covers the tokens issued up to now, not ones issued after it.
+func (s *Store) Revoke(ctx context.Context, kind, subject string) error {
+	r, err := s.db.InsertRevocation(ctx, kind, subject, s.ttl)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.add(r)
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether the access token with these claims was revoked by its id, its session
+// or its user.
+func (s *Store) IsRevoked(claims *token.TokenClaims) bool {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revoked := func(kind, subject string) (entry, bool) {
+		if subject == "" {
+			return entry{}, false
+		}
+		e, ok := s.entries[key(kind, subject)]
+		return e, ok && now.Before(e.expiresAt)
+	}
+
+	if _, ok := revoked(KIND_TOKEN, claims.ID); ok {
+		return true
+	}
+
+	if _, ok := revoked(KIND_SESSION, claims.Payload); ok {
+		return true
+	}
+
+	if e, ok := revoked(KIND_USER, claims.UserID.String()); ok {
+		// iat only has second precision, so a token from the same second as the revocation is revoked too
+		return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(e.revokedAt)
+	}
+
+	return false
+}
+
+// Sync loads the revocations made since the last sync and forgets the ones that expired.
+func (s *Store) Sync(ctx context.Context) error {
+	s.mu.RLock()
+	since := s.cursor
+	s.mu.RUnlock()
+
+	if !since.IsZero() {
+		since = since.Add(-SYNC_OVERLAP)
+	}
+
+	revocations, err := s.db.GetRevocations(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range revocations {
+		s.add(r)
+	}
+
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+
+	return nil
+}
+
+// Watch syncs every interval until ctx is cancelled, and deletes expired revocations from the
+// database.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, log *logger.Logger) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.Sync(ctx); err != nil {
+					log.Error(fmt.Sprintf("Failed to sync revocations: %v", err))
+					continue
+				}
+
+				if err := s.db.DeleteExpiredRevocations(ctx); err != nil {
+					log.Error(fmt.Sprintf("Failed to delete expired revocations: %v", err))
+				}
+			}
+		}
+	}()
+}
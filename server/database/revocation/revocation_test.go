@@ -0,0 +1,162 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+// memoryDatabase keeps revocations in memory, as a second server sharing the table would see them.
+type memoryDatabase struct {
+	database.Database
+
+	mu          sync.Mutex
+	revocations map[string]models.Revocation
+}
+
+func (d *memoryDatabase) InsertRevocation(ctx context.Context, kind, subject string, ttl time.Duration) (models.Revocation, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	r := models.Revocation{Kind: kind, Subject: subject, RevokedAt: now, ExpiresAt: now.Add(ttl)}
+	d.revocations[key(kind, subject)] = r
+	return r, nil
+}
+
+func (d *memoryDatabase) GetRevocations(ctx context.Context, since time.Time) (revocations []models.Revocation, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, r := range d.revocations {
+		if r.RevokedAt.After(since) && time.Now().Before(r.ExpiresAt) {
+			revocations = append(revocations, r)
+		}
+	}
+	return revocations, nil
+}
+
+func claims(userID uuid.UUID, sessionID string, issuedAt time.Time) *token.TokenClaims {
+	return &token.TokenClaims{
+		UserID:  userID,
+		Payload: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.NewString(),
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	db := &memoryDatabase{revocations: make(map[string]models.Revocation)}
+	s := New(db, time.Hour)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	sessionID := uuid.NewString()
+	c := claims(userID, sessionID, time.Now())
+
+	if s.IsRevoked(c) {
+		t.Fatal("expected token not to be revoked")
+	}
+
+	t.Run("token", func(t *testing.T) {
+		other := claims(userID, sessionID, time.Now())
+		if err := s.Revoke(ctx, KIND_TOKEN, other.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if !s.IsRevoked(other) {
+			t.Fatal("expected revoked token id to be revoked")
+		}
+
+		if s.IsRevoked(c) {
+			t.Fatal("expected other tokens of the session to still work")
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		if err := s.Revoke(ctx, KIND_SESSION, sessionID); err != nil {
+			t.Fatal(err)
+		}
+
+		if !s.IsRevoked(c) {
+			t.Fatal("expected token of revoked session to be revoked")
+		}
+
+		if s.IsRevoked(claims(userID, uuid.NewString(), time.Now())) {
+			t.Fatal("expected tokens of other sessions to still work")
+		}
+	})
+
+	t.Run("user", func(t *testing.T) {
+		userID := uuid.New()
+		before := claims(userID, uuid.NewString(), time.Now().Add(-time.Minute))
+
+		if err := s.Revoke(ctx, KIND_USER, userID.String()); err != nil {
+			t.Fatal(err)
+		}
+
+		if !s.IsRevoked(before) {
+			t.Fatal("expected token issued before the revocation to be revoked")
+		}
+
+		if s.IsRevoked(claims(userID, uuid.NewString(), time.Now().Add(2*time.Second))) {
+			t.Fatal("expected token issued after the revocation to work")
+		}
+	})
+}
+
+func TestSync(t *testing.T) {
+	db := &memoryDatabase{revocations: make(map[string]models.Revocation)}
+	ctx := context.Background()
+
+	// two servers share the database
+	a := New(db, time.Hour)
+	b := New(db, time.Hour)
+
+	c := claims(uuid.New(), uuid.NewString(), time.Now())
+	if err := a.Revoke(ctx, KIND_SESSION, c.Payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.IsRevoked(c) {
+		t.Fatal("expected revocation to not be known before sync")
+	}
+
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.IsRevoked(c) {
+		t.Fatal("expected revocation to be known after sync")
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		s := New(db, time.Hour)
+		s.entries[key(KIND_SESSION, c.Payload)] = entry{revokedAt: time.Now().Add(-2 * time.Hour), expiresAt: time.Now().Add(-time.Hour)}
+
+		if s.IsRevoked(c) {
+			t.Fatal("expected expired revocation to be ignored")
+		}
+
+		db.mu.Lock()
+		db.revocations = make(map[string]models.Revocation)
+		db.mu.Unlock()
+
+		if err := s.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(s.entries) != 0 {
+			t.Fatalf("expected expired revocations to be pruned, got %d", len(s.entries))
+		}
+	})
+}
@@ -13,12 +13,18 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
 	"github.com/gopher93185789/luxora/server/core/store"
+	"github.com/gopher93185789/luxora/server/database"
+	"github.com/gopher93185789/luxora/server/database/cache"
 	"github.com/gopher93185789/luxora/server/database/postgres"
+	"github.com/gopher93185789/luxora/server/database/revocation"
 	"github.com/gopher93185789/luxora/server/docs"
+	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
 	"github.com/gopher93185789/luxora/server/pkg/middleware"
+	"github.com/gopher93185789/luxora/server/pkg/models"
 	"github.com/gopher93185789/luxora/server/pkg/token"
 	auth "github.com/gopher93185789/luxora/server/transport"
 	"golang.org/x/oauth2"
@@ -54,13 +60,50 @@ func main() {
 		log.Fatalln("Failed to connect to database: " + err.Error())
 	}
 
-	mcf := middleware.New(&token.BstConfig{SecretKey: []byte(config.TokenSigningKey)})
+	blobs, err := newBlobStore(config)
+	if err != nil {
+		log.Fatalln("Failed to open blob store: " + err.Error())
+	}
+
+	// listings are read far more often than they change, so they are served from memory when possible
+	var db database.Database = pool
+	var listingCache *cache.Cache
+	if config.CacheSize > 0 {
+		listingCache = cache.New(pool, config.CacheSize, config.CacheTTL)
+		db = listingCache
+	}
+
+	// revocations outlive the access tokens they cover, so every revoked token is rejected until it expires
+	revocations := revocation.New(pool, coreAuth.ACCESS_TOKEN_EXPIRY+config.TokenLeeway)
+	if err := revocations.Sync(context.Background()); err != nil {
+		log.Fatalln("Failed to load revocations: " + err.Error())
+	}
+
+	signingKeys, err := newKeySet(config)
+	if err != nil {
+		log.Fatalln("Failed to load signing keys: " + err.Error())
+	}
+
+	tokenConfig := token.BstConfig{
+		SecretKey:      []byte(config.TokenSigningKey),
+		SecretKeyUntil: config.TokenSigningKeyUntil,
+		Keys:           signingKeys,
+		Issuer:         config.TokenIssuer,
+		Leeway:         config.TokenLeeway,
+	}
+
+	mcf := middleware.New(&tokenConfig, revocations)
 
 	logger := logger.New(os.Stdout, &logger.LoggerOpts{
 		BufferSize: 512,
 		ChanBuffer: 1_000_000,
 	})
 
+	mail, err := newMailer(config, logger)
+	if err != nil {
+		log.Fatalln("Failed to set up mailer: " + err.Error())
+	}
+
 	tx := &auth.TransportConfig{
 		CoreAuth: &coreAuth.CoreAuthContext{
 			Logger: logger,
@@ -78,20 +121,62 @@ func main() {
 				RedirectURL:  config.GoogleRedirect,
 				Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
 			},
-			TokenConfig: token.BstConfig{
-				SecretKey: []byte(config.TokenSigningKey),
-			},
-			Database:   pool,
-			OauthState: "w;iudfiuweiuvhw;hriujwiriwhre",
+			TokenConfig: tokenConfig,
+			Database:    pool,
+			StateKey:    []byte(config.OauthStateKey),
+			Mailer:      mail,
+			AppURL:      config.AppURL,
+			Revocations: revocations,
 		},
 
 		CoreStore: &store.CoreStoreContext{
 			Logger:   logger,
-			Database: pool,
+			Database: db,
+			Blobs:    blobs,
 		},
 
 		Middleware: mcf,
 		Logger:     logger,
+		Cache:      listingCache,
+	}
+
+	// `server migrate-blobs` moves images out of Postgres into the configured blob store and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate-blobs" {
+		migrated, err := tx.CoreStore.MigrateBlobs(context.Background())
+		logger.Close()
+		if err != nil {
+			log.Fatalln("Failed to migrate blobs: " + err.Error())
+		}
+		log.Printf("migrated %d images to the %s blob store", migrated, config.BlobStore)
+		return
+	}
+
+	// `server grant-role <user id> <role>` grants a role without an admin, which is how the first admin is made
+	if len(os.Args) > 1 && os.Args[1] == "grant-role" {
+		if len(os.Args) != 4 {
+			log.Fatalln("usage: server grant-role <user id> <role>")
+		}
+
+		uid, err := uuid.Parse(os.Args[2])
+		if err != nil {
+			log.Fatalln("Invalid user id: " + err.Error())
+		}
+
+		err = tx.CoreAuth.GrantRole(context.Background(), uuid.Nil, uid, os.Args[3])
+		logger.Close()
+		if err != nil {
+			log.Fatalln("Failed to grant role: " + err.Error())
+		}
+		log.Printf("granted role %s to user %s", os.Args[3], uid)
+		return
+	}
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	tx.CoreStore.WatchScheduledListings(schedulerCtx, 1*time.Minute)
+	tx.CoreStore.WatchBlobDeletions(schedulerCtx, 5*time.Minute)
+	revocations.Watch(schedulerCtx, 5*time.Second, logger)
+	if signingKeys != nil {
+		signingKeys.Watch(schedulerCtx, 1*time.Minute, logger)
 	}
 
 	scalPass := &docs.ScalarRoute{
@@ -109,10 +194,24 @@ func main() {
 	mux.HandleFunc("GET /auth/github/exchange", tx.GithubExchange)
 	mux.HandleFunc("GET /auth/google", tx.GoogleRedirect)
 	mux.HandleFunc("GET /auth/google/exchange", tx.GoogleExchange)
+	mux.HandleFunc("POST /auth/signup", tx.Signup)
+	mux.HandleFunc("POST /auth/login", tx.Login)
+	mux.HandleFunc("POST /auth/link/{provider}", mcf.AuthMiddleware(tx.LinkProvider))
+	mux.HandleFunc("DELETE /auth/link/{provider}", mcf.AuthMiddleware(tx.UnlinkProvider))
+	mux.HandleFunc("POST /auth/email/verification", mcf.AuthMiddleware(tx.SendEmailVerification))
+	mux.HandleFunc("POST /auth/email/verify", tx.VerifyEmail)
+	mux.HandleFunc("POST /auth/email/change", mcf.AuthMiddleware(tx.RequestEmailChange))
+	mux.HandleFunc("POST /auth/email/change/confirm", tx.ConfirmEmailChange)
+	mux.HandleFunc("POST /auth/password/forgot", tx.ForgotPassword)
+	mux.HandleFunc("POST /auth/password/reset", tx.ResetPassword)
 	mux.HandleFunc("GET /auth/userinfo", mcf.AuthMiddleware(tx.GetUserInfo))
 	mux.HandleFunc("POST /auth/logout", mcf.AuthMiddleware(tx.Logout))
+	mux.HandleFunc("GET /auth/sessions", mcf.AuthMiddleware(tx.GetSessions))
+	mux.HandleFunc("DELETE /auth/sessions", mcf.AuthMiddleware(tx.LogoutEverywhere))
+	mux.HandleFunc("DELETE /auth/sessions/{id}", mcf.AuthMiddleware(tx.RevokeSession))
 	mux.HandleFunc("POST /auth/refresh", tx.RefreshToken)
 	mux.HandleFunc("GET /auth/verify", mcf.VerifyTokenEndpoint)
+	mux.HandleFunc("GET /.well-known/jwks.json", tx.GetJWKS)
 
 	// listings
 	mux.HandleFunc("POST /listing/bid", mcf.AuthMiddleware(tx.CreateBid))
@@ -121,16 +220,53 @@ func main() {
 	mux.HandleFunc("GET /listings/{id}", mcf.AuthMiddleware(tx.GetListingsById))
 	mux.HandleFunc("PATCH /listings", mcf.AuthMiddleware(tx.UpdateListing))
 	mux.HandleFunc("DELETE /listings/{id}", mcf.AuthMiddleware(tx.DeleteListing))
+	mux.HandleFunc("POST /listings/{id}/publish", mcf.AuthMiddleware(tx.PublishListing))
+	mux.HandleFunc("POST /listings/{id}/relist", mcf.AuthMiddleware(tx.RelistListing))
+	mux.HandleFunc("POST /listings/{id}/duplicate", mcf.AuthMiddleware(tx.DuplicateListing))
+	mux.HandleFunc("POST /listings/{id}/images", mcf.AuthMiddleware(tx.UploadListingImages))
+	mux.HandleFunc("PUT /listings/{id}/images/order", mcf.AuthMiddleware(tx.ReorderListingImages))
+	mux.HandleFunc("PUT /listings/{id}/images/{image_id}", mcf.AuthMiddleware(tx.ReplaceListingImage))
+	mux.HandleFunc("DELETE /listings/{id}/images/{image_id}", mcf.AuthMiddleware(tx.DeleteListingImage))
+	mux.HandleFunc("POST /listings/{id}/verification", mcf.AuthMiddleware(tx.RequestVerification))
+	mux.HandleFunc("GET /listings/{id}/verification", mcf.AuthMiddleware(tx.GetVerificationHistory))
 	mux.HandleFunc("GET /listings/highest-bid", mcf.AuthMiddleware(tx.GetHighestBid))
 	mux.HandleFunc("GET /listings/bids", mcf.AuthMiddleware(tx.GetBids))
 	mux.HandleFunc("PUT /listings/sold/bid", mcf.AuthMiddleware(tx.UpdateSoldViaBid))
 	mux.HandleFunc("POST /listings/checkout", mcf.AuthMiddleware(tx.Checkout))
 
+	// images
+	mux.HandleFunc("GET /images/{id}", tx.GetImage)
+
+	// categories
+	mux.HandleFunc("GET /categories", tx.GetCategories)
+
+	// verification
+	mux.HandleFunc("GET /verifications", mcf.AuthMiddleware(tx.GetPendingVerifications))
+	mux.HandleFunc("POST /verifications/{id}/review", mcf.AuthMiddleware(tx.ReviewVerification))
+
 	// user bidding endpoints
 	mux.HandleFunc("GET /user/bids", mcf.AuthMiddleware(tx.GetUserBids))
 	mux.HandleFunc("GET /user/listings/bids", mcf.AuthMiddleware(tx.GetBidsOnUserListings))
 	mux.HandleFunc("PUT /listing/bid/{bid_id}/accept", mcf.AuthMiddleware(tx.AcceptBidEndpoint))
 
+	// metrics
+	mux.HandleFunc("GET /metrics/cache", mcf.RequireRole(tx.GetCacheStats, models.ROLE_ADMIN))
+
+	mux.HandleFunc("GET /admin/stats", mcf.RequireRole(tx.GetPlatformStats, models.ROLE_ADMIN))
+	mux.HandleFunc("GET /admin/listings/{id}", mcf.RequireRole(tx.GetAnyListing, models.ROLE_MODERATOR, models.ROLE_ADMIN))
+	mux.HandleFunc("DELETE /admin/listings/{id}", mcf.RequireRole(tx.RemoveListing, models.ROLE_MODERATOR, models.ROLE_ADMIN))
+	mux.HandleFunc("POST /admin/users/{id}/suspension", mcf.RequireRole(tx.SuspendUser, models.ROLE_MODERATOR, models.ROLE_ADMIN))
+	mux.HandleFunc("DELETE /admin/users/{id}/suspension", mcf.RequireRole(tx.UnsuspendUser, models.ROLE_MODERATOR, models.ROLE_ADMIN))
+	mux.HandleFunc("GET /admin/users/{id}/roles", mcf.RequireRole(tx.GetUserRoles, models.ROLE_ADMIN))
+	mux.HandleFunc("PUT /admin/users/{id}/roles/{role}", mcf.RequireRole(tx.GrantRole, models.ROLE_ADMIN))
+	mux.HandleFunc("DELETE /admin/users/{id}/roles/{role}", mcf.RequireRole(tx.RevokeRole, models.ROLE_ADMIN))
+	mux.HandleFunc("GET /admin/roles/audit", mcf.RequireRole(tx.GetRoleChanges, models.ROLE_ADMIN))
+
+	compress, err := middleware.NewCompression(middleware.DEFAULT_MIN_COMPRESS_SIZE, compression.LEVEL_FASTEST)
+	if err != nil {
+		log.Fatalln("Failed to create compression middleware: " + err.Error())
+	}
+
 	cors := &middleware.CorsConfig{
 		AllowedOrigins: strings.Split(strings.TrimSpace(config.AllowedOrigin), ","),
 	}
@@ -140,7 +276,7 @@ func main() {
 
 	srv := http.Server{
 		Addr:         config.Port,
-		Handler:      cors.CORSMiddleware(mux),
+		Handler:      cors.CORSMiddleware(compress.CompressionMiddleware(mux)),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 		IdleTimeout:  15 * time.Second,
@@ -185,6 +321,7 @@ func main() {
 
 	<-sig
 	fmt.Println("shutdown signal received")
+	stopScheduler()
 	logger.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -0,0 +1,65 @@
+// Package blob stores image bytes outside of Postgres. Keys are slash separated paths, the
+// same key always maps to the same object in every implementation.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const MAX_KEY_LENGTH = 1024
+
+var (
+	ErrNotFound            = errors.New("blob not found")
+	ErrInvalidKey          = errors.New("invalid blob key")
+	ErrPresignNotSupported = errors.New("blob store does not support presigned urls")
+)
+
+// Info describes a stored blob. ContentType is empty for stores that do not keep it.
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob. A negative size means
+	// the size is not known up front.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (err error)
+	// Get opens the blob stored under key, the caller has to close it.
+	Get(ctx context.Context, key string) (body io.ReadCloser, info Info, err error)
+	// Delete removes the blob stored under key. Deleting a blob that does not exist is not an error.
+	Delete(ctx context.Context, key string) (err error)
+	Stat(ctx context.Context, key string) (info Info, err error)
+	// PresignedURL returns a URL clients can GET the blob from without credentials until it expires.
+	// Stores that can not hand out URLs return ErrPresignNotSupported.
+	PresignedURL(ctx context.Context, key string, expires time.Duration) (url string, err error)
+}
+
+// ValidateKey checks a key is a relative path of letters, digits, dots, dashes and underscores,
+// so it can be used as a file path and an object name without escaping tricks.
+func ValidateKey(key string) error {
+	if key == "" || len(key) > MAX_KEY_LENGTH {
+		return ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+
+		for _, r := range segment {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			default:
+				return ErrInvalidKey
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package blob
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{"a", "images/abc123/full", "images/a.b_c-d/thumb"}
+	for _, key := range valid {
+		if err := ValidateKey(key); err != nil {
+			t.Errorf("ValidateKey(%q) = %v, want nil", key, err)
+		}
+	}
+
+	invalid := []string{"", "/abs", "trailing/", "a//b", "../escape", "a/./b", "a/../b", "space key", "ümlaut", "back\\slash", strings.Repeat("a", MAX_KEY_LENGTH+1)}
+	for _, key := range invalid {
+		if err := ValidateKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
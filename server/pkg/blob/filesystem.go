@@ -0,0 +1,151 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSystem stores blobs as files below Root, using the key as the relative path.
+type FileSystem struct {
+	Root string
+}
+
+func NewFileSystem(root string) (*FileSystem, error) {
+	if root == "" {
+		return nil, fmt.Errorf("missing blob directory")
+	}
+
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &FileSystem{Root: root}, nil
+}
+
+func (f *FileSystem) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first and renames it into place, so readers never see a partial blob.
+func (f *FileSystem) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (err error) {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	n, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 && n != size {
+		return fmt.Errorf("wrote %d bytes for blob %s, expected %d", n, key, size)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileSystem) Get(ctx context.Context, key string) (body io.ReadCloser, info Info, err error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, info, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, info, ErrNotFound
+	}
+	if err != nil {
+		return nil, info, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, info, err
+	}
+
+	return file, Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (f *FileSystem) Delete(ctx context.Context, key string) (err error) {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *FileSystem) Stat(ctx context.Context, key string) (info Info, err error) {
+	path, err := f.path(key)
+	if err != nil {
+		return info, err
+	}
+
+	stat, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, ErrNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+
+	return Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+// PresignedURL is not supported, files are served through the API instead.
+func (f *FileSystem) PresignedURL(ctx context.Context, key string, expires time.Duration) (url string, err error) {
+	return "", ErrPresignNotSupported
+}
+
+// contextReader stops a copy once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,79 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSystem(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileSystem(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("image bytes")
+	if err := store.Put(ctx, "images/abc/full", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	body, info, err := store.Get(ctx, "images/abc/full")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) || info.Size != int64(len(data)) || info.Key != "images/abc/full" {
+		t.Fatalf("got %q with info %+v", got, info)
+	}
+
+	// overwriting replaces the blob, an unknown size is fine
+	if err := store.Put(ctx, "images/abc/full", bytes.NewReader([]byte("new")), -1, ""); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if info, err := store.Stat(ctx, "images/abc/full"); err != nil || info.Size != 3 {
+		t.Fatalf("stat after overwrite: %+v %v", info, err)
+	}
+
+	if err := store.Put(ctx, "images/abc/medium", bytes.NewReader(data), 3, ""); err == nil {
+		t.Fatal("expected size mismatch to fail")
+	}
+	if _, err := store.Stat(ctx, "images/abc/medium"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("failed put left a blob behind: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(store.Root, "images", "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the full blob on disk, found %d entries", len(entries))
+	}
+
+	if _, err := store.PresignedURL(ctx, "images/abc/full", 0); !errors.Is(err, ErrPresignNotSupported) {
+		t.Fatalf("expected ErrPresignNotSupported, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "images/abc/full"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.Delete(ctx, "images/abc/full"); err != nil {
+		t.Fatalf("deleting a missing blob: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "images/abc/full"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", bytes.NewReader(data), -1, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
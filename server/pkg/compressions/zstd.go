@@ -1,39 +1,270 @@
 package compression
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/klauspost/compress/zstd"
 )
 
-func CompressZSTD(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	encoder, err := zstd.NewWriter(&buf)
+// Compression levels follow the zstd command line levels, anything from 1 to 22 is accepted and
+// mapped onto the closest level the encoder implements.
+const (
+	LEVEL_FASTEST = 1
+	LEVEL_DEFAULT = 3
+	LEVEL_BETTER  = 7
+	LEVEL_BEST    = 11
+)
+
+const (
+	MIN_LEVEL = 1
+	MAX_LEVEL = 22
+)
+
+var ErrWriterClosed = errors.New("zstd writer is closed")
+
+type CodecOpts struct {
+	// Level is the compression level, 0 means LEVEL_DEFAULT.
+	Level int
+	// Dictionary is a dictionary built with BuildDictionary. Data compressed with a dictionary can
+	// only be decompressed by a codec that has the same dictionary.
+	Dictionary []byte
+}
+
+// Codec compresses and decompresses zstd data. Whole buffers are handled by one encoder and one
+// decoder shared by every caller, streams get an encoder or decoder from a pool, so none of them
+// are allocated per call. A Codec is safe for concurrent use.
+type Codec struct {
+	encoder     *zstd.Encoder
+	decoder     *zstd.Decoder
+	encoderOpts []zstd.EOption
+	decoderOpts []zstd.DOption
+	writers     sync.Pool
+	readers     sync.Pool
+}
+
+func NewCodec(opts *CodecOpts) (*Codec, error) {
+	if opts == nil {
+		opts = &CodecOpts{}
+	}
+
+	level := opts.Level
+	if level == 0 {
+		level = LEVEL_DEFAULT
+	}
+
+	if level < MIN_LEVEL || level > MAX_LEVEL {
+		return nil, fmt.Errorf("invalid zstd level %d, must be between %d and %d", level, MIN_LEVEL, MAX_LEVEL)
+	}
+
+	c := &Codec{
+		encoderOpts: []zstd.EOption{
+			zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+			zstd.WithZeroFrames(true),
+		},
+		// streams are decoded synchronously, pooled decoders must not keep goroutines running
+		decoderOpts: []zstd.DOption{
+			zstd.WithDecoderConcurrency(1),
+		},
+	}
+
+	if opts.Dictionary != nil {
+		c.encoderOpts = append(c.encoderOpts, zstd.WithEncoderDict(opts.Dictionary))
+		c.decoderOpts = append(c.decoderOpts, zstd.WithDecoderDicts(opts.Dictionary))
+	}
+
+	var err error
+	c.encoder, err = zstd.NewWriter(nil, c.encoderOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = encoder.Write(data)
+	c.decoder, err = zstd.NewReader(nil, append(c.decoderOpts, zstd.WithDecoderConcurrency(0))...)
 	if err != nil {
 		return nil, err
 	}
 
-	encoder.Close()
-	return buf.Bytes(), err
+	return c, nil
 }
 
-func DecompressZSTD(data []byte) ([]byte, error) {
-	b := bytes.NewBuffer(data)
-	decoder, err := zstd.NewReader(b)
+// Compress compresses data into a single zstd frame.
+func (c *Codec) Compress(data []byte) []byte {
+	return c.encoder.EncodeAll(data, nil)
+}
+
+// AppendCompress compresses data and appends the frame to dst, so callers can reuse a buffer.
+func (c *Codec) AppendCompress(dst, data []byte) []byte {
+	return c.encoder.EncodeAll(data, dst)
+}
+
+func (c *Codec) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+// AppendDecompress decompresses data and appends the result to dst, so callers can reuse a buffer.
+func (c *Codec) AppendDecompress(dst, data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, dst)
+}
+
+// Writer compresses everything written to it into w. It has to be closed to write the end of the
+// frame, closing it hands its encoder back to the codec.
+type Writer struct {
+	codec   *Codec
+	encoder *zstd.Encoder
+}
+
+// NewWriter returns a Writer that compresses into w.
+func (c *Codec) NewWriter(w io.Writer) (*Writer, error) {
+	encoder, ok := c.writers.Get().(*zstd.Encoder)
+	if ok {
+		encoder.Reset(w)
+		return &Writer{codec: c, encoder: encoder}, nil
+	}
+
+	// streaming encoders compress on the calling goroutine, pooled encoders must not keep goroutines running
+	encoder, err := zstd.NewWriter(w, append(c.encoderOpts, zstd.WithEncoderConcurrency(1))...)
 	if err != nil {
 		return nil, err
 	}
-	defer decoder.Close()
 
-	var out bytes.Buffer
-	if _, err = io.Copy(&out, decoder); err != nil {
+	return &Writer{codec: c, encoder: encoder}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.encoder == nil {
+		return 0, ErrWriterClosed
+	}
+	return w.encoder.Write(p)
+}
+
+// ReadFrom compresses everything read from r.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.encoder == nil {
+		return 0, ErrWriterClosed
+	}
+	return w.encoder.ReadFrom(r)
+}
+
+// Flush writes out everything written so far as a complete block, readers can decode it without
+// waiting for the frame to end.
+func (w *Writer) Flush() error {
+	if w.encoder == nil {
+		return ErrWriterClosed
+	}
+	return w.encoder.Flush()
+}
+
+// Close ends the frame. Closing a Writer more than once is a no-op.
+func (w *Writer) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+
+	err := w.encoder.Close()
+	w.encoder.Reset(nil)
+	w.codec.writers.Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// Reader decompresses a zstd stream. Closing it hands its decoder back to the codec, it does not
+// close the underlying reader.
+type Reader struct {
+	codec   *Codec
+	decoder *zstd.Decoder
+}
+
+// NewReader returns a Reader that decompresses r.
+func (c *Codec) NewReader(r io.Reader) (*Reader, error) {
+	decoder, ok := c.readers.Get().(*zstd.Decoder)
+	if ok {
+		if err := decoder.Reset(r); err != nil {
+			return nil, err
+		}
+		return &Reader{codec: c, decoder: decoder}, nil
+	}
+
+	decoder, err := zstd.NewReader(r, c.decoderOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{codec: c, decoder: decoder}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.decoder == nil {
+		return 0, zstd.ErrDecoderClosed
+	}
+	return r.decoder.Read(p)
+}
+
+// WriteTo writes the decompressed stream to w.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	if r.decoder == nil {
+		return 0, zstd.ErrDecoderClosed
+	}
+	return r.decoder.WriteTo(w)
+}
+
+// Close releases the decoder. Closing a Reader more than once is a no-op.
+func (r *Reader) Close() error {
+	if r.decoder == nil {
+		return nil
+	}
+
+	r.decoder.Reset(nil)
+	r.codec.readers.Put(r.decoder)
+	r.decoder = nil
+	return nil
+}
+
+// BuildDictionary builds a dictionary from samples of the data it will be used for, such as a few
+// hundred typical payloads. The most recent size bytes of the samples become the dictionary history.
+// Dictionaries pay off for many small payloads that share structure, large payloads gain little.
+func BuildDictionary(id uint32, samples [][]byte, size int) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to build a dictionary from")
+	}
+
+	var history []byte
+	for i := len(samples) - 1; i >= 0 && len(history) < size; i-- {
+		sample := samples[i]
+		if remaining := size - len(history); len(sample) > remaining {
+			sample = sample[len(sample)-remaining:]
+		}
+		history = append(append([]byte{}, sample...), history...)
+	}
+
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+}
+
+// defaultCodec backs CompressZSTD and DecompressZSTD.
+var defaultCodec = sync.OnceValues(func() (*Codec, error) {
+	return NewCodec(nil)
+})
+
+// CompressZSTD compresses data at the default level.
+func CompressZSTD(data []byte) ([]byte, error) {
+	codec, err := defaultCodec()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Compress(data), nil
+}
+
+// DecompressZSTD decompresses data compressed without a dictionary.
+func DecompressZSTD(data []byte) ([]byte, error) {
+	codec, err := defaultCodec()
+	if err != nil {
 		return nil, err
 	}
-	return out.Bytes(), nil
+	return codec.Decompress(data)
 }
@@ -2,7 +2,12 @@ package compression
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"sync"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestCompressZSTD(t *testing.T) {
@@ -148,3 +153,360 @@ func TestDecompressInvalidData(t *testing.T) {
 		})
 	}
 }
+
+// sampleJSON returns a listing like JSON document, the kind of payload the codec is used for.
+func sampleJSON(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":"%08d-5f0e-4c1b-9a7d-2f6b1c9e%04d","name":"vintage watch %d","category":"watches","description":"A well kept watch with its original box and papers, serviced in %d.","price":"%d.00","currency":"EUR","images":[{"id":"%08d","url":"/images/%08d","order":0}]}`, i, i%10000, i, 2000+i%25, 100+i*7, i, i))
+}
+
+func TestCodecLevels(t *testing.T) {
+	data := bytes.Repeat(sampleJSON(1), 100)
+
+	for _, level := range []int{0, LEVEL_FASTEST, LEVEL_DEFAULT, LEVEL_BETTER, LEVEL_BEST, MAX_LEVEL} {
+		codec, err := NewCodec(&CodecOpts{Level: level})
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+
+		compressed := codec.Compress(data)
+		if len(compressed) >= len(data) {
+			t.Errorf("level %d did not compress, %d >= %d bytes", level, len(compressed), len(data))
+		}
+
+		got, err := codec.Decompress(compressed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("level %d round trip failed: %v", level, err)
+		}
+	}
+
+	for _, level := range []int{-1, MAX_LEVEL + 1} {
+		if _, err := NewCodec(&CodecOpts{Level: level}); err == nil {
+			t.Errorf("expected level %d to be rejected", level)
+		}
+	}
+}
+
+func TestCodecStreaming(t *testing.T) {
+	codec, err := NewCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat(sampleJSON(2), 5000)
+
+	// run the round trip a few times so pooled encoders and decoders are reused
+	for range 3 {
+		var compressed bytes.Buffer
+		w, err := codec.NewWriter(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write(data[:1000]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.ReadFrom(bytes.NewReader(data[1000:])); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("closing twice: %v", err)
+		}
+		if _, err := w.Write(data); err != ErrWriterClosed {
+			t.Fatalf("expected ErrWriterClosed, got %v", err)
+		}
+
+		// streams and whole buffers produce the same format
+		whole, err := codec.Decompress(compressed.Bytes())
+		if err != nil || !bytes.Equal(whole, data) {
+			t.Fatalf("decompressing a stream as a buffer failed: %v", err)
+		}
+
+		r, err := codec.NewReader(bytes.NewReader(compressed.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("stream round trip failed: %v", err)
+		}
+
+		r.Close()
+		if err := r.Close(); err != nil {
+			t.Fatalf("closing twice: %v", err)
+		}
+	}
+
+	r, err := codec.NewReader(bytes.NewReader([]byte("invalid data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected reading invalid data to fail")
+	}
+}
+
+func TestCodecConcurrent(t *testing.T) {
+	codec, err := NewCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := bytes.Repeat(sampleJSON(i), 50)
+
+			got, err := codec.Decompress(codec.Compress(data))
+			if err != nil || !bytes.Equal(got, data) {
+				errs <- fmt.Errorf("buffer %d: %v", i, err)
+				return
+			}
+
+			var buf bytes.Buffer
+			w, err := codec.NewWriter(&buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			w.Write(data)
+			w.Close()
+
+			r, err := codec.NewReader(&buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer r.Close()
+
+			got, err = io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				errs <- fmt.Errorf("stream %d: %v", i, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCodecDictionary(t *testing.T) {
+	samples := make([][]byte, 500)
+	for i := range samples {
+		samples[i] = sampleJSON(i)
+	}
+
+	dict, err := BuildDictionary(1, samples, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := NewCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withDict, err := NewCodec(&CodecOpts{Dictionary: dict})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := sampleJSON(1234)
+	compressed := withDict.Compress(data)
+	if len(compressed) >= len(plain.Compress(data)) {
+		t.Errorf("dictionary did not help, %d >= %d bytes", len(compressed), len(plain.Compress(data)))
+	}
+
+	got, err := withDict.Decompress(compressed)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("dictionary round trip failed: %v", err)
+	}
+
+	if _, err := plain.Decompress(compressed); err == nil {
+		t.Fatal("expected decompressing without the dictionary to fail")
+	}
+
+	if _, err := BuildDictionary(1, nil, 1024); err == nil {
+		t.Fatal("expected building a dictionary without samples to fail")
+	}
+}
+
+// compressPerCall and decompressPerCall are how the package used to work, creating an encoder or
+// decoder for every call. The benchmarks compare them against the pooled codec.
+func compressPerCall(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = encoder.Write(data); err != nil {
+		return nil, err
+	}
+
+	err = encoder.Close()
+	return buf.Bytes(), err
+}
+
+func decompressPerCall(data []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	var out bytes.Buffer
+	if _, err = io.Copy(&out, decoder); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+var benchmarkSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+func benchmarkData(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		buf.Write(sampleJSON(i))
+	}
+	return buf.Bytes()[:size]
+}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := benchmarkData(size)
+
+		b.Run(fmt.Sprintf("per-call/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				if _, err := compressPerCall(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("pooled/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				if _, err := CompressZSTD(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("append/%d", size), func(b *testing.B) {
+			codec, err := NewCodec(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			var dst []byte
+			for b.Loop() {
+				dst = codec.AppendCompress(dst[:0], data)
+			}
+		})
+
+		b.Run(fmt.Sprintf("stream/%d", size), func(b *testing.B) {
+			codec, err := NewCodec(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				w, err := codec.NewWriter(io.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+				w.Write(data)
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		compressed, err := CompressZSTD(benchmarkData(size))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("per-call/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				if _, err := decompressPerCall(compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("pooled/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				if _, err := DecompressZSTD(compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("append/%d", size), func(b *testing.B) {
+			codec, err := NewCodec(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			var dst []byte
+			for b.Loop() {
+				if dst, err = codec.AppendDecompress(dst[:0], compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("stream/%d", size), func(b *testing.B) {
+			codec, err := NewCodec(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				r, err := codec.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := r.WriteTo(io.Discard); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package imaging validates uploaded images and re-encodes them into the renditions listings are served in.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MAX_BYTES     = 10 << 20
+	MAX_DIMENSION = 8000
+	MAX_PIXELS    = 40_000_000
+	JPEG_QUALITY  = 85
+)
+
+const (
+	SIZE_THUMB  = "thumb"
+	SIZE_MEDIUM = "medium"
+	SIZE_FULL   = "full"
+
+	THUMB_BOUNDS  = 320
+	MEDIUM_BOUNDS = 1280
+)
+
+const (
+	CONTENT_JPEG = "image/jpeg"
+	CONTENT_PNG  = "image/png"
+	CONTENT_GIF  = "image/gif"
+	CONTENT_WEBP = "image/webp"
+)
+
+var (
+	ErrEmpty             = errors.New("image is empty")
+	ErrTooLarge          = fmt.Errorf("image is larger than %d bytes", MAX_BYTES)
+	ErrUnsupportedFormat = errors.New("unsupported image format, must be jpeg, png, webp or gif")
+	ErrDimensions        = fmt.Errorf("image dimensions must be at most %dx%d and %d pixels", MAX_DIMENSION, MAX_DIMENSION, MAX_PIXELS)
+)
+
+// formats maps sniffed content types to the name the image package registers their decoder under.
+var formats = map[string]string{
+	CONTENT_JPEG: "jpeg",
+	CONTENT_PNG:  "png",
+	CONTENT_GIF:  "gif",
+	CONTENT_WEBP: "webp",
+}
+
+// Rendition is an encoded version of an image that fits within the bounds of its size.
+type Rendition struct {
+	Size        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process validates an uploaded image and re-encodes it into full, medium and thumb renditions.
+// Re-encoding drops all metadata, so EXIF data including GPS coordinates never reaches storage.
+// The EXIF orientation of JPEG photos is applied to the pixels before it is dropped.
+//
+// JPEG and PNG images keep their format, GIF and WebP images become JPEG when they are opaque and
+// PNG otherwise, as there is no WebP encoder in pure Go. Animated GIFs keep only their first frame.
+func Process(data []byte) (renditions []Rendition, err error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+
+	if len(data) > MAX_BYTES {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// check the dimensions from the header before decoding, so small files can not expand into huge bitmaps
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s image: %w", format, err)
+	}
+
+	if decoded != format {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MAX_DIMENSION || config.Height > MAX_DIMENSION || config.Width*config.Height > MAX_PIXELS {
+		return nil, ErrDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s image: %w", format, err)
+	}
+
+	if contentType == CONTENT_JPEG {
+		img = applyOrientation(img, exifOrientation(data))
+	}
+
+	outputType := contentType
+	if contentType == CONTENT_GIF || contentType == CONTENT_WEBP {
+		outputType = CONTENT_PNG
+		if isOpaque(img) {
+			outputType = CONTENT_JPEG
+		}
+	}
+
+	renditions = make([]Rendition, 0, 3)
+	for _, size := range []struct {
+		name   string
+		bounds int
+	}{
+		{SIZE_FULL, 0},
+		{SIZE_MEDIUM, MEDIUM_BOUNDS},
+		{SIZE_THUMB, THUMB_BOUNDS},
+	} {
+		scaled := fit(img, size.bounds)
+
+		encoded, err := encode(scaled, outputType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s rendition: %w", size.name, err)
+		}
+
+		renditions = append(renditions, Rendition{
+			Size:        size.name,
+			ContentType: outputType,
+			Width:       scaled.Bounds().Dx(),
+			Height:      scaled.Bounds().Dy(),
+			Data:        encoded,
+		})
+	}
+
+	return renditions, nil
+}
+
+// IsSize reports whether size is one of the rendition sizes.
+func IsSize(size string) bool {
+	return size == SIZE_FULL || size == SIZE_MEDIUM || size == SIZE_THUMB
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// fit scales img down so both sides are at most bounds pixels, keeping the aspect ratio.
+// Images that already fit, or a bounds of 0, are returned as they are.
+func fit(img image.Image, bounds int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if bounds == 0 || (w <= bounds && h <= bounds) {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*bounds/w)
+		w = bounds
+	} else {
+		w = max(1, w*bounds/h)
+		h = bounds
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case CONTENT_JPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEG_QUALITY})
+	case CONTENT_PNG:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return buf.Bytes(), err
+}
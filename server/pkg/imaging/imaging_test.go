@@ -0,0 +1,223 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExif splices an EXIF segment holding an orientation and a fake GPS marker in after the SOI marker.
+func withExif(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, "GPS 52.3676N 4.9041E"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func rendition(t *testing.T, renditions []Rendition, size string) Rendition {
+	t.Helper()
+	for _, r := range renditions {
+		if r.Size == size {
+			return r
+		}
+	}
+	t.Fatalf("missing %s rendition", size)
+	return Rendition{}
+}
+
+func TestProcessRenditions(t *testing.T) {
+	renditions, err := Process(encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 2000, 1000))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		size          string
+		width, height int
+	}{
+		{SIZE_FULL, 2000, 1000},
+		{SIZE_MEDIUM, 1280, 640},
+		{SIZE_THUMB, 320, 160},
+	}
+
+	for _, tt := range tests {
+		r := rendition(t, renditions, tt.size)
+		if r.Width != tt.width || r.Height != tt.height || r.ContentType != CONTENT_JPEG {
+			t.Errorf("%s rendition is %dx%d %s, want %dx%d image/jpeg", tt.size, r.Width, r.Height, r.ContentType, tt.width, tt.height)
+		}
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(r.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.Width != tt.width || config.Height != tt.height {
+			t.Errorf("%s rendition decodes to %dx%d, want %dx%d", tt.size, config.Width, config.Height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestProcessSmallImageIsNotUpscaled(t *testing.T) {
+	renditions, err := Process(encodePNG(t, image.NewNRGBA(image.Rect(0, 0, 10, 20))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range renditions {
+		if r.Width != 10 || r.Height != 20 || r.ContentType != CONTENT_PNG {
+			t.Errorf("%s rendition is %dx%d %s, want 10x20 image/png", r.Size, r.Width, r.Height, r.ContentType)
+		}
+	}
+}
+
+func TestProcessStripsExifAndAppliesOrientation(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	src.Set(0, 0, color.White)
+
+	renditions, err := Process(withExif(encodeJPEG(t, src), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := rendition(t, renditions, SIZE_FULL)
+	if bytes.Contains(full.Data, []byte("Exif")) || bytes.Contains(full.Data, []byte("GPS")) {
+		t.Fatal("EXIF metadata was not stripped")
+	}
+
+	if full.Width != 20 || full.Height != 40 {
+		t.Fatalf("rotated image is %dx%d, want 20x40", full.Width, full.Height)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	if o := exifOrientation(jpg); o != 1 {
+		t.Errorf("orientation without EXIF = %d, want 1", o)
+	}
+
+	for o := uint16(1); o <= 8; o++ {
+		if got := exifOrientation(withExif(jpg, o)); got != int(o) {
+			t.Errorf("orientation = %d, want %d", got, o)
+		}
+	}
+
+	if o := exifOrientation(withExif(jpg, 42)); o != 1 {
+		t.Errorf("invalid orientation = %d, want 1", o)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a 2x1 image with a white pixel on the left
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.White)
+
+	tests := []struct {
+		orientation int
+		width       int
+		white       image.Point
+	}{
+		{2, 2, image.Pt(1, 0)},
+		{3, 2, image.Pt(1, 0)},
+		{4, 2, image.Pt(0, 0)},
+		{5, 1, image.Pt(0, 0)},
+		{6, 1, image.Pt(0, 0)},
+		{7, 1, image.Pt(0, 1)},
+		{8, 1, image.Pt(0, 1)},
+	}
+
+	for _, tt := range tests {
+		out := applyOrientation(src, tt.orientation)
+		if out.Bounds().Dx() != tt.width {
+			t.Errorf("orientation %d: width = %d, want %d", tt.orientation, out.Bounds().Dx(), tt.width)
+			continue
+		}
+
+		if r, _, _, _ := out.At(tt.white.X, tt.white.Y).RGBA(); r != 0xffff {
+			t.Errorf("orientation %d: expected white pixel at %v", tt.orientation, tt.white)
+		}
+	}
+}
+
+func TestProcessConvertsGif(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := rendition(t, renditions, SIZE_FULL).ContentType; ct != CONTENT_JPEG {
+		t.Fatalf("opaque gif was converted to %s, want image/jpeg", ct)
+	}
+}
+
+func TestProcessRejectsInvalidImages(t *testing.T) {
+	truncated := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "empty", data: nil, want: ErrEmpty},
+		{name: "too many bytes", data: make([]byte, MAX_BYTES+1), want: ErrTooLarge},
+		{name: "not an image", data: []byte("<html><body>hi</body></html>"), want: ErrUnsupportedFormat},
+		{name: "bmp", data: append([]byte("BM"), make([]byte, 64)...), want: ErrUnsupportedFormat},
+		{name: "too wide", data: encodePNG(t, image.NewGray(image.Rect(0, 0, MAX_DIMENSION+1, 1))), want: ErrDimensions},
+		{name: "truncated", data: truncated[:len(truncated)/2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(tt.data)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package mailer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts a single message without TLS or authentication and sends what it received on
+// the returned channel.
+func fakeSMTP(t *testing.T) (addr *net.TCPAddr, received <-chan string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		var transcript strings.Builder
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-fake")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 ok")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- transcript.String()
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr), ch
+}
+
+func TestSMTPSend(t *testing.T) {
+	addr, received := fakeSMTP(t)
+
+	s, err := NewSMTP(addr.IP.String(), addr.Port, "", "", "Luxora <noreply@luxoras.nl>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(t.Context(), &Message{
+		To:      "jack@example.com",
+		Subject: "Bevestig je e-mailadres ✓",
+		Body:    "Open this link:\nhttps://luxoras.nl/auth/verify-email?token=abc.def.ghi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transcript string
+	select {
+	case transcript = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive the message")
+	}
+
+	if !strings.Contains(transcript, "MAIL FROM:<noreply@luxoras.nl>") || !strings.Contains(transcript, "RCPT TO:<jack@example.com>") {
+		t.Fatalf("unexpected envelope:\n%s", transcript)
+	}
+
+	_, data, _ := strings.Cut(transcript, "DATA\r\n")
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Bevestig je e-mailadres ✓" {
+		t.Fatalf("got subject %q", subject)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "https://luxoras.nl/auth/verify-email?token=abc.def.ghi") {
+		t.Fatalf("link missing from body:\n%s", body)
+	}
+}
+
+func TestMessageHeaderInjection(t *testing.T) {
+	l := &Log{}
+
+	tests := []*Message{
+		{To: "jack@example.com\r\nBcc: everyone@example.com", Subject: "hi"},
+		{To: "jack@example.com", Subject: "hi\nBcc: everyone@example.com"},
+		{To: "not an address", Subject: "hi"},
+	}
+
+	for _, msg := range tests {
+		if err := l.Send(t.Context(), msg); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%+v: got %v, want %v", msg, err, ErrInvalidMessage)
+		}
+	}
+}
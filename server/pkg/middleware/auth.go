@@ -4,24 +4,49 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	tk "github.com/gopher93185789/luxora/server/pkg/token"
 )
 
+// Revocations tells whether a valid access token was revoked before it expired.
+type Revocations interface {
+	IsRevoked(claims *tk.TokenClaims) bool
+}
+
 type AuthMiddleWareConfig struct {
-	auth *tk.BstConfig
+	auth        *tk.BstConfig
+	revocations Revocations
 }
 
 type ValidTokenResponse struct {
 	Expiry time.Time `json:"exp"`
 }
 
-func New(a *tk.BstConfig) *AuthMiddleWareConfig {
+// New creates the auth middleware, with a nil Revocations every token with a valid signature and
+// expiry is accepted.
+func New(a *tk.BstConfig, revocations Revocations) *AuthMiddleWareConfig {
 	return &AuthMiddleWareConfig{
-		auth: a,
+		auth:        a,
+		revocations: revocations,
+	}
+}
+
+// verify checks an access token and that it was not revoked.
+func (a *AuthMiddleWareConfig) verify(token string) (*tk.TokenClaims, error) {
+	claims, err := a.auth.VerifyTokenAndGetFields(token, tk.ACCESS_TOKEN)
+	if err != nil {
+		return nil, err
 	}
+
+	if a.revocations != nil && a.revocations.IsRevoked(claims) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	return claims, nil
 }
 
 func (a *AuthMiddleWareConfig) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -32,17 +57,35 @@ func (a *AuthMiddleWareConfig) AuthMiddleware(next http.HandlerFunc) http.Handle
 			return
 		}
 
-		userID, err := a.auth.VerifyToken(token, tk.ACCESS_TOKEN)
+		claims, err := a.verify(token)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		r.Header.Set("USERID", userID.String())
+		r.Header.Set("USERID", claims.UserID.String())
+		r.Header.Set("SESSIONID", claims.Payload)
+		r.Header.Set("TOKENID", claims.ID)
+		r.Header.Set("ROLES", strings.Join(claims.Roles, ","))
 		next.ServeHTTP(w, r)
 	}
 }
 
+// RequireRole authenticates a request like AuthMiddleware, and only lets it through when the
+// access token grants at least one of roles.
+func (a *AuthMiddleWareConfig) RequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return a.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		for _, role := range GetRolesFromRequest(r) {
+			if slices.Contains(roles, role) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
+
 func GetTokenFromRequest(r *http.Request) (userID uuid.UUID, err error) {
 	uidstr := r.Header.Get("USERID")
 	if uidstr == "" {
@@ -57,8 +100,34 @@ func GetTokenFromRequest(r *http.Request) (userID uuid.UUID, err error) {
 	return uid, nil
 }
 
+// GetSessionFromRequest returns the session the access token of a request belongs to, uuid.Nil
+// for tokens issued without one.
+func GetSessionFromRequest(r *http.Request) (sessionID uuid.UUID) {
+	sessionID, err := uuid.Parse(r.Header.Get("SESSIONID"))
+	if err != nil {
+		return uuid.Nil
+	}
+
+	return sessionID
+}
+
+// GetTokenIDFromRequest returns the id (jti) of the access token of a request.
+func GetTokenIDFromRequest(r *http.Request) string {
+	return r.Header.Get("TOKENID")
+}
+
+// GetRolesFromRequest returns the roles the access token of a request grants.
+func GetRolesFromRequest(r *http.Request) []string {
+	roles := r.Header.Get("ROLES")
+	if roles == "" {
+		return nil
+	}
+
+	return strings.Split(roles, ",")
+}
+
 // @Summary      Verify access token
-// @Description  Verifies the provided access token and returns its expiry if valid.
+// @Description  Verifies the provided access token and returns its expiry if valid and not revoked.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -74,7 +143,7 @@ func (a *AuthMiddleWareConfig) VerifyTokenEndpoint(w http.ResponseWriter, r *htt
 		return
 	}
 
-	fields, err := a.auth.VerifyTokenAndGetFields(token, tk.ACCESS_TOKEN)
+	fields, err := a.verify(token)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
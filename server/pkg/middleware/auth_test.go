@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	tk "github.com/gopher93185789/luxora/server/pkg/token"
+)
+
+// revokedTokens revokes tokens by their id.
+type revokedTokens map[string]bool
+
+func (r revokedTokens) IsRevoked(claims *tk.TokenClaims) bool {
+	return r[claims.ID]
+}
+
+func TestRequireRole(t *testing.T) {
+	config := &tk.BstConfig{SecretKey: []byte("skjvkfbvdkfhvjfvkjf")}
+	revoked := revokedTokens{}
+	m := New(config, revoked)
+
+	token := func(roles ...string) string {
+		t.Helper()
+		s, err := config.GenerateTokenWithRoles(uuid.New(), time.Now().Add(time.Minute), tk.ACCESS_TOKEN, uuid.NewString(), roles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	handler := m.RequireRole(func(w http.ResponseWriter, r *http.Request) {}, "moderator", "admin")
+
+	revokedAdmin := token("user", "admin")
+	claims, err := config.VerifyTokenAndGetFields(revokedAdmin, tk.ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked[claims.ID] = true
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "not a token", http.StatusUnauthorized},
+		{"without role", token("user"), http.StatusForbidden},
+		{"moderator", token("user", "moderator"), http.StatusOK},
+		{"admin", token("user", "admin"), http.StatusOK},
+		{"revoked admin", revokedAdmin, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", tt.token)
+			}
+			// roles sent by the client are replaced by those of the token
+			r.Header.Set("ROLES", "admin")
+
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
+)
+
+const (
+	ENCODING_ZSTD     = "zstd"
+	ENCODING_GZIP     = "gzip"
+	ENCODING_IDENTITY = "identity"
+)
+
+// DEFAULT_MIN_COMPRESS_SIZE is roughly where compression stops paying for its framing overhead.
+const DEFAULT_MIN_COMPRESS_SIZE = 1024
+
+// supportedEncodings is in order of preference, used to break ties between equal q values.
+var supportedEncodings = []string{ENCODING_ZSTD, ENCODING_GZIP}
+
+// incompressibleTypes are compressed already, compressing them again only costs CPU.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+}
+
+type CompressionConfig struct {
+	// MinSize is the smallest body that is compressed. Streams that are flushed before reaching it
+	// are compressed regardless, they can keep growing.
+	MinSize int
+
+	codec       *compression.Codec
+	gzipLevel   int
+	gzipWriters sync.Pool
+}
+
+// NewCompression creates the compression middleware. level is a zstd level, gzip uses the same
+// level capped to the highest gzip level.
+func NewCompression(minSize, level int) (*CompressionConfig, error) {
+	codec, err := compression.NewCodec(&compression.CodecOpts{Level: level})
+	if err != nil {
+		return nil, err
+	}
+
+	if level == 0 {
+		level = compression.LEVEL_DEFAULT
+	}
+
+	return &CompressionConfig{
+		MinSize:   minSize,
+		codec:     codec,
+		gzipLevel: min(level, gzip.BestCompression),
+	}, nil
+}
+
+// CompressionMiddleware compresses responses with the best encoding the client accepts.
+func (c *CompressionConfig) CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == ENCODING_IDENTITY || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, config: c, encoding: encoding}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// NegotiateEncoding picks the supported encoding with the highest q value in an Accept-Encoding
+// header, or identity when the client accepts none of them.
+func NegotiateEncoding(header string) string {
+	best, bestQ := ENCODING_IDENTITY, 0.0
+	wildcard := -1.0
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+
+	for _, encoding := range supportedEncodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// compressWriter holds back the start of a response until it knows whether it is worth compressing,
+// either because MinSize bytes were written, the handler flushed or the handler returned.
+type compressWriter struct {
+	http.ResponseWriter
+	config   *CompressionConfig
+	encoding string
+
+	status      int
+	buf         []byte
+	decided     bool
+	encoder     io.WriteCloser
+	gzipEncoder *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// informational responses go out as they are, the final response follows later
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.config.MinSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide writes the header, compressing the response if it is big enough and of a type worth
+// compressing, and then writes out what was held back.
+func (cw *compressWriter) decide(bigEnough bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compress := bigEnough &&
+		cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified &&
+		cw.status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		compressible(h.Get("Content-Type"))
+
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		// the compressed body is a different representation, so a strong validator no longer holds
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		if err := cw.startEncoder(); err != nil {
+			return err
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) startEncoder() (err error) {
+	switch cw.encoding {
+	case ENCODING_ZSTD:
+		cw.encoder, err = cw.config.codec.NewWriter(cw.ResponseWriter)
+		return err
+	default:
+		gz, ok := cw.config.gzipWriters.Get().(*gzip.Writer)
+		if ok {
+			gz.Reset(cw.ResponseWriter)
+		} else {
+			gz, err = gzip.NewWriterLevel(cw.ResponseWriter, cw.config.gzipLevel)
+			if err != nil {
+				return err
+			}
+		}
+		cw.encoder, cw.gzipEncoder = gz, gz
+		return nil
+	}
+}
+
+// Flush sends everything written so far to the client, which keeps server sent events working.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		// nothing was written at all, leave the response to net/http
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.encoder == nil {
+		return
+	}
+
+	cw.encoder.Close()
+	if cw.gzipEncoder != nil {
+		cw.gzipEncoder.Reset(io.Discard)
+		cw.config.gzipWriters.Put(cw.gzipEncoder)
+	}
+	cw.encoder, cw.gzipEncoder = nil, nil
+}
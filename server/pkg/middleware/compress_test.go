@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	compression "github.com/gopher93185789/luxora/server/pkg/compressions"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ENCODING_IDENTITY},
+		{"br", ENCODING_IDENTITY},
+		{"gzip", ENCODING_GZIP},
+		{"gzip, deflate, br, zstd", ENCODING_ZSTD},
+		{"zstd;q=0.5, gzip", ENCODING_GZIP},
+		{"zstd;q=0, gzip;q=0.1", ENCODING_GZIP},
+		{"zstd;q=0, gzip;q=0", ENCODING_IDENTITY},
+		{"*", ENCODING_ZSTD},
+		{"*;q=0.5, zstd;q=0", ENCODING_GZIP},
+		{"GZIP ; q=0.8", ENCODING_GZIP},
+		{"gzip;q=abc", ENCODING_IDENTITY},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("NegotiateEncoding(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case ENCODING_GZIP:
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case ENCODING_ZSTD:
+		codec, err := compression.NewCodec(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := codec.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return body
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	c, err := NewCompression(DEFAULT_MIN_COMPRESS_SIZE, compression.LEVEL_FASTEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := []byte(`{"items":[` + strings.Repeat(`{"name":"vintage watch","price":"100.00"},`, 200) + `{}]}`)
+	small := []byte(`{"ok":true}`)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		etag           string
+		status         int
+		body           []byte
+		wantEncoding   string
+	}{
+		{"zstd", "gzip, zstd", "application/json", "", http.StatusOK, large, ENCODING_ZSTD},
+		{"gzip", "gzip", "application/json", "", http.StatusOK, large, ENCODING_GZIP},
+		{"not accepted", "br", "application/json", "", http.StatusOK, large, ""},
+		{"small body", "zstd", "application/json", "", http.StatusOK, small, ""},
+		{"already compressed type", "zstd", "image/png", "", http.StatusOK, large, ""},
+		{"sniffed type", "zstd", "", "", http.StatusOK, large, ENCODING_ZSTD},
+		{"error status", "gzip", "application/json", "", http.StatusBadRequest, large, ENCODING_GZIP},
+		{"strong etag", "zstd", "application/json", `"abc"`, http.StatusOK, large, ENCODING_ZSTD},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := c.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				w.WriteHeader(tt.status)
+				// write in pieces so the middleware has to buffer across writes
+				for chunk := range slicesChunk(tt.body, 100) {
+					w.Write(chunk)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+
+			if got := res.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+
+			if res.Header.Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("Vary = %q, want Accept-Encoding", res.Header.Get("Vary"))
+			}
+
+			if tt.wantEncoding != "" && rec.Body.Len() >= len(tt.body) {
+				t.Fatalf("body was not compressed, %d >= %d bytes", rec.Body.Len(), len(tt.body))
+			}
+
+			if got := decode(t, tt.wantEncoding, rec.Body.Bytes()); !bytes.Equal(got, tt.body) {
+				t.Fatalf("body does not round trip, got %d bytes want %d", len(got), len(tt.body))
+			}
+
+			if tt.etag != "" && res.Header.Get("ETag") != "W/"+tt.etag {
+				t.Fatalf("ETag = %q, want a weak validator", res.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareNoBody(t *testing.T) {
+	c, err := NewCompression(DEFAULT_MIN_COMPRESS_SIZE, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := c.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Fatalf("unexpected response %d %q with %d bytes", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.Len())
+	}
+}
+
+// TestCompressionMiddlewareFlush streams server sent events through a real server and checks every
+// event reaches the client as soon as it is flushed, before the handler returns.
+func TestCompressionMiddlewareFlush(t *testing.T) {
+	c, err := NewCompression(DEFAULT_MIN_COMPRESS_SIZE, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := make(chan struct{})
+	srv := httptest.NewServer(c.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := range 3 {
+			io.WriteString(w, "data: event "+string(rune('0'+i))+"\n\n")
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	})))
+	defer srv.Close()
+
+	for _, encoding := range []string{ENCODING_ZSTD, ENCODING_GZIP} {
+		t.Run(encoding, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", encoding)
+
+			res, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.Header.Get("Content-Encoding") != encoding {
+				t.Fatalf("Content-Encoding = %q, want %s", res.Header.Get("Content-Encoding"), encoding)
+			}
+
+			var body io.Reader
+			if encoding == ENCODING_GZIP {
+				gz, err := gzip.NewReader(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			} else {
+				codec, _ := compression.NewCodec(nil)
+				zr, err := codec.NewReader(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				body = zr
+			}
+
+			lines := make(chan string)
+			go func() {
+				scanner := bufio.NewScanner(body)
+				for scanner.Scan() {
+					if scanner.Text() != "" {
+						lines <- scanner.Text()
+					}
+				}
+				close(lines)
+			}()
+
+			for i := range 3 {
+				select {
+				case line := <-lines:
+					if want := "data: event " + string(rune('0'+i)); line != want {
+						t.Fatalf("got %q, want %q", line, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("event %d was not flushed", i)
+				}
+				next <- struct{}{}
+			}
+
+			// the handler has returned, wait for the end of the stream before the reader is closed
+			for range lines {
+			}
+		})
+	}
+}
+
+func slicesChunk(data []byte, size int) func(func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for len(data) > 0 {
+			n := min(size, len(data))
+			if !yield(data[:n]) {
+				return
+			}
+			data = data[n:]
+		}
+	}
+}
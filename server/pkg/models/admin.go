@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Every user has ROLE_USER, the other roles are granted. ROLE_VERIFIER is granted the same way.
+const (
+	ROLE_USER      = "user"
+	ROLE_MODERATOR = "moderator"
+	ROLE_ADMIN     = "admin"
+)
+
+const (
+	ROLE_ACTION_GRANT  = "grant"
+	ROLE_ACTION_REVOKE = "revoke"
+)
+
+// RoleChange is an entry of the role audit log. ActorID is nil for changes made from the command
+// line or by a user that was deleted since.
+type RoleChange struct {
+	AuditID   uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Role      string     `json:"role"`
+	Action    string     `json:"action"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"`
+	ChangedAt time.Time  `json:"changed_at"`
+}
+
+type PlatformStats struct {
+	Users                int64 `json:"users"`
+	SuspendedUsers       int64 `json:"suspended_users"`
+	ActiveSessions       int64 `json:"active_sessions"`
+	ActiveListings       int64 `json:"active_listings"`
+	DraftListings        int64 `json:"draft_listings"`
+	SoldListings         int64 `json:"sold_listings"`
+	Bids                 int64 `json:"bids"`
+	PendingVerifications int64 `json:"pending_verifications"`
+}
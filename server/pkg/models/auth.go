@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Signup struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Login struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// EmailToken is a token from a link sent by email.
+type EmailToken struct {
+	Token string `json:"token"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type EmailAddress struct {
+	Email string `json:"email"`
+}
+
+// Session is a device a user is logged in on, each has its own refresh token.
+type Session struct {
+	SessionID  uuid.UUID `json:"session_id"`
+	UserID     uuid.UUID `json:"-"`
+	TokenHash  string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set on the session the request was made with
+	Current bool `json:"current"`
+}
+
+// Client is the device a request comes from, recorded on its session.
+type Client struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Revocation makes access tokens stop working before they expire. Subject is a token id, session id
+// or user id depending on Kind, for users only tokens issued up to RevokedAt are revoked.
+type Revocation struct {
+	Kind      string
+	Subject   string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ATTRIBUTE_TYPE_STRING  = "string"
+	ATTRIBUTE_TYPE_NUMBER  = "number"
+	ATTRIBUTE_TYPE_BOOLEAN = "boolean"
+)
+
+const (
+	FILTER_EQ  = "eq"
+	FILTER_GT  = "gt"
+	FILTER_GTE = "gte"
+	FILTER_LT  = "lt"
+	FILTER_LTE = "lte"
+)
+
+type CategoryAttribute struct {
+	Key         string `json:"key"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+}
+
+type Category struct {
+	ID           uuid.UUID           `json:"id"`
+	ParentID     *uuid.UUID          `json:"parent_id,omitempty"`
+	Slug         string              `json:"slug"`
+	DisplayName  string              `json:"display_name"`
+	Attributes   []CategoryAttribute `json:"attributes"`
+	ListingCount int                 `json:"listing_count"`
+	Children     []Category          `json:"children"`
+}
+
+// ProductAttribute is a validated attribute value as it is stored in the database.
+// Text always holds the canonical string form, Number is only set for numeric attributes.
+type ProductAttribute struct {
+	Key    string
+	Type   string
+	Text   string
+	Number *decimal.Decimal
+}
+
+type AttributeFilter struct {
+	Key    string
+	Op     string
+	Values []string
+}
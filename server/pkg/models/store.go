@@ -8,11 +8,42 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+const (
+	LISTING_STATUS_DRAFT  = "draft"
+	LISTING_STATUS_ACTIVE = "active"
+	// LISTING_STATUS_CLOSED listings ended without selling, only their owner sees them and can relist them
+	LISTING_STATUS_CLOSED = "closed"
+)
+
+const MAX_LISTING_IMAGES = 10
+
+// ProductImage is an image of a listing. Image is only used to upload base64 encoded images
+// when creating a listing, responses link to the full, medium and thumbnail renditions instead.
+// Size is the rendition Data holds when an image is served, the full size image stands in for a
+// missing rendition. Data is nil when the bytes live in a blob store, BlobURL is set when clients
+// can fetch them from there directly.
 type ProductImage struct {
-	Image           string `json:"base_64_image"`
-	Order           int    `json:"order"`
-	Checksum        string
-	CompressedImage []byte
+	ID           uuid.UUID        `json:"id"`
+	URL          string           `json:"url"`
+	MediumURL    string           `json:"medium_url"`
+	ThumbnailURL string           `json:"thumbnail_url"`
+	Image        string           `json:"base_64_image,omitempty"`
+	Order        int              `json:"order"`
+	Checksum     string           `json:"-"`
+	ContentType  string           `json:"-"`
+	Data         []byte           `json:"-"`
+	Renditions   []ImageRendition `json:"-"`
+	Size         string           `json:"-"`
+	BlobURL      string           `json:"-"`
+}
+
+// ImageRendition is a scaled down copy of an image, stored next to the full size image.
+type ImageRendition struct {
+	Size        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
 }
 
 type Product struct {
@@ -21,6 +52,12 @@ type Product struct {
 	Description string          `json:"description"`
 	Price       decimal.Decimal `json:"price"`
 	Images      []ProductImage  `json:"product_images"`
+	Status      string          `json:"status"`
+	PublishAt   *time.Time      `json:"publish_at,omitempty"`
+	Attributes  map[string]any  `json:"attributes,omitempty"`
+	Condition   string          `json:"condition,omitempty"`
+
+	AttributeValues []ProductAttribute `json:"-"`
 }
 
 type Bid struct {
@@ -57,12 +94,24 @@ type ProductInfo struct {
 	Price       decimal.Decimal `json:"price"`
 	Currency    string          `json:"string"`
 	Images      []ProductImage  `json:"product_images"`
+	Status      string          `json:"status"`
+	PublishAt   *time.Time      `json:"publish_at,omitempty"`
+	Attributes  map[string]any  `json:"attributes"`
+	Condition   string          `json:"condition,omitempty"`
+	Verified    bool            `json:"verified"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	// PriceUpdatedAt is when the current price was set, it versions the listing along with UpdatedAt
+	PriceUpdatedAt time.Time `json:"-"`
+
+	VerificationStatus string        `json:"verification_status"`
+	Verification       *Verification `json:"verification,omitempty"`
 }
 
 type UserDetails struct {
 	UserID           uuid.UUID      `json:"id"`
 	Username         string         `json:"username"`
 	Email            sql.NullString `json:"email"`
+	EmailVerified    bool           `json:"email_verified"`
 	ProfileImageLink string         `json:"profile_image_link"`
 }
 
@@ -75,6 +124,18 @@ type UpdateProduct struct {
 	Description string    `json:"description"`
 	Category    string    `json:"category"`
 	Name        string    `json:"name"`
+	Condition   string    `json:"condition"`
+	// Attributes replace all attributes of the listing when set
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	// AttributeValues are the attributes after validation against the category schema, set when
+	// the category or the attributes change
+	AttributeValues []ProductAttribute `json:"-"`
+}
+
+// ImageOrder lists every image of a listing in the order they should be shown in.
+type ImageOrder struct {
+	ImageIDs []uuid.UUID `json:"image_ids"`
 }
 
 type BidsOnUserListing struct {
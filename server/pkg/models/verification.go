@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CONDITION_NEW       = "new"
+	CONDITION_LIKE_NEW  = "like_new"
+	CONDITION_EXCELLENT = "excellent"
+	CONDITION_GOOD      = "good"
+	CONDITION_FAIR      = "fair"
+)
+
+const (
+	VERIFICATION_STATUS_UNVERIFIED = "unverified"
+	VERIFICATION_STATUS_PENDING    = "pending"
+	VERIFICATION_STATUS_VERIFIED   = "verified"
+	VERIFICATION_STATUS_REJECTED   = "rejected"
+	// a request is superseded when the listing changes before it is reviewed
+	VERIFICATION_STATUS_SUPERSEDED = "superseded"
+)
+
+const ROLE_VERIFIER = "verifier"
+
+type Verification struct {
+	VerificationID uuid.UUID  `json:"id"`
+	ProductID      uuid.UUID  `json:"product_id"`
+	ProductName    string     `json:"product_name,omitempty"`
+	RequestedBy    uuid.UUID  `json:"requested_by"`
+	ReviewerID     *uuid.UUID `json:"reviewer_id,omitempty"`
+	Status         string     `json:"status"`
+	Notes          string     `json:"notes,omitempty"`
+	RequestedAt    time.Time  `json:"requested_at"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+}
+
+type VerificationReview struct {
+	Approved bool   `json:"approved"`
+	Notes    string `json:"notes"`
+}
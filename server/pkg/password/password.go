@@ -0,0 +1,108 @@
+// Package password hashes passwords with argon2id, encoded in the PHC string format used by the
+// reference implementation, so hashes stay verifiable when the parameters are raised.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters follow the second recommended option of RFC 9106, for servers that can not spend 2 GiB
+// of memory per hash.
+const (
+	DEFAULT_MEMORY      = 64 * 1024
+	DEFAULT_ITERATIONS  = 3
+	DEFAULT_PARALLELISM = 2
+	SALT_LENGTH         = 16
+	KEY_LENGTH          = 32
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type Params struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+var DefaultParams = Params{
+	Memory:      DEFAULT_MEMORY,
+	Iterations:  DEFAULT_ITERATIONS,
+	Parallelism: DEFAULT_PARALLELISM,
+}
+
+// Hash hashes password with a random salt and the default parameters.
+func Hash(password string) (string, error) {
+	return HashWithParams(password, DefaultParams)
+}
+
+func HashWithParams(password string, params Params) (string, error) {
+	salt := make([]byte, SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, KEY_LENGTH)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decode(encoded string) (params Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
+
+// Verify reports whether password matches an encoded hash, using the parameters stored in the hash.
+func Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash reports whether an encoded hash was made with other parameters than params, so it
+// can be replaced after the next successful login.
+func NeedsRehash(encoded string, params Params) bool {
+	current, _, key, err := decode(encoded)
+	return err != nil || current != params || len(key) != KEY_LENGTH
+}
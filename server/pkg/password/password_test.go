@@ -0,0 +1,94 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testParams keeps the tests fast, the defaults take tens of milliseconds per hash.
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestHash(t *testing.T) {
+	hash, err := HashWithParams("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %s", hash)
+	}
+
+	ok, err := Verify("correct horse battery staple", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected password to match")
+	}
+
+	ok, err = Verify("correct horse battery stapler", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected other password not to match")
+	}
+
+	other, err := HashWithParams("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Fatal("expected every hash to get its own salt")
+	}
+}
+
+func TestVerifyDefaultParams(t *testing.T) {
+	hash, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := Verify("correct horse battery staple", hash); err != nil || !ok {
+		t.Fatalf("expected password to match, got %v %v", ok, err)
+	}
+
+	if NeedsRehash(hash, DefaultParams) {
+		t.Fatal("expected a hash with the default params not to need a rehash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := HashWithParams("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if NeedsRehash(hash, testParams) {
+		t.Fatal("expected hash not to need a rehash")
+	}
+
+	if !NeedsRehash(hash, DefaultParams) {
+		t.Fatal("expected hash with other params to need a rehash")
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	tests := []string{
+		"",
+		"plaintext",
+		"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$aGFzaGhhc2g",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$",
+	}
+
+	for _, hash := range tests {
+		if _, err := Verify("password", hash); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("%q: got %v, want %v", hash, err, ErrInvalidHash)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package testutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// PNG encodes a solid width x height PNG, for tests that need real image bytes.
+func PNG(width, height int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Base64PNG is PNG encoded the way listings are created through POST /listings.
+func Base64PNG(width, height int, c color.Color) string {
+	return base64.StdEncoding.EncodeToString(PNG(width, height, c))
+}
@@ -0,0 +1,384 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gopher93185789/luxora/server/pkg/logger"
+)
+
+// Algorithms keys can sign with.
+const (
+	ALG_EDDSA = "EdDSA"
+	ALG_ES256 = "ES256"
+)
+
+const (
+	// DEFAULT_KEY_PUBLISH is long enough for verifiers that cache the JWKS for a few minutes
+	DEFAULT_KEY_PUBLISH = 15 * time.Minute
+	KEY_FILE_EXT        = ".pem"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnsupportedKey   = errors.New("unsupported key, must be an Ed25519 or P-256 private key")
+	ErrNoSigningKey     = errors.New("no signing key")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+)
+
+// Key is a private key that signs tokens, verifiers find its public half by ID in the JWKS.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Created is when the key file was written, keys take over signing in order of creation
+	Created time.Time
+
+	private crypto.Signer
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// JWK is the public half of a key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newKey(private any, created time.Time) (*Key, error) {
+	k := &Key{Created: created}
+
+	switch p := private.(type) {
+	case ed25519.PrivateKey:
+		k.Method, k.private = jwt.SigningMethodEdDSA, p
+	case *ecdsa.PrivateKey:
+		if p.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedKey
+		}
+		k.Method, k.private = jwt.SigningMethodES256, p
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	k.ID = k.thumbprint()
+	return k, nil
+}
+
+// JWK describes the public key, its members are in the order RFC 7638 hashes them.
+func (k *Key) JWK() JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+
+	switch p := k.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64(p)
+	case *ecdsa.PublicKey:
+		// the uncompressed point is 0x04 followed by the 32 byte x and y coordinates
+		public, _ := p.ECDH()
+		point := public.Bytes()
+		jwk.Kty, jwk.Crv, jwk.X, jwk.Y = "EC", "P-256", b64(point[1:33]), b64(point[33:])
+	}
+
+	return jwk
+}
+
+// thumbprint is the RFC 7638 thumbprint of the public key, the same key always gets the same ID.
+func (k *Key) thumbprint() string {
+	jwk := k.JWK()
+
+	var required string
+	if jwk.Kty == "EC" {
+		required = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	} else {
+		required = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(required))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// LoadKey reads a PEM encoded PKCS #8 private key, as written by
+// `openssl genpkey -algorithm ed25519`. The modification time of the file is its creation time.
+func LoadKey(path string) (*Key, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PKCS #8 private key found", path)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	k, err := newKey(private, info.ModTime())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return k, nil
+}
+
+// GenerateKey writes a new private key for alg into dir, named after its ID.
+func GenerateKey(dir, alg string) (*Key, error) {
+	var private any
+	var err error
+
+	switch alg {
+	case ALG_EDDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case ALG_ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm '%s', must be %s or %s", alg, ALG_EDDSA, ALG_ES256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := newKey(private, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// the key is written under a temporary name first, so other servers never load half a file
+	f, err := os.CreateTemp(dir, ".key-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	err = pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(dir, k.ID+KEY_FILE_EXT)); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+type KeySetOpts struct {
+	// Algorithm of the keys generated by rotation
+	Algorithm string
+	// Rotate generates a new key once the newest one is this old, 0 leaves rotation to whoever puts
+	// key files in the directory
+	Rotate time.Duration
+	// Publish is how long a new key is only in the JWKS before it signs, so every server and
+	// verifier knows it by the time tokens signed with it show up
+	Publish time.Duration
+	// Retain is how long a key keeps verifying after a newer key took over, at least the lifetime
+	// of the longest lived token. Rotation deletes key files once they are retired.
+	Retain time.Duration
+}
+
+// KeySet holds the keys in a directory of PEM files. The newest key that was published long enough
+// signs, older keys verify the tokens they signed until they are retired. Servers sharing the
+// directory agree on the keys after their next Load.
+type KeySet struct {
+	dir  string
+	opts KeySetOpts
+
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet loads the keys in dir, generating the first one when rotation is on.
+func NewKeySet(dir string, opts *KeySetOpts) (*KeySet, error) {
+	s := &KeySet{
+		dir: dir,
+		opts: KeySetOpts{
+			Algorithm: ALG_EDDSA,
+			Publish:   DEFAULT_KEY_PUBLISH,
+		},
+	}
+
+	if opts != nil {
+		if opts.Algorithm != "" {
+			s.opts.Algorithm = opts.Algorithm
+		}
+		if opts.Publish > 0 {
+			s.opts.Publish = opts.Publish
+		}
+		s.opts.Rotate = opts.Rotate
+		s.opts.Retain = opts.Retain
+	}
+
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Load reads the key directory again, rotating and retiring keys that are due.
+func (s *KeySet) Load() error {
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if s.opts.Rotate > 0 && (len(keys) == 0 || now.Sub(keys[0].Created) >= s.opts.Rotate) {
+		k, err := GenerateKey(s.dir, s.opts.Algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to rotate signing key: %w", err)
+		}
+		keys = append([]*Key{k}, keys...)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("%w in %s", ErrNoSigningKey, s.dir)
+	}
+
+	// keys are newest first, the first one that was published long enough signs. When none was, as
+	// with the first key of a new directory, the oldest signs.
+	signing := len(keys) - 1
+	for i, k := range keys {
+		if now.Sub(k.Created) >= s.opts.Publish {
+			signing = i
+			break
+		}
+	}
+
+	active := make(map[string]*Key, len(keys))
+	for i, k := range keys {
+		// a key is replaced once the next newer key has been published long enough
+		if i > signing && s.opts.Retain > 0 && now.Sub(keys[i-1].Created.Add(s.opts.Publish)) >= s.opts.Retain {
+			if s.opts.Rotate > 0 {
+				os.Remove(filepath.Join(s.dir, k.ID+KEY_FILE_EXT))
+			}
+			continue
+		}
+		active[k.ID] = k
+	}
+
+	s.mu.Lock()
+	s.signing = keys[signing]
+	s.keys = active
+	s.mu.Unlock()
+	return nil
+}
+
+// read loads every key file in the directory, newest first.
+func (s *KeySet) read() ([]*Key, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), KEY_FILE_EXT) {
+			continue
+		}
+
+		k, err := LoadKey(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	slices.SortFunc(keys, func(a, b *Key) int {
+		return b.Created.Compare(a.Created)
+	})
+	return keys, nil
+}
+
+// Signing returns the key new tokens are signed with.
+func (s *KeySet) Signing() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.signing
+}
+
+// Get returns the key with the given ID, nil if it is unknown or retired.
+func (s *KeySet) Get(id string) *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[id]
+}
+
+// JWKS lists the public keys tokens can be verified with, including ones that do not sign yet.
+func (s *KeySet) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, k := range s.keys {
+		jwks.Keys = append(jwks.Keys, k.JWK())
+	}
+
+	slices.SortFunc(jwks.Keys, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return jwks
+}
+
+// Watch loads the key directory every interval until ctx is cancelled. The interval must be shorter
+// than the publish time, or a server could get tokens signed with a key it has not loaded yet.
+func (s *KeySet) Watch(ctx context.Context, interval time.Duration, log *logger.Logger) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.Load(); err != nil {
+					log.Error(fmt.Sprintf("Failed to load signing keys: %v", err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,236 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// age makes a key file look like it was created d ago.
+func age(t *testing.T, dir string, k *Key, d time.Duration) {
+	t.Helper()
+
+	created := time.Now().Add(-d)
+	if err := os.Chtimes(filepath.Join(dir, k.ID+KEY_FILE_EXT), created, created); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySigning(t *testing.T) {
+	for _, alg := range []string{ALG_EDDSA, ALG_ES256} {
+		t.Run(alg, func(t *testing.T) {
+			dir := t.TempDir()
+			k, err := GenerateKey(dir, alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys, err := NewKeySet(dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if keys.Signing().ID != k.ID {
+				t.Fatalf("got signing key %s, want %s", keys.Signing().ID, k.ID)
+			}
+
+			b := &BstConfig{Keys: keys}
+			uid := uuid.New()
+			tokenStr, err := b.GenerateToken(uid, time.Now().Add(time.Minute), ACCESS_TOKEN)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := b.VerifyToken(tokenStr, ACCESS_TOKEN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != uid {
+				t.Fatalf("got user %s, want %s", got, uid)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != k.ID || jwks.Keys[0].Alg != alg {
+				t.Fatalf("got jwks %+v", jwks)
+			}
+
+			// another server loading the same file verifies the token
+			other, err := NewKeySet(dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := (&BstConfig{Keys: other}).VerifyToken(tokenStr, ACCESS_TOKEN); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestKeyRejectsForgedTokens(t *testing.T) {
+	dir := t.TempDir()
+	k, err := GenerateKey(dir, ALG_EDDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeySet(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BstConfig{Keys: keys}
+
+	claims := TokenClaims{UserID: uuid.New(), RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+
+	t.Run("public key as hmac secret", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = k.ID
+		forged, err := token.SignedString([]byte(k.Public().(ed25519.PublicKey)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.VerifyToken(forged, ACCESS_TOKEN); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Fatalf("got %v, want %v", err, jwt.ErrTokenSignatureInvalid)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other, err := GenerateKey(t.TempDir(), ALG_EDDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := jwt.NewWithClaims(other.Method, claims)
+		token.Header["kid"] = other.ID
+		forged, err := token.SignedString(other.private)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.VerifyToken(forged, ACCESS_TOKEN); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("got %v, want %v", err, ErrUnknownKey)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+		forged, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.VerifyToken(forged, ACCESS_TOKEN); err == nil {
+			t.Fatal("expected unsigned token to be rejected")
+		}
+	})
+}
+
+func TestKeySecretFallback(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateKey(dir, ALG_EDDSA); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeySet(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := &BstConfig{SecretKey: []byte("skjvkfbvdkfhvjfvkjf")}
+	tokenStr, err := legacy.GenerateToken(uuid.New(), time.Now().Add(time.Minute), ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrating := &BstConfig{SecretKey: legacy.SecretKey, Keys: keys, SecretKeyUntil: time.Now().Add(time.Hour)}
+	if _, err := migrating.VerifyToken(tokenStr, ACCESS_TOKEN); err != nil {
+		t.Fatalf("expected token signed with the secret to verify until the cutoff: %v", err)
+	}
+
+	rejected := map[string]*BstConfig{
+		"without cutoff":   {SecretKey: legacy.SecretKey, Keys: keys},
+		"after the cutoff": {SecretKey: legacy.SecretKey, Keys: keys, SecretKeyUntil: time.Now().Add(-time.Second)},
+		"without secret":   {Keys: keys},
+	}
+
+	for name, b := range rejected {
+		t.Run(name, func(t *testing.T) {
+			if _, err := b.VerifyToken(tokenStr, ACCESS_TOKEN); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+				t.Fatalf("got %v, want %v", err, jwt.ErrTokenSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	opts := &KeySetOpts{Rotate: 24 * time.Hour, Publish: time.Hour, Retain: 48 * time.Hour}
+
+	keys, err := NewKeySet(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := keys.Signing()
+	b := &BstConfig{Keys: keys}
+	oldToken, err := b.GenerateToken(uuid.New(), time.Now().Add(time.Minute), ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first key is due for rotation, the new key is published but does not sign yet
+	age(t, dir, first, 25*time.Hour)
+	if err := keys.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys.JWKS().Keys) != 2 {
+		t.Fatalf("expected the new key to be published, got %+v", keys.JWKS())
+	}
+	if keys.Signing().ID != first.ID {
+		t.Fatal("expected the old key to sign until the new key was published long enough")
+	}
+
+	var second *Key
+	for _, jwk := range keys.JWKS().Keys {
+		if jwk.Kid != first.ID {
+			second = keys.Get(jwk.Kid)
+		}
+	}
+
+	// once published long enough the new key signs, the old one still verifies
+	age(t, dir, second, 2*time.Hour)
+	if err := keys.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.Signing().ID != second.ID {
+		t.Fatal("expected the new key to sign")
+	}
+	if _, err := b.VerifyToken(oldToken, ACCESS_TOKEN); err != nil {
+		t.Fatalf("expected token of the old key to still verify: %v", err)
+	}
+
+	// the old key is retired once replaced for longer than the retain time
+	age(t, dir, second, 50*time.Hour)
+	age(t, dir, first, 75*time.Hour)
+	if err := keys.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.Get(first.ID) != nil {
+		t.Fatal("expected the old key to be retired")
+	}
+	if _, err := os.Stat(filepath.Join(dir, first.ID+KEY_FILE_EXT)); !os.IsNotExist(err) {
+		t.Fatalf("expected the file of the retired key to be deleted, got %v", err)
+	}
+	if _, err := b.VerifyToken(oldToken, ACCESS_TOKEN); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("got %v, want %v", err, ErrUnknownKey)
+	}
+}
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"time"
 )
@@ -16,8 +17,24 @@ const (
 	REFRESH_TOKEN
 	PASSWORD_RECOVERY_TOKEN
 	UPDATE_EMAIL_TOKEN
+	EMAIL_VERIFICATION_TOKEN
 )
 
+// DEFAULT_ISSUER is the issuer of tokens when BstConfig does not name one.
+const DEFAULT_ISSUER = "luxora"
+
+var ErrUnknownTokenType = errors.New("unknown token type")
+
+// audiences are what each type of token is for, so a token of one type is never accepted as
+// another.
+var audiences = map[uint8]string{
+	ACCESS_TOKEN:             "luxora:access",
+	REFRESH_TOKEN:            "luxora:refresh",
+	PASSWORD_RECOVERY_TOKEN:  "luxora:password-recovery",
+	UPDATE_EMAIL_TOKEN:       "luxora:update-email",
+	EMAIL_VERIFICATION_TOKEN: "luxora:email-verification",
+}
+
 type VerificationToken struct {
 	Exp       time.Time `json:"exp"`
 	UserID    uuid.UUID `json:"uid"`
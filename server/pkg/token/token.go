@@ -10,47 +10,74 @@ import (
 
 type BstConfig struct {
 	SecretKey []byte // Secret used for signing JWTs
+	// Keys sign tokens in place of SecretKey when set. Tokens signed with SecretKey then only verify
+	// until SecretKeyUntil, so tokens issued before switching to keys keep working while they are
+	// migrated, but the shared secret can not mint tokens forever.
+	Keys           *KeySet
+	SecretKeyUntil time.Time
+	// Issuer names the environment tokens are issued in, tokens from another issuer are rejected
+	// even when it shares the key. DEFAULT_ISSUER when empty.
+	Issuer string
+	// Leeway is how far the clocks of servers may drift apart when checking exp, nbf and iat
+	Leeway time.Duration
 }
 
 type TokenClaims struct {
 	UserID    uuid.UUID `json:"user_id"`
 	TokenType uint8     `json:"token_type"`
 	Payload   string    `json:"payload,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a standard JWT
-func (b *BstConfig) GenerateToken(userID uuid.UUID, exp time.Time, tokenType uint8) (string, error) {
-	claims := TokenClaims{
-		UserID:    userID,
-		TokenType: tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(exp),
-		},
+func (b *BstConfig) issuer() string {
+	if b.Issuer == "" {
+		return DEFAULT_ISSUER
 	}
+	return b.Issuer
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(b.SecretKey)
+// GenerateToken generates a standard JWT. Every token gets a random ID, so two tokens issued for
+// the same user in the same second still differ.
+func (b *BstConfig) GenerateToken(userID uuid.UUID, exp time.Time, tokenType uint8) (string, error) {
+	return b.GenerateTokenWithPayload(userID, exp, tokenType, "")
 }
 
 // GenerateTokenWithPayload generates a JWT with additional payload
 func (b *BstConfig) GenerateTokenWithPayload(userID uuid.UUID, exp time.Time, tokenType uint8, payload string) (string, error) {
+	return b.GenerateTokenWithRoles(userID, exp, tokenType, payload, nil)
+}
+
+// GenerateTokenWithRoles generates a JWT with additional payload that grants roles to its bearer.
+func (b *BstConfig) GenerateTokenWithRoles(userID uuid.UUID, exp time.Time, tokenType uint8, payload string, roles []string) (string, error) {
+	audience, ok := audiences[tokenType]
+	if !ok {
+		return "", ErrUnknownTokenType
+	}
+
+	now := time.Now()
 	claims := TokenClaims{
 		UserID:    userID,
 		TokenType: tokenType,
 		Payload:   payload,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    b.issuer(),
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(b.SecretKey)
+	return b.sign(claims)
 }
 
 // VerifyToken verifies the token and returns the userID
 func (b *BstConfig) VerifyToken(tokenStr string, tokenType uint8) (uuid.UUID, error) {
-	claims, err := b.parseToken(tokenStr)
+	claims, err := b.parseToken(tokenStr, tokenType)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -64,7 +91,7 @@ func (b *BstConfig) VerifyToken(tokenStr string, tokenType uint8) (uuid.UUID, er
 
 // VerifyTokenAndGetFields verifies the token and returns the full claims
 func (b *BstConfig) VerifyTokenAndGetFields(tokenStr string, tokenType uint8) (*TokenClaims, error) {
-	claims, err := b.parseToken(tokenStr)
+	claims, err := b.parseToken(tokenStr, tokenType)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +105,7 @@ func (b *BstConfig) VerifyTokenAndGetFields(tokenStr string, tokenType uint8) (*
 
 // VerifyPayloadToken verifies a token and extracts payload
 func (b *BstConfig) VerifyPayloadToken(tokenStr string, tokenType uint8) (uuid.UUID, string, error) {
-	claims, err := b.parseToken(tokenStr)
+	claims, err := b.parseToken(tokenStr, tokenType)
 	if err != nil {
 		return uuid.Nil, "", err
 	}
@@ -90,11 +117,83 @@ func (b *BstConfig) VerifyPayloadToken(tokenStr string, tokenType uint8) (uuid.U
 	return claims.UserID, claims.Payload, nil
 }
 
-// parseToken parses and validates a JWT
-func (b *BstConfig) parseToken(tokenStr string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+// sign signs claims with the current signing key, naming it in the kid header.
+func (b *BstConfig) sign(claims TokenClaims) (string, error) {
+	if b.Keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(b.SecretKey)
+	}
+
+	key := b.Keys.Signing()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// verificationKey finds the key a token was signed with. A token must use the method of its key,
+// so a public key can never be used as an HMAC secret.
+func (b *BstConfig) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if !b.acceptsSecret() || token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrUnexpectedMethod
+		}
 		return b.SecretKey, nil
-	})
+	}
+
+	if b.Keys == nil {
+		return nil, ErrUnknownKey
+	}
+
+	key := b.Keys.Get(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectedMethod
+	}
+
+	return key.Public(), nil
+}
+
+// acceptsSecret reports whether tokens signed with the secret verify, always without keys and until
+// SecretKeyUntil with them.
+func (b *BstConfig) acceptsSecret() bool {
+	if len(b.SecretKey) == 0 {
+		return false
+	}
+	return b.Keys == nil || time.Now().Before(b.SecretKeyUntil)
+}
+
+// methods are the signing methods tokens may use, HS256 only while the secret is accepted.
+func (b *BstConfig) methods() []string {
+	var methods []string
+	if b.Keys != nil {
+		methods = append(methods, ALG_EDDSA, ALG_ES256)
+	}
+	if b.acceptsSecret() {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// parseToken parses and validates a JWT of the given type, including its issuer, audience and
+// times.
+func (b *BstConfig) parseToken(tokenStr string, tokenType uint8) (*TokenClaims, error) {
+	audience, ok := audiences[tokenType]
+	if !ok {
+		return nil, ErrUnknownTokenType
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, b.verificationKey,
+		jwt.WithValidMethods(b.methods()),
+		jwt.WithIssuer(b.issuer()),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(b.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -105,5 +204,9 @@ func (b *BstConfig) parseToken(tokenStr string) (*TokenClaims, error) {
 		return nil, errors.New("invalid token claims")
 	}
 
+	if claims.Subject != claims.UserID.String() {
+		return nil, errors.New("invalid token subject")
+	}
+
 	return claims, nil
 }
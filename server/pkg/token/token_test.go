@@ -0,0 +1,112 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestTokenClaims(t *testing.T) {
+	b := &BstConfig{SecretKey: []byte("skjvkfbvdkfhvjfvkjf"), Issuer: "luxora-prod", Leeway: 30 * time.Second}
+	uid := uuid.New()
+
+	tokenStr, err := b.GenerateTokenWithPayload(uid, time.Now().Add(time.Minute), ACCESS_TOKEN, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := b.VerifyTokenAndGetFields(tokenStr, ACCESS_TOKEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Issuer != "luxora-prod" || claims.Subject != uid.String() || claims.IssuedAt == nil || claims.NotBefore == nil {
+		t.Fatalf("got claims %+v", claims.RegisteredClaims)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != audiences[ACCESS_TOKEN] {
+		t.Fatalf("got audience %v", claims.Audience)
+	}
+
+	t.Run("other environment", func(t *testing.T) {
+		dev := &BstConfig{SecretKey: b.SecretKey, Issuer: "luxora-dev"}
+		if _, err := dev.VerifyToken(tokenStr, ACCESS_TOKEN); !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+			t.Fatalf("got %v, want %v", err, jwt.ErrTokenInvalidIssuer)
+		}
+	})
+
+	t.Run("other token type", func(t *testing.T) {
+		if _, err := b.VerifyToken(tokenStr, REFRESH_TOKEN); !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+			t.Fatalf("got %v, want %v", err, jwt.ErrTokenInvalidAudience)
+		}
+	})
+
+	valid := func() TokenClaims {
+		now := time.Now()
+		return TokenClaims{
+			UserID:    uid,
+			TokenType: ACCESS_TOKEN,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    b.Issuer,
+				Subject:   uid.String(),
+				Audience:  jwt.ClaimStrings{audiences[ACCESS_TOKEN]},
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *TokenClaims)
+		want   error
+	}{
+		{"valid", func(c *TokenClaims) {}, nil},
+		{"clock skew within leeway", func(c *TokenClaims) {
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(20 * time.Second))
+			c.NotBefore = c.IssuedAt
+		}, nil},
+		{"not valid yet", func(c *TokenClaims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }, jwt.ErrTokenNotValidYet},
+		{"issued in the future", func(c *TokenClaims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Minute)) }, jwt.ErrTokenUsedBeforeIssued},
+		{"expired beyond leeway", func(c *TokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }, jwt.ErrTokenExpired},
+		{"no expiry", func(c *TokenClaims) { c.ExpiresAt = nil }, jwt.ErrTokenRequiredClaimMissing},
+		{"no audience", func(c *TokenClaims) { c.Audience = nil }, jwt.ErrTokenRequiredClaimMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(&c)
+
+			tokenStr, err := b.sign(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = b.VerifyToken(tokenStr, ACCESS_TOKEN)
+			if tt.want == nil && err != nil {
+				t.Fatalf("expected token to verify: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("subject of another user", func(t *testing.T) {
+		c := valid()
+		c.Subject = uuid.NewString()
+
+		tokenStr, err := b.sign(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := b.VerifyToken(tokenStr, ACCESS_TOKEN); err == nil {
+			t.Fatal("expected token whose subject is not its user to be rejected")
+		}
+	})
+}
@@ -0,0 +1,335 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+)
+
+// adminError writes the status of an error returned by an admin action.
+func adminError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, coreAuth.ErrForbidden):
+		errs.ErrorWithJson(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, coreAuth.ErrInvalidRole):
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrUserNotFound), errors.Is(err, database.ErrListingNotFound):
+		errs.ErrorWithJson(w, http.StatusNotFound, err.Error())
+	default:
+		errs.ErrorWithJson(w, http.StatusInternalServerError, msg)
+	}
+}
+
+// @Summary		Get platform statistics
+// @Description	Returns counts of users, sessions, listings, bids and pending verifications. Only available to admins.
+// @Tags			admin
+// @Accept			*/*
+// @Produce		json
+// @Param			Authorization	header		string					true	"Access token"
+// @Success		200				{object}	models.PlatformStats	"Platform statistics"
+// @Failure		401				{object}	errs.ErrorResponse		"Unauthorized"
+// @Failure		403				{object}	errs.ErrorResponse		"User is not an admin"
+// @Failure		500				{object}	errs.ErrorResponse		"Internal server error"
+// @Router			/admin/stats [GET]
+func (t *TransportConfig) GetPlatformStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := t.CoreStore.GetPlatformStats(r.Context())
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get platform stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode platform stats: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Get any listing
+// @Description	Returns a listing of any user, drafts included. Only available to moderators and admins.
+// @Tags			admin
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{object}	models.ProductInfo	"The listing"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid product ID"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not a moderator"
+// @Failure		404				{object}	errs.ErrorResponse	"Listing not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/listings/{id} [GET]
+func (t *TransportConfig) GetAnyListing(w http.ResponseWriter, r *http.Request) {
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	product, err := t.CoreStore.GetAnyListing(r.Context(), pid)
+	if err != nil {
+		adminError(w, err, "failed to get listing")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(product); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode listing: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Remove any listing
+// @Description	Deletes a listing of any user. Only available to moderators and admins.
+// @Tags			admin
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path	string	true	"Product ID"
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"Listing removed"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid product ID"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not a moderator"
+// @Failure		404				{object}	errs.ErrorResponse	"Listing not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/listings/{id} [DELETE]
+func (t *TransportConfig) RemoveListing(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	if err := t.CoreStore.RemoveListing(r.Context(), uid, pid); err != nil {
+		adminError(w, err, "failed to remove listing")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Suspend a user
+// @Description	Suspends a user, ending every session at once. Suspended users can not log in. Only moderators and admins can suspend users, and only admins can suspend moderators and admins.
+// @Tags			admin
+// @Param			id				path	string	true	"User ID"
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"User suspended"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID"
+// @Failure		403				{object}	errs.ErrorResponse	"Not allowed to suspend this user"
+// @Failure		404				{object}	errs.ErrorResponse	"User not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/users/{id}/suspension [POST]
+func (t *TransportConfig) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	target, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := t.CoreAuth.SuspendUser(r.Context(), uid, target); err != nil {
+		adminError(w, err, "failed to suspend user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Lift a suspension
+// @Description	Lets a suspended user log in again. Only available to moderators and admins.
+// @Tags			admin
+// @Param			id				path	string	true	"User ID"
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"Suspension lifted"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID"
+// @Failure		403				{object}	errs.ErrorResponse	"Not allowed to lift this suspension"
+// @Failure		404				{object}	errs.ErrorResponse	"User not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/users/{id}/suspension [DELETE]
+func (t *TransportConfig) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	target, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := t.CoreAuth.UnsuspendUser(r.Context(), uid, target); err != nil {
+		adminError(w, err, "failed to lift suspension")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Get the roles of a user
+// @Description	Lists the roles of a user, every user has the user role. Only available to admins.
+// @Tags			admin
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string				true	"User ID"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{array}		string				"Roles of the user"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not an admin"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/users/{id}/roles [GET]
+func (t *TransportConfig) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	target, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	roles, err := t.CoreAuth.GetRoles(r.Context(), target)
+	if err != nil {
+		adminError(w, err, "failed to get roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode roles: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Grant a role
+// @Description	Grants a user the verifier, moderator or admin role, recorded in the role audit log. The access tokens of the user are revoked, the next refresh carries the new role. Only available to admins.
+// @Tags			admin
+// @Param			id				path	string	true	"User ID"
+// @Param			role			path	string	true	"Role"	Enums(verifier, moderator, admin)
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"Role granted"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID or role"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not an admin"
+// @Failure		404				{object}	errs.ErrorResponse	"User not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/users/{id}/roles/{role} [PUT]
+func (t *TransportConfig) GrantRole(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	target, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := t.CoreAuth.GrantRole(r.Context(), uid, target, r.PathValue("role")); err != nil {
+		adminError(w, err, "failed to grant role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Revoke a role
+// @Description	Takes a role from a user, recorded in the role audit log. The access tokens of the user are revoked at once. Admins can not revoke their own admin role. Only available to admins.
+// @Tags			admin
+// @Param			id				path	string	true	"User ID"
+// @Param			role			path	string	true	"Role"	Enums(verifier, moderator, admin)
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"Role revoked"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID or role"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not an admin, or revoking their own admin role"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/users/{id}/roles/{role} [DELETE]
+func (t *TransportConfig) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	target, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := t.CoreAuth.RevokeRole(r.Context(), uid, target, r.PathValue("role")); err != nil {
+		adminError(w, err, "failed to revoke role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Get the role audit log
+// @Description	Returns who granted and revoked which roles, newest first. Only available to admins.
+// @Tags			admin
+// @Accept			*/*
+// @Produce		json
+// @Param			user			query		string				false	"Only changes of this user ID"
+// @Param			limit			query		int					false	"Number of entries per page (default 50)"
+// @Param			page			query		int					false	"Page number (default 1)"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{array}		models.RoleChange	"Role changes"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid user ID"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not an admin"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/admin/roles/audit [GET]
+func (t *TransportConfig) GetRoleChanges(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	page := 1
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+
+	var target uuid.UUID
+	if userStr := r.URL.Query().Get("user"); userStr != "" {
+		var err error
+		target, err = uuid.Parse(userStr)
+		if err != nil {
+			errs.ErrorWithJson(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+	}
+
+	changes, err := t.CoreAuth.GetRoleChanges(r.Context(), target, limit, page)
+	if err != nil {
+		adminError(w, err, "failed to get role changes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode role changes: "+err.Error())
+		return
+	}
+}
@@ -2,7 +2,10 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database"
 	errs "github.com/gopher93185789/luxora/server/pkg/error"
 	"github.com/gopher93185789/luxora/server/pkg/middleware"
 
@@ -37,19 +40,34 @@ func setCookies(w http.ResponseWriter, refreshToken string) {
 }
 
 // @Summary		Github Oauth exchange
-// @Description	Send a request to this endpoint to exchange the Github code you got from Github for an access token.
+// @Description	Send a request to this endpoint to exchange the Github code you got from Github for an access token. The request must carry the cookie set by /auth/github or /auth/link/github, and the state Github returned. A login started by /auth/link/github links the Github account to the user who started it.
 // @Tags			auth
 // @Accept			*/*
 // @Produce		json
 // @Success		200	{object}	AccessTokenResponse	"Access token response"
 // @Failure		401	{object}	errs.ErrorResponse	"Unauthorized error"
+// @Failure		403	{object}	errs.ErrorResponse	"Account is suspended"
+// @Failure		409	{object}	errs.ErrorResponse	"Github account is linked to another user"
 // @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
 // @Router			/auth/github/exchange [get]
 // @Param			code	query	string	true	"code"	Format(code)
 // @Param			state	query	string	true	"state"	Format(state)
 func (t *TransportConfig) GithubExchange(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	at, rt, err := t.CoreAuth.HandleGithubOauth(r.Context(), r.URL.Query().Get("code"))
+	verifier, link, ok := t.oauthVerifier(w, r, coreAuth.PROVIDER_GITHUB)
+	if !ok {
+		return
+	}
+
+	at, rt, err := t.CoreAuth.HandleGithubOauth(r.Context(), r.URL.Query().Get("code"), verifier, link, clientFromRequest(r))
+	if errors.Is(err, database.ErrIdentityLinked) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, coreAuth.ErrUserSuspended) {
+		errs.ErrorWithJson(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
 		return
@@ -70,19 +88,34 @@ func (t *TransportConfig) GithubExchange(w http.ResponseWriter, r *http.Request)
 }
 
 // @Summary		Google Oauth exchange
-// @Description	Send a request to this endpoint to exchange the Google code you got from Google for an access token.
+// @Description	Send a request to this endpoint to exchange the Google code you got from Google for an access token. The request must carry the cookie set by /auth/google or /auth/link/google, and the state Google returned. A login started by /auth/link/google links the Google account to the user who started it.
 // @Tags			auth
 // @Accept			*/*
 // @Produce		json
 // @Success		200	{object}	AccessTokenResponse	"Access token response"
 // @Failure		401	{object}	errs.ErrorResponse	"Unauthorized error"
+// @Failure		403	{object}	errs.ErrorResponse	"Account is suspended"
+// @Failure		409	{object}	errs.ErrorResponse	"Google account is linked to another user"
 // @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
 // @Router			/auth/google/exchange [get]
 // @Param			code	query	string	true	"code"	Format(code)
 // @Param			state	query	string	true	"state"	Format(state)
 func (t *TransportConfig) GoogleExchange(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	at, rt, err := t.CoreAuth.HandleGoogleOauth(r.Context(), r.URL.Query().Get("code"))
+	verifier, link, ok := t.oauthVerifier(w, r, coreAuth.PROVIDER_GOOGLE)
+	if !ok {
+		return
+	}
+
+	at, rt, err := t.CoreAuth.HandleGoogleOauth(r.Context(), r.URL.Query().Get("code"), verifier, link, clientFromRequest(r))
+	if errors.Is(err, database.ErrIdentityLinked) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, coreAuth.ErrUserSuspended) {
+		errs.ErrorWithJson(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
 		return
@@ -103,13 +136,14 @@ func (t *TransportConfig) GoogleExchange(w http.ResponseWriter, r *http.Request)
 }
 
 // @Summary		Refresh Token
-// @Description	Refresh the access token using the refresh token stored in the cookie.
+// @Description	Refresh the access token using the refresh token stored in the cookie. The refresh token is replaced, the old one stops working. Presenting a replaced refresh token again revokes its session, and the user has to log in again.
 // @Tags			auth
 // @Accept			*/*
 // @Produce		json
 // @Success		200	{object}	AccessTokenResponse	"Access token response"
 // @Failure		400	{object}	errs.ErrorResponse	"Missing cookie error"
-// @Failure		401	{object}	errs.ErrorResponse	"Unauthorized error"
+// @Failure		401	{object}	errs.ErrorResponse	"Invalid, revoked or reused refresh token"
+// @Failure		403	{object}	errs.ErrorResponse	"Account is suspended"
 // @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
 // @Router			/auth/refresh [post]
 func (t *TransportConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -121,7 +155,17 @@ func (t *TransportConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	at, rt, err := t.CoreAuth.RefreshToken(r.Context(), cookie.Value)
+	at, rt, err := t.CoreAuth.RefreshToken(r.Context(), cookie.Value, clientFromRequest(r))
+	if errors.Is(err, database.ErrTokenReused) || errors.Is(err, database.ErrSessionNotFound) {
+		clearCookies(w)
+		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if errors.Is(err, coreAuth.ErrUserSuspended) {
+		clearCookies(w)
+		errs.ErrorWithJson(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
 		return
@@ -167,7 +211,7 @@ func (t *TransportConfig) GetUserInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary      Logout user
-// @Description  Logs out the authenticated user and invalidates their tokens
+// @Description  Logs out the session of the access token, other devices stay logged in. Access tokens of the session stop working at once.
 // @Tags         auth
 // @Accept       */*
 // @Produce      json
@@ -183,7 +227,7 @@ func (t *TransportConfig) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = t.CoreAuth.Logout(r.Context(), uid)
+	err = t.CoreAuth.Logout(r.Context(), uid, middleware.GetSessionFromRequest(r), middleware.GetTokenIDFromRequest(r))
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to log user out")
 		return
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+)
+
+// @Summary		Get cache statistics
+// @Description	Returns the hit, miss, eviction and invalidation counters of the listing caches.
+// @Tags			metrics
+// @Accept			*/*
+// @Produce		json
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200	{object}	cache.CacheStats	"Counters of the product and listing caches"
+// @Failure		401	{object}	errs.ErrorResponse	"Unauthorized"
+// @Failure		403	{object}	errs.ErrorResponse	"User is not an admin"
+// @Failure		404	{object}	errs.ErrorResponse	"Caching is disabled"
+// @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/metrics/cache [GET]
+func (t *TransportConfig) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	if t.Cache == nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "caching is disabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(t.Cache.Stats()); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode cache stats: "+err.Error())
+		return
+	}
+}
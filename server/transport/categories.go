@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+)
+
+// @Summary		Get category tree
+// @Description	Returns the category tree with the attributes each category defines. Listing counts include the listings of all child categories.
+// @Tags			categories
+// @Accept			*/*
+// @Produce		json
+// @Success		200	{array}		models.Category		"Root categories with their children"
+// @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/categories [GET]
+func (t *TransportConfig) GetCategories(w http.ResponseWriter, r *http.Request) {
+	tree, err := t.CoreStore.GetCategoryTree(r.Context())
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get categories: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tree); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode categories: "+err.Error())
+		return
+	}
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Listings are served per user, as drafts are only visible to their owner, so shared caches must
+// not store them. Single listings can be reused for a short while, pages of listings change as
+// soon as anything is listed and are revalidated every time.
+const (
+	CACHE_CONTROL_LISTING  = "private, max-age=30, must-revalidate"
+	CACHE_CONTROL_LISTINGS = "private, no-cache"
+)
+
+// notModified sets the validators of a response and reports whether the client already has this
+// version, in which case it has been answered with 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag, cacheControl string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Add("Vary", "Authorization")
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares an If-None-Match header against an ETag. The comparison is weak, as
+// If-None-Match requires, which also matches the weak ETags of compressed responses.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
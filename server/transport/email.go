@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// decodeCredentials decodes the small json bodies of the auth endpoints.
+func decodeCredentials(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCredentialsBytes)
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
+		return false
+	}
+
+	return true
+}
+
+// @Summary		Send an email verification link
+// @Description	Emails a single-use link to verify the email address of the logged in user. The link expires in 24 hours and sending a new one invalidates the previous.
+// @Tags			auth
+// @Produce		json
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		202				"Verification email sent"
+// @Failure		400				{object}	errs.ErrorResponse	"Account has no email address"
+// @Failure		409				{object}	errs.ErrorResponse	"Email is already verified"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/email/verification [post]
+func (t *TransportConfig) SendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	err = t.CoreAuth.SendEmailVerification(r.Context(), uid)
+	if errors.Is(err, coreAuth.ErrInvalidEmail) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, coreAuth.ErrEmailAlreadyVerified) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary		Verify an email address
+// @Description	Marks an email address as verified with the token from a verification link. Each token works once.
+// @Tags			auth
+// @Accept			json
+// @Param			token	body	models.EmailToken	true	"Token from the verification link"
+// @Success		204		"Email verified"
+// @Failure		400		{object}	errs.ErrorResponse	"Invalid, expired or used token"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/email/verify [post]
+func (t *TransportConfig) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body models.EmailToken
+	if !decodeCredentials(w, r, &body) {
+		return
+	}
+
+	err := t.CoreAuth.VerifyEmail(r.Context(), body.Token)
+	if errors.Is(err, database.ErrTokenInvalid) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to verify email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Request a password reset
+// @Description	Emails a single-use password reset link if the address belongs to an account with a password. The response is the same whether or not it does.
+// @Tags			auth
+// @Accept			json
+// @Param			email	body	models.EmailAddress	true	"Email address of the account"
+// @Success		202		"Reset email sent if the account exists"
+// @Failure		400		{object}	errs.ErrorResponse	"Invalid email address"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Router			/auth/password/forgot [post]
+func (t *TransportConfig) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body models.EmailAddress
+	if !decodeCredentials(w, r, &body) {
+		return
+	}
+
+	if err := t.CoreAuth.RequestPasswordReset(r.Context(), body.Email); err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary		Reset a password
+// @Description	Sets a new password with the token from a password reset link. Each token works once, and all sessions of the account are logged out.
+// @Tags			auth
+// @Accept			json
+// @Param			reset	body	models.PasswordReset	true	"Token from the reset link and the new password"
+// @Success		204		"Password reset"
+// @Failure		400		{object}	errs.ErrorResponse	"Invalid, expired or used token, or a password that does not meet the policy"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/password/reset [post]
+func (t *TransportConfig) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body models.PasswordReset
+	if !decodeCredentials(w, r, &body) {
+		return
+	}
+
+	err := t.CoreAuth.ResetPassword(r.Context(), body.Token, body.Password)
+	if errors.Is(err, database.ErrTokenInvalid) || errors.Is(err, coreAuth.ErrInvalidPassword) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Request an email change
+// @Description	Emails a single-use confirmation link to the new address, the email of the account only changes once it is opened. The current address is notified.
+// @Tags			auth
+// @Accept			json
+// @Param			Authorization	header	string				true	"Access token"
+// @Param			email			body	models.EmailAddress	true	"New email address"
+// @Success		202				"Confirmation email sent"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid email address"
+// @Failure		422				{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/email/change [post]
+func (t *TransportConfig) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	var body models.EmailAddress
+	if !decodeCredentials(w, r, &body) {
+		return
+	}
+
+	err = t.CoreAuth.RequestEmailChange(r.Context(), uid, body.Email)
+	if errors.Is(err, coreAuth.ErrInvalidEmail) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to send confirmation email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary		Confirm an email change
+// @Description	Changes the email of an account to the address the confirmation link was sent to. Each token works once.
+// @Tags			auth
+// @Accept			json
+// @Param			token	body	models.EmailToken	true	"Token from the confirmation link"
+// @Success		204		"Email changed"
+// @Failure		400		{object}	errs.ErrorResponse	"Invalid, expired or used token"
+// @Failure		409		{object}	errs.ErrorResponse	"Email is used by another account"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/email/change/confirm [post]
+func (t *TransportConfig) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var body models.EmailToken
+	if !decodeCredentials(w, r, &body) {
+		return
+	}
+
+	err := t.CoreAuth.ChangeEmail(r.Context(), body.Token)
+	if errors.Is(err, database.ErrTokenInvalid) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrUserExists) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to change email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,349 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/pkg/blob"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/imaging"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxImageUploadBytes = 50 << 20
+
+// @Summary		Upload listing images
+// @Description	Appends images to one of the authenticated user's listings. Send either a multipart/form-data body where every file part is an image, or a single image as the raw request body.
+// @Description	Images must be JPEG, PNG, WebP or GIF, at most 10 MiB and 8000x8000 pixels. They are re-encoded without metadata and get thumb and medium renditions.
+// @Tags			listings
+// @Accept			multipart/form-data
+// @Accept			image/jpeg
+// @Accept			image/png
+// @Accept			image/webp
+// @Accept			image/gif
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{array}		models.ProductImage	"The uploaded images"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid product ID or image, or the listing already has the maximum of 10 images"
+// @Failure		413				{object}	errs.ErrorResponse	"Request body too large"
+// @Router			/listings/{id}/images [POST]
+func (t *TransportConfig) UploadListingImages(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadBytes)
+	images := []models.ProductImage{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			errs.ErrorWithJson(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+			return
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+
+			if part.FileName() == "" {
+				part.Close()
+				continue
+			}
+
+			image, err := t.CoreStore.UploadListingImage(r.Context(), uid, pid, part)
+			part.Close()
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			images = append(images, image)
+		}
+	} else {
+		image, err := t.CoreStore.UploadListingImage(r.Context(), uid, pid, r.Body)
+		if err != nil {
+			uploadError(w, err)
+			return
+		}
+		images = append(images, image)
+	}
+
+	if len(images) == 0 {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "no images found in request body")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(images); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode images: "+err.Error())
+		return
+	}
+}
+
+// singleImage returns the first file part of a multipart/form-data body, or the body itself.
+func singleImage(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("no image found in request body")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// @Summary		Replace a listing image
+// @Description	Replaces an image of one of the authenticated user's listings, keeping its position. The new image gets a new ID and URLs, the old ones stop working.
+// @Description	Send either a multipart/form-data body with the image as its first file part, or the image as the raw request body.
+// @Tags			listings
+// @Accept			multipart/form-data
+// @Accept			image/jpeg
+// @Accept			image/png
+// @Accept			image/webp
+// @Accept			image/gif
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			image_id		path		string				true	"ID of the image to replace"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{object}	models.ProductImage	"The new image"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid ID, image or image not on the listing"
+// @Failure		413				{object}	errs.ErrorResponse	"Request body too large"
+// @Router			/listings/{id}/images/{image_id} [PUT]
+func (t *TransportConfig) ReplaceListingImage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	imageID, err := uuid.Parse(r.PathValue("image_id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid image id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadBytes)
+	body, err := singleImage(r)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+
+	image, err := t.CoreStore.ReplaceListingImage(r.Context(), uid, pid, imageID, body)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(image); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode image: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Delete a listing image
+// @Description	Removes an image from one of the authenticated user's listings. The images after it move up one position.
+// @Tags			listings
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			image_id		path		string				true	"ID of the image to delete"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{string}	string				"Image deleted"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid ID or image not on the listing"
+// @Router			/listings/{id}/images/{image_id} [DELETE]
+func (t *TransportConfig) DeleteListingImage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	imageID, err := uuid.Parse(r.PathValue("image_id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid image id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	if err := t.CoreStore.DeleteListingImage(r.Context(), uid, pid, imageID); err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to delete image: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Reorder listing images
+// @Description	Sets the order of the images of one of the authenticated user's listings. image_ids has to list every image of the listing exactly once, the first one becomes the cover image.
+// @Tags			listings
+// @Accept			json
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			order			body		models.ImageOrder	true	"Image IDs in their new order"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{string}	string				"Images reordered"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid ID or image_ids does not match the listing's images"
+// @Failure		422				{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Router			/listings/{id}/images/order [PUT]
+func (t *TransportConfig) ReorderListingImages(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var order models.ImageOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	if err := t.CoreStore.ReorderListingImages(r.Context(), uid, pid, order.ImageIDs); err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to reorder images: "+err.Error())
+		return
+	}
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	errs.ErrorWithJson(w, http.StatusBadRequest, "failed to upload image: "+err.Error())
+}
+
+// @Summary		Get an image
+// @Description	Serves the bytes of a listing image. Images never change once uploaded, so responses can be cached indefinitely and revalidated with the ETag.
+// @Tags			images
+// @Accept			*/*
+// @Produce		image/jpeg
+// @Produce		image/png
+// @Produce		image/webp
+// @Produce		image/gif
+// @Param			id		path		string				true	"Image ID"
+// @Param			size	query		string				false	"Rendition to serve: thumb (320px), medium (1280px) or full (default)"
+// @Success		200		{file}		binary				"The image"
+// @Success		304		{string}	string				"Not modified"
+// @Success		307		{string}	string				"Redirect to the image in the blob store"
+// @Failure		400		{object}	errs.ErrorResponse	"Bad request - invalid image ID or size"
+// @Failure		404		{object}	errs.ErrorResponse	"Image not found"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/images/{id} [GET]
+func (t *TransportConfig) GetImage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid image id")
+		return
+	}
+
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = imaging.SIZE_FULL
+	}
+
+	if !imaging.IsSize(size) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid image size, must be 'thumb', 'medium' or 'full'")
+		return
+	}
+
+	image, err := t.CoreStore.GetImage(r.Context(), id, size)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, blob.ErrNotFound):
+		errs.ErrorWithJson(w, http.StatusNotFound, "image not found")
+		return
+	case err != nil:
+		t.Logger.Error(fmt.Sprintf("Failed to serve image %s: %v", id, err))
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get image")
+		return
+	}
+
+	// the presigned URL expires, so only the redirect itself may be cached and only briefly
+	if image.BlobURL != "" {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		http.Redirect(w, r, image.BlobURL, http.StatusTemporaryRedirect)
+		return
+	}
+
+	etag := image.Checksum
+	if size != imaging.SIZE_FULL {
+		etag += "-" + size
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent answers If-None-Match and range requests for us
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image.Data))
+}
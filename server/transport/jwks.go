@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+)
+
+// @Summary		Get signing keys
+// @Description	Returns the public keys tokens are signed with as a JSON Web Key Set. A token names its key in the kid header. New keys are listed a while before they sign, so the set can be cached for a few minutes.
+// @Tags			auth
+// @Accept			*/*
+// @Produce		json
+// @Success		200	{object}	token.JWKS			"Public signing keys"
+// @Failure		404	{object}	errs.ErrorResponse	"Tokens are signed with a shared secret"
+// @Failure		500	{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/.well-known/jwks.json [GET]
+func (t *TransportConfig) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := t.CoreAuth.TokenConfig.Keys
+	if keys == nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "tokens are signed with a shared secret")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode signing keys: "+err.Error())
+		return
+	}
+}
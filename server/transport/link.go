@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+)
+
+// @Summary		Start linking a provider account
+// @Description	Starts a login with Github or Google that links the provider account to the logged in user. Send the user to the returned url, the provider redirects back to the usual exchange, which links the account and logs the user in. Sets the same short-lived cookie as /auth/{provider}.
+// @Tags			auth
+// @Produce		json
+// @Param			Authorization	header		string	true	"Access token"
+// @Param			provider		path		string	true	"github or google"
+// @Success		200				{object}	LinkResponse		"Provider login url"
+// @Failure		404				{object}	errs.ErrorResponse	"Unknown provider"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/link/{provider} [post]
+func (t *TransportConfig) LinkProvider(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	a, cookie, err := t.CoreAuth.StartOauthLink(r.PathValue("provider"), uid)
+	if errors.Is(err, coreAuth.ErrUnknownProvider) {
+		errs.ErrorWithJson(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to start link: "+err.Error())
+		return
+	}
+
+	setOauthStateCookie(w, cookie)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(LinkResponse{URL: a}); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode link url")
+		return
+	}
+}
+
+// @Summary		Unlink a provider account
+// @Description	Removes the Github or Google account of the logged in user. The last way a user can log in can not be removed, an account without a password keeps at least one provider.
+// @Tags			auth
+// @Param			Authorization	header	string	true	"Access token"
+// @Param			provider		path	string	true	"github or google"
+// @Success		204				"Account unlinked"
+// @Failure		404				{object}	errs.ErrorResponse	"Unknown provider or no linked account"
+// @Failure		409				{object}	errs.ErrorResponse	"Last login method"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/link/{provider} [delete]
+func (t *TransportConfig) UnlinkProvider(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	err = t.CoreAuth.UnlinkProvider(r.Context(), uid, r.PathValue("provider"))
+	if errors.Is(err, coreAuth.ErrUnknownProvider) || errors.Is(err, database.ErrIdentityNotFound) {
+		errs.ErrorWithJson(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrLastLoginMethod) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to unlink account")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
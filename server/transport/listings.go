@@ -1,15 +1,16 @@
 package transport
 
 import (
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/core/store"
 	errs "github.com/gopher93185789/luxora/server/pkg/error"
 	"github.com/gopher93185789/luxora/server/pkg/middleware"
 	"github.com/gopher93185789/luxora/server/pkg/models"
@@ -44,6 +45,7 @@ func (t *TransportConfig) CreateNewListing(w http.ResponseWriter, r *http.Reques
 
 	var product = ProductPool.Get().(*models.Product)
 	defer ProductPool.Put(product)
+	*product = models.Product{}
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
 		return
@@ -104,6 +106,116 @@ func (t *TransportConfig) DeleteListing(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// @Summary		Publish a draft listing
+// @Description	Publishes one of the authenticated user's draft listings immediately, making it visible to other users.
+// @Tags			listings
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{string}	string				"Listing published successfully"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid product ID"
+// @Failure		404				{object}	errs.ErrorResponse	"No draft listing found for this user"
+// @Router			/listings/{id}/publish [POST]
+func (t *TransportConfig) PublishListing(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	if err := t.CoreStore.PublishListing(r.Context(), uid, pid); err != nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to publish listing: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Relist a listing
+// @Description	Creates a new active listing from one of the authenticated user's unsold or closed listings, copying its name, category, description, images and last price. The original listing is closed.
+// @Tags			listings
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string					true	"Product ID"
+// @Param			Authorization	header		string					true	"Access token"
+// @Success		200				{object}	CreateListingResponse	"ID of the new listing"
+// @Failure		400				{object}	errs.ErrorResponse		"Bad request - invalid product ID"
+// @Failure		404				{object}	errs.ErrorResponse		"No unsold listing found for this user"
+// @Router			/listings/{id}/relist [POST]
+func (t *TransportConfig) RelistListing(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	productId, err := t.CoreStore.RelistListing(r.Context(), uid, pid)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to relist listing: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CreateListingResponse{ProductID: productId}); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode product id: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Duplicate a listing
+// @Description	Creates an editable draft from one of the authenticated user's listings, copying its name, category, description, images and last price.
+// @Tags			listings
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string					true	"Product ID"
+// @Param			Authorization	header		string					true	"Access token"
+// @Success		200				{object}	CreateListingResponse	"ID of the new draft listing"
+// @Failure		400				{object}	errs.ErrorResponse		"Bad request - invalid product ID"
+// @Failure		404				{object}	errs.ErrorResponse		"No listing found for this user"
+// @Router			/listings/{id}/duplicate [POST]
+func (t *TransportConfig) DuplicateListing(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	productId, err := t.CoreStore.DuplicateListing(r.Context(), uid, pid)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to duplicate listing: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CreateListingResponse{ProductID: productId}); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode product id: "+err.Error())
+		return
+	}
+}
+
 // @Summary		Update sold status via bid
 // @Description	This endpoint updates the sold status of a product based on a successful bid. The request body must contain the bid details in JSON format.
 // @Tags			listings
@@ -137,6 +249,7 @@ func (t *TransportConfig) UpdateSoldViaBid(w http.ResponseWriter, r *http.Reques
 
 // @Summary		Get product listings
 // @Description	Retrieves a paginated list of product listings for the authenticated user. Supports optional filtering by category and price range.
+// @Description	Only active listings are returned, except when creator is the authenticated user, who then also sees their drafts and closed listings.
 // @Tags			listings
 // @Accept			json
 // @Produce		json
@@ -147,8 +260,12 @@ func (t *TransportConfig) UpdateSoldViaBid(w http.ResponseWriter, r *http.Reques
 // @Param			searchquery		query		string				false	"search query"
 // @Param			endprice		query		string				false	"Maximum price filter"
 // @Param			creator			query		string				false	"the person who created the listing"
+// @Param			attr.{key}		query		string				false	"Attribute filter, e.g. attr.brand=Rolex. Numeric attributes also accept attr.{key}_gt, _gte, _lt and _lte"
+// @Param			images			query		string				false	"Which images to include: all (default) or primary, only the first image of every listing"
 // @Param			Authorization	header		string				true	"Access token"
+// @Param			If-None-Match	header		string				false	"ETag of a previously fetched page"
 // @Success		200				{array}		models.Product		"List of product listings"
+// @Success		304				{string}	string				"Not modified"
 // @Failure		400				{object}	errs.ErrorResponse	"Bad request - missing or invalid parameters"
 // @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
 // @Router			/listings [GET]
@@ -183,16 +300,32 @@ func (t *TransportConfig) GetListings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	products, err := t.CoreStore.GetListings(r.Context(), uid, r.URL.Query().Get("category"), r.URL.Query().Get("searchquery"), r.URL.Query().Get("startprice"), r.URL.Query().Get("endprice"), r.URL.Query().Get("creator"), limit, page)
+	attributes := map[string][]string{}
+	for key, values := range r.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "attr."); ok {
+			attributes[name] = values
+		}
+	}
+
+	var primaryImageOnly bool
+	switch r.URL.Query().Get("images") {
+	case "", "all":
+	case "primary":
+		primaryImageOnly = true
+	default:
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'images' URL parameter, must be 'all' or 'primary'")
+		return
+	}
+
+	products, err := t.CoreStore.GetListings(r.Context(), uid, r.URL.Query().Get("category"), r.URL.Query().Get("searchquery"), r.URL.Query().Get("startprice"), r.URL.Query().Get("endprice"), r.URL.Query().Get("creator"), attributes, primaryImageOnly, limit, page)
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Set("Content-Type", "application/json")
-	gz := gzip.NewWriter(w)
-	defer gz.Close()
+	if notModified(w, r, store.ListingETag(products...), CACHE_CONTROL_LISTINGS) {
+		return
+	}
 
 	body, err := json.Marshal(products)
 	if err != nil {
@@ -200,7 +333,8 @@ func (t *TransportConfig) GetListings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gz.Write(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
 }
 
 // @Summary      Checkout cart
@@ -272,7 +406,9 @@ func (t *TransportConfig) UpdateListing(w http.ResponseWriter, r *http.Request)
 // @Tags         listings
 // @Produce      json
 // @Param        id      path     string                true  "Product UUID"
+// @Param        If-None-Match  header  string          false "ETag of a previously fetched version"
 // @Success      200     {array}  models.Product        "List of product listings"
+// @Success      304     {string} string                "Not modified"
 // @Failure      400     {object} errs.ErrorResponse    "Bad request - invalid or missing product ID"
 // @Failure      500     {object} errs.ErrorResponse    "Internal server error"
 // @Router       /listings/{id} [get]
@@ -284,16 +420,21 @@ func (t *TransportConfig) GetListingsById(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	products, err := t.CoreStore.GetListingByid(r.Context(), pid)
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	products, err := t.CoreStore.GetListingByid(r.Context(), uid, pid)
 	if err != nil {
 		errs.ErrorWithJson(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Set("Content-Type", "application/json")
-	gz := gzip.NewWriter(w)
-	defer gz.Close()
+	if notModified(w, r, store.ListingETag(products), CACHE_CONTROL_LISTING) {
+		return
+	}
 
 	body, err := json.Marshal(products)
 	if err != nil {
@@ -301,5 +442,6 @@ func (t *TransportConfig) GetListingsById(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	gz.Write(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/gopher93185789/luxora/server/core/auth"
 	"github.com/gopher93185789/luxora/server/core/store"
+	"github.com/gopher93185789/luxora/server/database/cache"
 	"github.com/gopher93185789/luxora/server/pkg/logger"
 	"github.com/gopher93185789/luxora/server/pkg/middleware"
 )
@@ -13,12 +14,23 @@ type TransportConfig struct {
 	CoreStore  *store.CoreStoreContext
 	Middleware *middleware.AuthMiddleWareConfig
 	Logger     *logger.Logger
+	// Cache is nil when caching is disabled
+	Cache *cache.Cache
 }
 
 type AccessTokenResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
+// LinkResponse is where to send the user to link an account of a provider.
+type LinkResponse struct {
+	URL string `json:"url"`
+}
+
 type CreateListingResponse struct {
 	ProductID uuid.UUID `json:"product_id"`
 }
+
+type VerificationRequestResponse struct {
+	VerificationID uuid.UUID `json:"verification_id"`
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	"github.com/gopher93185789/luxora/server/database"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// maxCredentialsBytes is far more than any valid signup or login needs.
+const maxCredentialsBytes = 4 << 10
+
+func writeTokens(w http.ResponseWriter, at, rt string) {
+	setCookies(w, rt)
+
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(AccessTokenResponse{AccessToken: at}); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode access token")
+		return
+	}
+}
+
+// @Summary		Sign up with email and password
+// @Description	Creates an account with an email and password and logs it in. Passwords must be 10 to 128 characters, contain a letter and a digit or symbol, and not contain the email or username.
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			signup	body		models.Signup		true	"Email, username and password"
+// @Success		200		{object}	AccessTokenResponse	"Access token response"
+// @Failure		400		{object}	errs.ErrorResponse	"Invalid email, username or password"
+// @Failure		409		{object}	errs.ErrorResponse	"Email or username already taken"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/signup [post]
+func (t *TransportConfig) Signup(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCredentialsBytes)
+	defer r.Body.Close()
+
+	var signup models.Signup
+	if err := json.NewDecoder(r.Body).Decode(&signup); err != nil {
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
+		return
+	}
+
+	at, rt, err := t.CoreAuth.Signup(r.Context(), &signup, clientFromRequest(r))
+	if errors.Is(err, coreAuth.ErrInvalidSignup) {
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrUserExists) {
+		errs.ErrorWithJson(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to sign up")
+		return
+	}
+
+	writeTokens(w, at, rt)
+}
+
+// @Summary		Log in with email and password
+// @Description	Logs in an account created with /auth/signup.
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			login	body		models.Login		true	"Email and password"
+// @Success		200		{object}	AccessTokenResponse	"Access token response"
+// @Failure		401		{object}	errs.ErrorResponse	"Invalid email or password"
+// @Failure		403		{object}	errs.ErrorResponse	"Account is suspended"
+// @Failure		422		{object}	errs.ErrorResponse	"Unprocessable entity - invalid JSON payload"
+// @Failure		500		{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/login [post]
+func (t *TransportConfig) Login(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCredentialsBytes)
+	defer r.Body.Close()
+
+	var login models.Login
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
+		return
+	}
+
+	at, rt, err := t.CoreAuth.Login(r.Context(), &login, clientFromRequest(r))
+	if errors.Is(err, coreAuth.ErrInvalidCredentials) {
+		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if errors.Is(err, coreAuth.ErrUserSuspended) {
+		errs.ErrorWithJson(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to log in")
+		return
+	}
+
+	writeTokens(w, at, rt)
+}
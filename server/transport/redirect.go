@@ -1,28 +1,98 @@
 package transport
 
 import (
-	"golang.org/x/oauth2"
 	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	coreAuth "github.com/gopher93185789/luxora/server/core/auth"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
 )
 
+const OAUTH_STATE_COOKIE = "LOS"
+
+func setOauthStateCookie(w http.ResponseWriter, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     OAUTH_STATE_COOKIE,
+		Value:    value,
+		Path:     "/auth",
+		Domain:   "luxoras.nl",
+		Expires:  time.Now().Add(coreAuth.OAUTH_STATE_EXPIRY),
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+}
+
+func clearOauthStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     OAUTH_STATE_COOKIE,
+		Value:    "",
+		Path:     "/auth",
+		Domain:   "luxoras.nl",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+}
+
+// oauthRedirect starts a login with provider. Every login gets its own state, so the redirect must
+// not be cached.
+func (t *TransportConfig) oauthRedirect(w http.ResponseWriter, r *http.Request, provider string) {
+	defer r.Body.Close()
+
+	a, cookie, err := t.CoreAuth.StartOauthLogin(provider)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to start login: "+err.Error())
+		return
+	}
+
+	setOauthStateCookie(w, cookie)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, a, http.StatusFound)
+}
+
+// oauthVerifier checks the state of an exchange against the login cookie and returns the PKCE
+// verifier of the login, and the user to link to if it is a link. The cookie is cleared either way,
+// a login can only be finished once.
+func (t *TransportConfig) oauthVerifier(w http.ResponseWriter, r *http.Request, provider string) (verifier string, link uuid.UUID, ok bool) {
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		clearOauthStateCookie(w)
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "login failed: "+reason)
+		return "", uuid.Nil, false
+	}
+
+	var value string
+	if cookie, err := r.Cookie(OAUTH_STATE_COOKIE); err == nil {
+		value = cookie.Value
+	}
+
+	clearOauthStateCookie(w)
+
+	verifier, link, err := t.CoreAuth.VerifyOauthLogin(provider, value, r.URL.Query().Get("state"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusUnauthorized, err.Error())
+		return "", uuid.Nil, false
+	}
+
+	return verifier, link, true
+}
+
 // @Summary		Github Oauth redirect
-// @Description	redirect to Github for Oauth authentication.
+// @Description	redirect to Github for Oauth authentication. Sets a short-lived cookie binding the login to this browser, which the exchange requires.
 // @Tags			auth
 // @Accept			*/*
 // @Router			/auth/github [get]
 func (t *TransportConfig) GithubRedirect(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	a := t.CoreAuth.GithubConfig.AuthCodeURL(t.CoreAuth.OauthState, oauth2.AccessTypeOffline)
-	http.Redirect(w, r, a, http.StatusPermanentRedirect)
+	t.oauthRedirect(w, r, coreAuth.PROVIDER_GITHUB)
 }
 
 // @Summary		Google Oauth redirect
-// @Description	redirect to Google for Oauth authentication.
+// @Description	redirect to Google for Oauth authentication. Sets a short-lived cookie binding the login to this browser, which the exchange requires.
 // @Tags			auth
 // @Accept			*/*
 // @Router			/auth/google [get]
 func (t *TransportConfig) GoogleRedirect(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	a := t.CoreAuth.GoogleConfig.AuthCodeURL(t.CoreAuth.OauthState, oauth2.AccessTypeOffline)
-	http.Redirect(w, r, a, http.StatusPermanentRedirect)
+	t.oauthRedirect(w, r, coreAuth.PROVIDER_GOOGLE)
 }
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/database"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// maxUserAgentLength keeps a client from storing arbitrary amounts of text on its session.
+const maxUserAgentLength = 512
+
+// clientFromRequest describes the device a request comes from. The server is not behind a proxy,
+// so the remote address is the address of the client.
+func clientFromRequest(r *http.Request) *models.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return &models.Client{UserAgent: userAgent, IPAddress: ip}
+}
+
+// @Summary		List sessions
+// @Description	Lists the devices the user is logged in on, most recently used first. The session of the access token is marked current.
+// @Tags			auth
+// @Produce		json
+// @Param			Authorization	header		string	true	"Access token"
+// @Success		200				{array}		models.Session		"Sessions"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/sessions [get]
+func (t *TransportConfig) GetSessions(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	sessions, err := t.CoreAuth.GetSessions(r.Context(), uid, middleware.GetSessionFromRequest(r))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode sessions")
+		return
+	}
+}
+
+// @Summary		Revoke a session
+// @Description	Logs the user out on one device. Its refresh token and access tokens stop working at once.
+// @Tags			auth
+// @Param			Authorization	header	string	true	"Access token"
+// @Param			id				path	string	true	"Session ID"
+// @Success		204				"Session revoked"
+// @Failure		400				{object}	errs.ErrorResponse	"Invalid session id"
+// @Failure		404				{object}	errs.ErrorResponse	"Session not found"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/sessions/{id} [delete]
+func (t *TransportConfig) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	err = t.CoreAuth.RevokeSession(r.Context(), uid, sessionID)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		errs.ErrorWithJson(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+
+	if sessionID == middleware.GetSessionFromRequest(r) {
+		clearCookies(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Log out everywhere
+// @Description	Ends every session of the user, including the current one.
+// @Tags			auth
+// @Param			Authorization	header	string	true	"Access token"
+// @Success		204				"Logged out everywhere"
+// @Failure		500				{object}	errs.ErrorResponse	"Internal server error"
+// @Router			/auth/sessions [delete]
+func (t *TransportConfig) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	if err := t.CoreAuth.LogoutEverywhere(r.Context(), uid); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to log out")
+		return
+	}
+
+	clearCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gopher93185789/luxora/server/core/store"
+	errs "github.com/gopher93185789/luxora/server/pkg/error"
+	"github.com/gopher93185789/luxora/server/pkg/middleware"
+	"github.com/gopher93185789/luxora/server/pkg/models"
+)
+
+// @Summary		Request authenticity verification
+// @Description	Submits one of the authenticated user's active listings for review by a verifier. Listings that were rejected can be submitted again.
+// @Tags			verification
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string						true	"Product ID"
+// @Param			Authorization	header		string						true	"Access token"
+// @Success		200				{object}	VerificationRequestResponse	"ID of the verification request"
+// @Failure		400				{object}	errs.ErrorResponse			"Bad request - invalid product ID"
+// @Failure		404				{object}	errs.ErrorResponse			"No unverified active listing found for this user"
+// @Router			/listings/{id}/verification [POST]
+func (t *TransportConfig) RequestVerification(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	verificationID, err := t.CoreStore.RequestVerification(r.Context(), uid, pid)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to request verification: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(VerificationRequestResponse{VerificationID: verificationID}); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode verification id: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Get verification history
+// @Description	Returns every verification request of a listing with the outcome and reviewer notes, newest first.
+// @Tags			verification
+// @Accept			*/*
+// @Produce		json
+// @Param			id				path		string				true	"Product ID"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{array}		models.Verification	"Verification history"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid product ID"
+// @Failure		404				{object}	errs.ErrorResponse	"Listing not found"
+// @Router			/listings/{id}/verification [GET]
+func (t *TransportConfig) GetVerificationHistory(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	pid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	verifications, err := t.CoreStore.GetVerificationHistory(r.Context(), uid, pid)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to get verification history: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verifications); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode verification history: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Get pending verifications
+// @Description	Returns the verification requests waiting for review, oldest first. Only available to verifiers.
+// @Tags			verification
+// @Accept			*/*
+// @Produce		json
+// @Param			limit			query		int					false	"Maximum number of results (default 50)"
+// @Param			page			query		int					false	"Page number (default 1)"
+// @Param			Authorization	header		string				true	"Access token"
+// @Success		200				{array}		models.Verification	"Pending verification requests"
+// @Failure		400				{object}	errs.ErrorResponse	"Bad request - invalid pagination parameters"
+// @Failure		403				{object}	errs.ErrorResponse	"User is not a verifier"
+// @Router			/verifications [GET]
+func (t *TransportConfig) GetPendingVerifications(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	limit := 50
+	page := 1
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	verifications, err := t.CoreStore.GetPendingVerifications(r.Context(), uid, limit, page)
+	if errors.Is(err, store.ErrForbidden) {
+		errs.ErrorWithJson(w, http.StatusForbidden, "only verifiers can review listings")
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to get pending verifications: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verifications); err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode pending verifications: "+err.Error())
+		return
+	}
+}
+
+// @Summary		Review a verification request
+// @Description	Approves or rejects a pending verification request. Rejections must include notes. Verifiers can not review their own listings.
+// @Tags			verification
+// @Accept			json
+// @Produce		json
+// @Param			id				path		string						true	"Verification ID"
+// @Param			review			body		models.VerificationReview	true	"Outcome of the review"
+// @Param			Authorization	header		string						true	"Access token"
+// @Success		200				{string}	string						"Verification reviewed successfully"
+// @Failure		400				{object}	errs.ErrorResponse			"Bad request - invalid verification ID or review"
+// @Failure		403				{object}	errs.ErrorResponse			"User is not a verifier"
+// @Failure		422				{object}	errs.ErrorResponse			"Unprocessable entity - invalid JSON payload"
+// @Router			/verifications/{id}/review [POST]
+func (t *TransportConfig) ReviewVerification(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	vid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid verification id")
+		return
+	}
+
+	var review models.VerificationReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json payload")
+		return
+	}
+
+	uid, err := middleware.GetTokenFromRequest(r)
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get user id from 'Authorization' header")
+		return
+	}
+
+	err = t.CoreStore.ReviewVerification(r.Context(), uid, vid, &review)
+	if errors.Is(err, store.ErrForbidden) {
+		errs.ErrorWithJson(w, http.StatusForbidden, "only verifiers can review listings")
+		return
+	}
+	if err != nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to review verification: "+err.Error())
+		return
+	}
+}
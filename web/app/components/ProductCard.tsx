@@ -2,6 +2,7 @@ import React, { useState } from "react";
 import { motion } from "framer-motion";
 import { Link } from "@remix-run/react";
 import type { ProductInfo } from "~/pkg/api/products";
+import { getApiUrl } from "~/pkg/config/api";
 
 interface ProductCardProps {
   product: ProductInfo;
@@ -63,7 +64,7 @@ export function ProductCard({ product, onDelete, showDeleteButton = false }: Pro
               </div>
             )}
             <img
-              src={`data:image/jpg;base64,${primaryImage.base_64_image}`}
+              src={getApiUrl(primaryImage.thumbnail_url)}
               alt={product.name}
               className="w-full h-full object-cover group-hover:scale-105 transition-transform duration-300"
               onLoad={handleImageLoad}
@@ -147,7 +148,7 @@ export function SimpleProductCard({ product }: { product: ProductInfo}) {
         <div className="relative aspect-square overflow-hidden bg-primary/50">
           {product.product_images && product.product_images.length > 0 ? (
             <img
-              src={`data:image/jpg;base64,${product.product_images[0].base_64_image}`}
+              src={getApiUrl(product.product_images[0].thumbnail_url)}
               alt={product.name}
               className="w-full h-full object-cover"
             />
@@ -3,7 +3,7 @@ import {
   SetTokenInLocalStorage,
 } from "../helpers/tokenHandling";
 import { getApiUrl } from "../config/api";
-import { AccessTokenResponse, ErrorResponse, UserDetails } from "../models/api";
+import { AccessTokenResponse, ErrorResponse, Session, UserDetails } from "../models/api";
 
 export async function OauthExchange(
   code: string,
@@ -34,6 +34,167 @@ export async function OauthExchange(
   }
 }
 
+async function passwordAuth(
+  path: "/auth/signup" | "/auth/login",
+  body: object
+): Promise<ErrorResponse | undefined> {
+  try {
+    const resp = await fetch(getApiUrl(path), {
+      method: "POST",
+      credentials: "include",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    });
+
+    const data = (await resp.json()) as AccessTokenResponse | ErrorResponse;
+    if (!resp.ok) return data as ErrorResponse;
+
+    const tokenResponse = data as AccessTokenResponse;
+    if (!tokenResponse.access_token)
+      throw new Error("failed to get access token");
+    SetTokenInLocalStorage(tokenResponse.access_token);
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+export async function PasswordSignup(
+  email: string,
+  username: string,
+  password: string
+): Promise<ErrorResponse | undefined> {
+  return passwordAuth("/auth/signup", { email, username, password });
+}
+
+export async function PasswordLogin(
+  email: string,
+  password: string
+): Promise<ErrorResponse | undefined> {
+  return passwordAuth("/auth/login", { email, password });
+}
+
+async function emailAction(
+  path: string,
+  body: object,
+  authenticated = false
+): Promise<ErrorResponse | undefined> {
+  const headers: Record<string, string> = { "Content-Type": "application/json" };
+  if (authenticated) headers["Authorization"] = GetTokenFromLocalStorage();
+
+  try {
+    const resp = await fetch(getApiUrl(path), {
+      method: "POST",
+      credentials: "include",
+      headers,
+      body: JSON.stringify(body),
+    });
+
+    if (!resp.ok) return (await resp.json()) as ErrorResponse;
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+export async function SendEmailVerification(): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/email/verification", {}, true);
+}
+
+export async function VerifyEmail(token: string): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/email/verify", { token });
+}
+
+export async function ForgotPassword(email: string): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/password/forgot", { email });
+}
+
+export async function ResetPassword(
+  token: string,
+  password: string
+): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/password/reset", { token, password });
+}
+
+export async function RequestEmailChange(email: string): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/email/change", { email }, true);
+}
+
+export async function ConfirmEmailChange(token: string): Promise<ErrorResponse | undefined> {
+  return emailAction("/auth/email/change/confirm", { token });
+}
+
+export async function LinkProvider(
+  provider: "github" | "google"
+): Promise<ErrorResponse | undefined> {
+  try {
+    const resp = await fetch(getApiUrl(`/auth/link/${provider}`), {
+      method: "POST",
+      credentials: "include",
+      headers: { Authorization: GetTokenFromLocalStorage() },
+    });
+
+    const data = await resp.json();
+    if (!resp.ok) return data as ErrorResponse;
+
+    window.location.href = (data as { url: string }).url;
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+export async function UnlinkProvider(
+  provider: "github" | "google"
+): Promise<ErrorResponse | undefined> {
+  try {
+    const resp = await fetch(getApiUrl(`/auth/link/${provider}`), {
+      method: "DELETE",
+      credentials: "include",
+      headers: { Authorization: GetTokenFromLocalStorage() },
+    });
+
+    if (!resp.ok) return (await resp.json()) as ErrorResponse;
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+export async function GetSessions(): Promise<Session[] | ErrorResponse> {
+  try {
+    const resp = await fetch(getApiUrl("/auth/sessions"), {
+      method: "GET",
+      credentials: "include",
+      headers: { Authorization: GetTokenFromLocalStorage() },
+    });
+
+    const data = await resp.json();
+    if (!resp.ok) return data as ErrorResponse;
+    return data as Session[];
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+async function deleteSessions(path: string): Promise<ErrorResponse | undefined> {
+  try {
+    const resp = await fetch(getApiUrl(path), {
+      method: "DELETE",
+      credentials: "include",
+      headers: { Authorization: GetTokenFromLocalStorage() },
+    });
+
+    if (!resp.ok) return (await resp.json()) as ErrorResponse;
+  } catch {
+    return { code: 500, message: "Unexpected error" } as ErrorResponse;
+  }
+}
+
+export async function RevokeSession(id: string): Promise<ErrorResponse | undefined> {
+  return deleteSessions(`/auth/sessions/${id}`);
+}
+
+export async function LogoutEverywhere(): Promise<ErrorResponse | undefined> {
+  return deleteSessions("/auth/sessions");
+}
+
 export async function VerifyToken(): Promise<number> {
   const token = GetTokenFromLocalStorage();
   if (token === "") return 403;
@@ -21,9 +21,10 @@ export interface ProductInfo {
 }
 
 export interface ProductImage {
-  base_64_image: string;
-  checksum: string;
-  compressedImage: number[];
+  id: string;
+  url: string;
+  medium_url: string;
+  thumbnail_url: string;
   order: number;
 }
 
@@ -35,6 +36,7 @@ export interface GetProductsParams {
   endprice?: string;
   searchquery?: string;
   creator?: string;
+  images?: "all" | "primary";
 }
 
 export async function GetProducts(
@@ -53,6 +55,7 @@ export async function GetProducts(
   if (params.searchquery)
     searchParams.append("searchquery", params.searchquery);
   if (params.creator) searchParams.append("creator", params.creator);
+  if (params.images) searchParams.append("images", params.images);
   
 
   const req = async (): Promise<Response> => {
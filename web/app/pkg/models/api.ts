@@ -55,11 +55,22 @@ export interface Email {
 
 export interface UserDetails {
   email: Email;
+  email_verified: boolean;
   id: string;
   profile_image_link: string;
   username: string;
 }
 
+export interface Session {
+  session_id: string;
+  user_agent: string;
+  ip_address: string;
+  created_at: string;
+  last_used_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
 export interface AccessTokenResponse {
   access_token: string;
 }
@@ -9,6 +9,7 @@ import { json, type LoaderFunctionArgs } from "@remix-run/cloudflare";
 import { useState } from "react";
 import { motion } from "framer-motion";
 import { GetProduct, type ProductInfo } from "~/pkg/api/products";
+import { getApiUrl } from "~/pkg/config/api";
 import type { ErrorResponse } from "~/pkg/models/api";
 import { Sidebar } from "~/components/navigation/sidebar";
 import { getTokenFromServerSideCaller } from "~/pkg/helpers/server";
@@ -103,7 +104,7 @@ export default function ProductPage() {
               <div className="aspect-square bg-primary/50 rounded-lg overflow-hidden border border-border/10">
                 {selectedImage && !imageError ? (
                   <img
-                    src={`data:image/jpeg;base64,${selectedImage.base_64_image}`}
+                    src={getApiUrl(selectedImage.url)}
                     alt={product.name}
                     className="w-full h-full object-cover"
                     onError={handleImageError}
@@ -139,7 +140,7 @@ export default function ProductPage() {
                       }`}
                     >
                       <img
-                        src={`data:image/jpeg;base64,${image.base_64_image}`}
+                        src={getApiUrl(image.thumbnail_url)}
                         alt={`${product.name} ${index + 1}`}
                         className="w-full h-full object-cover"
                       />